@@ -0,0 +1,563 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"went-framework/internal/handlers"
+	"went-framework/internal/locking"
+	"went-framework/internal/patch"
+	"went-framework/internal/render"
+	"went-framework/internal/validation"
+
+	"gorm.io/gorm"
+)
+
+// Defaults of the bulk endpoints
+const (
+	DefaultMaxBulkItems  = 1000
+	DefaultBulkBatchSize = 100
+)
+
+// Bulk modes, selected with ?mode=
+const (
+	// BulkAtomic writes all items in one transaction, or none if any item fails
+	BulkAtomic = "atomic"
+	// BulkBestEffort writes every valid item and reports the failed ones
+	BulkBestEffort = "best_effort"
+)
+
+// BulkResult is the outcome of one item of a bulk request
+type BulkResult struct {
+	Index   int               `json:"index"`
+	ID      uint              `json:"id,omitempty"`
+	Status  int               `json:"status"`
+	Message string            `json:"message,omitempty"`
+	Errors  map[string]string `json:"errors,omitempty"`
+}
+
+// BulkSummary counts the results of a bulk request
+type BulkSummary struct {
+	Mode      string `json:"mode"`
+	Total     int    `json:"total"`
+	Succeeded int    `json:"succeeded"`
+	Failed    int    `json:"failed"`
+}
+
+// bulkMode parses ?mode=, which defaults to atomic
+func bulkMode(r *http.Request) (string, error) {
+	switch mode := r.URL.Query().Get("mode"); mode {
+	case "", BulkAtomic:
+		return BulkAtomic, nil
+	case BulkBestEffort:
+		return BulkBestEffort, nil
+	default:
+		return "", handlers.BadRequest(fmt.Sprintf("Invalid mode '%s', use %s or %s", mode, BulkAtomic, BulkBestEffort))
+	}
+}
+
+// checkBulkSize rejects empty bulk requests and those over the item limit
+func (c *Resource[T]) checkBulkSize(count int) error {
+	if count == 0 {
+		return handlers.BadRequest("At least one item is required")
+	}
+	if count > c.config.MaxBulkItems {
+		return handlers.NewError(http.StatusRequestEntityTooLarge, handlers.CodePayloadTooLarge,
+			fmt.Sprintf("At most %d %ss can be processed at once", c.config.MaxBulkItems, c.name()))
+	}
+	return nil
+}
+
+// bulkFailure is the result of an item that failed with err
+func bulkFailure(index int, id uint, err error) BulkResult {
+	appErr := handlers.FromError(err)
+	return BulkResult{Index: index, ID: id, Status: appErr.Status, Message: appErr.Message, Errors: appErr.Errors}
+}
+
+// skipPending marks the results of items that were valid but not written
+// because other items of an atomic request failed
+func skipPending(results []BulkResult, pending []int) {
+	for _, i := range pending {
+		results[i].Status = http.StatusFailedDependency
+		results[i].Message = "Not processed because other items failed"
+	}
+}
+
+// rollBack marks the results of an atomic request whose transaction failed on
+// the item at index failed: that item gets its error, and the other pending
+// items 424 Failed Dependency as their writes were rolled back
+func rollBack(results []BulkResult, pending []int, failed int, err error) {
+	for _, i := range pending {
+		if i == failed {
+			results[i] = bulkFailure(i, results[i].ID, err)
+			continue
+		}
+		results[i].Status = http.StatusFailedDependency
+		results[i].Message = "Rolled back because another item failed"
+	}
+}
+
+// duplicateID returns the error of an item repeating the id of an earlier item
+// of a bulk request, so no record is written twice
+func (c *Resource[T]) duplicateID(seen map[uint]bool, id uint) error {
+	if id == 0 || !seen[id] {
+		seen[id] = true
+		return nil
+	}
+	return handlers.BadRequest(fmt.Sprintf("Duplicate id %d, each %s can only appear once", id, c.name()))
+}
+
+// modelID returns the ID field of a model
+func modelID(model interface{}) uint {
+	v := reflect.Indirect(reflect.ValueOf(model))
+	if field := v.FieldByName("ID"); field.IsValid() && field.CanUint() {
+		return uint(field.Uint())
+	}
+	return 0
+}
+
+// loadByIDs loads the models with the given IDs in one query
+func loadByIDs[T any](db *gorm.DB, ids []uint) (map[uint]*T, error) {
+	var models []T
+	if err := db.Where("id IN ?", ids).Find(&models).Error; err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uint]*T, len(models))
+	for i := range models {
+		byID[modelID(&models[i])] = &models[i]
+	}
+	return byID, nil
+}
+
+// respondBulk writes the per-item results: success when all items succeeded,
+// 422 when none was written and 207 Multi-Status when some were
+func (c *Resource[T]) respondBulk(w http.ResponseWriter, r *http.Request, mode string, results []BulkResult, successStatus int, done string) {
+	summary := BulkSummary{Mode: mode, Total: len(results)}
+	for _, result := range results {
+		if result.Status < http.StatusBadRequest {
+			summary.Succeeded++
+		} else {
+			summary.Failed++
+		}
+	}
+
+	plural := c.name() + "s"
+	status, responseStatus := successStatus, "success"
+	message := fmt.Sprintf("%d %s %s successfully", summary.Total, plural, done)
+	switch {
+	case summary.Failed > 0 && summary.Succeeded == 0:
+		status, responseStatus = http.StatusUnprocessableEntity, "error"
+		message = fmt.Sprintf("No %s were %s, see the result of each item", plural, done)
+	case summary.Failed > 0:
+		status, responseStatus = http.StatusMultiStatus, "partial"
+		message = fmt.Sprintf("%d of %d %s %s, see the result of each item", summary.Succeeded, summary.Total, plural, done)
+	}
+
+	respond(w, r, status, Response{
+		Status:  responseStatus,
+		Message: message,
+		Data:    results,
+		Meta:    summary,
+	})
+}
+
+// BulkStore handles POST /{resource}/bulk with a list of items to create
+func (c *Resource[T]) BulkStore(w http.ResponseWriter, r *http.Request) {
+	mode, err := bulkMode(r)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	models, errs, err := c.config.Input.ApplyAll(r)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	if err := c.checkBulkSize(len(models)); err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	results := make([]BulkResult, len(models))
+	var pending []int
+	for i := range models {
+		restoreProtected(&models[i], new(T))
+		results[i].Index = i
+		if errs[i] != nil {
+			results[i] = bulkFailure(i, 0, errs[i])
+		} else {
+			pending = append(pending, i)
+		}
+	}
+
+	db, err := getDB()
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	if mode == BulkAtomic {
+		if len(pending) < len(models) {
+			skipPending(results, pending)
+			c.respondBulk(w, r, mode, results, http.StatusCreated, "created")
+			return
+		}
+
+		failed, err := c.createAtomic(r, db, models)
+		if err != nil {
+			if failed < 0 {
+				c.respondWriteError(w, r, "create", err)
+				return
+			}
+			rollBack(results, pending, failed, c.writeError("create", err))
+			c.respondBulk(w, r, mode, results, http.StatusCreated, "created")
+			return
+		}
+		for i := range models {
+			results[i] = BulkResult{Index: i, ID: modelID(&models[i]), Status: http.StatusCreated}
+		}
+	} else {
+		c.createBestEffort(r, db, models, pending, results)
+	}
+
+	c.respondBulk(w, r, mode, results, http.StatusCreated, "created")
+}
+
+// createItems creates models in tx with the create hooks, which run once per
+// item: the before hooks, then one insert per BulkBatchSize items, then the
+// after hooks. When a batch insert fails, only the inserts are retried one by
+// one to find the failing items. Failing items are left out, the writes of
+// their hooks undone by savepoints, and their errors are returned by position;
+// with stop, it returns at the first one. err is set when tx itself failed.
+func (c *Resource[T]) createItems(r *http.Request, tx *gorm.DB, models []*T, stop bool) (errs []error, err error) {
+	errs = make([]error, len(models))
+
+	var valid []int
+	for k, model := range models {
+		if err := c.runHookSavepoint(c.config.Hooks.BeforeCreate, r, tx, model); err != nil {
+			errs[k] = err
+			if stop {
+				return errs, nil
+			}
+			continue
+		}
+		valid = append(valid, k)
+	}
+
+	var inserted []int
+	size := c.config.BulkBatchSize
+	for start := 0; start < len(valid); start += size {
+		batch := valid[start:min(start+size, len(valid))]
+		rows := make([]*T, len(batch))
+		for j, k := range batch {
+			rows[j] = models[k]
+		}
+		err := tx.Transaction(func(savepoint *gorm.DB) error {
+			return savepoint.Create(rows).Error
+		})
+		if err == nil {
+			inserted = append(inserted, batch...)
+			continue
+		}
+
+		for j, k := range batch {
+			err := tx.Transaction(func(savepoint *gorm.DB) error {
+				return savepoint.Create(rows[j]).Error
+			})
+			if err != nil {
+				errs[k] = err
+				if stop {
+					return errs, nil
+				}
+				continue
+			}
+			inserted = append(inserted, k)
+		}
+	}
+
+	for _, k := range inserted {
+		if err := c.runHookSavepoint(c.config.Hooks.AfterCreate, r, tx, models[k]); err != nil {
+			errs[k] = err
+			if stop {
+				return errs, nil
+			}
+			// The item is not created after all
+			if err := tx.Unscoped().Delete(models[k]).Error; err != nil {
+				return errs, err
+			}
+		}
+	}
+	return errs, nil
+}
+
+// createAtomic creates the models in one transaction, see createItems. When an
+// item fails, its index is returned with the error, or -1 when the error
+// concerns no item in particular.
+func (c *Resource[T]) createAtomic(r *http.Request, db *gorm.DB, models []T) (int, error) {
+	items := make([]*T, len(models))
+	for i := range models {
+		items[i] = &models[i]
+	}
+
+	failed := -1
+	err := db.Transaction(func(tx *gorm.DB) error {
+		errs, err := c.createItems(r, tx, items, true)
+		if err != nil {
+			return err
+		}
+		for i, err := range errs {
+			if err != nil {
+				failed = i
+				return err
+			}
+		}
+		return nil
+	})
+	return failed, err
+}
+
+// createBestEffort creates the pending models, one transaction per batch, see
+// createItems. Only the failing items are reported as failed.
+func (c *Resource[T]) createBestEffort(r *http.Request, db *gorm.DB, models []T, pending []int, results []BulkResult) {
+	size := c.config.BulkBatchSize
+	for start := 0; start < len(pending); start += size {
+		batch := pending[start:min(start+size, len(pending))]
+		items := make([]*T, len(batch))
+		for k, i := range batch {
+			items[k] = &models[i]
+		}
+
+		var errs []error
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			errs, err = c.createItems(r, tx, items, false)
+			return err
+		})
+		for k, i := range batch {
+			switch {
+			case err != nil:
+				results[i] = bulkFailure(i, 0, c.writeError("create", err))
+			case errs[k] != nil:
+				results[i] = bulkFailure(i, 0, c.writeError("create", errs[k]))
+			default:
+				results[i] = BulkResult{Index: i, ID: modelID(items[k]), Status: http.StatusCreated}
+			}
+		}
+	}
+}
+
+// BulkPatch handles PATCH /{resource}/bulk with a list of JSON merge patches,
+// each with the "id" of the record to patch and optionally its expected "version"
+func (c *Resource[T]) BulkPatch(w http.ResponseWriter, r *http.Request) {
+	mode, err := bulkMode(r)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	var items []map[string]interface{}
+	if err := render.Decode(r, &items); err != nil {
+		respondError(w, r, err)
+		return
+	}
+	if err := c.checkBulkSize(len(items)); err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	ids := make([]uint, len(items))
+	for i, item := range items {
+		ids[i] = itemID(item["id"])
+	}
+
+	db, err := getDB()
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	byID, err := loadByIDs[T](db, ids)
+	if err != nil {
+		respondError(w, r, handlers.Wrap(err, fmt.Sprintf("Failed to retrieve %ss", c.name())))
+		return
+	}
+
+	results := make([]BulkResult, len(items))
+	models := make([]*T, len(items))
+	seen := make(map[uint]bool, len(ids))
+	var pending []int
+	for i, item := range items {
+		if err := c.duplicateID(seen, ids[i]); err != nil {
+			results[i] = bulkFailure(i, ids[i], err)
+			continue
+		}
+		model, err := c.patchItem(r, byID, ids[i], item)
+		if err != nil {
+			results[i] = bulkFailure(i, ids[i], err)
+			continue
+		}
+		results[i] = BulkResult{Index: i, ID: ids[i]}
+		models[i] = model
+		pending = append(pending, i)
+	}
+
+	c.writeAll(w, r, db, mode, results, pending, "update", func(tx *gorm.DB, i int) error {
+		return c.update(r, tx, models[i])
+	})
+}
+
+// patchItem applies one item of a bulk patch to its loaded model and validates the result
+func (c *Resource[T]) patchItem(r *http.Request, byID map[uint]*T, id uint, item map[string]interface{}) (*T, error) {
+	if id == 0 {
+		return nil, handlers.BadRequest("Each item needs a numeric id")
+	}
+	model, ok := byID[id]
+	if !ok {
+		return nil, handlers.NotFound(fmt.Sprintf("%s not found", c.config.Name))
+	}
+
+	// An expected version must match the stored one
+	if version, ok := item["version"]; ok {
+		if versioned, isVersioned := any(model).(locking.Versioned); isVersioned && itemID(version) != versioned.GetVersion() {
+			return nil, handlers.Wrap(locking.ErrConflict, fmt.Sprintf("%s has been modified, reload it and retry", c.config.Name))
+		}
+	}
+
+	fields := make(map[string]interface{}, len(item))
+	for key, value := range item {
+		if key != "id" && key != "version" {
+			fields[key] = value
+		}
+	}
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return nil, handlers.BadRequest("Invalid patch")
+	}
+
+	if err := patch.Apply(model, patch.MergePatch, body); err != nil {
+		return nil, err
+	}
+	if err := validation.Validate(validation.IgnoreID(r.Context(), id), model); err != nil {
+		return nil, err
+	}
+	return model, nil
+}
+
+// itemID reads a numeric id or version from a decoded item
+func itemID(value interface{}) uint {
+	switch v := value.(type) {
+	case float64:
+		if v > 0 && v == float64(uint(v)) {
+			return uint(v)
+		}
+	case string:
+		if n, err := strconv.ParseUint(strings.TrimSpace(v), 10, 64); err == nil {
+			return uint(n)
+		}
+	}
+	return 0
+}
+
+// BulkDestroy handles DELETE /{resource}/bulk with a list of IDs to delete
+func (c *Resource[T]) BulkDestroy(w http.ResponseWriter, r *http.Request) {
+	mode, err := bulkMode(r)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	var ids []uint
+	if err := render.Decode(r, &ids); err != nil {
+		respondError(w, r, err)
+		return
+	}
+	if err := c.checkBulkSize(len(ids)); err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	db, err := getDB()
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	byID, err := loadByIDs[T](db, ids)
+	if err != nil {
+		respondError(w, r, handlers.Wrap(err, fmt.Sprintf("Failed to retrieve %ss", c.name())))
+		return
+	}
+
+	results := make([]BulkResult, len(ids))
+	seen := make(map[uint]bool, len(ids))
+	var pending []int
+	for i, id := range ids {
+		if err := c.duplicateID(seen, id); err != nil {
+			results[i] = bulkFailure(i, id, err)
+			continue
+		}
+		if _, ok := byID[id]; !ok {
+			results[i] = bulkFailure(i, id, handlers.NotFound(fmt.Sprintf("%s not found", c.config.Name)))
+			continue
+		}
+		results[i] = BulkResult{Index: i, ID: id}
+		pending = append(pending, i)
+	}
+
+	c.writeAll(w, r, db, mode, results, pending, "delete", func(tx *gorm.DB, i int) error {
+		return c.delete(r, tx, byID[ids[i]])
+	})
+}
+
+// writeAll runs write for the pending items of a bulk update or delete, all in one
+// transaction in atomic mode or each in its own in best-effort mode, and responds
+// with the results
+func (c *Resource[T]) writeAll(w http.ResponseWriter, r *http.Request, db *gorm.DB, mode string, results []BulkResult, pending []int, action string, write func(tx *gorm.DB, i int) error) {
+	done := action + "d"
+
+	if mode == BulkAtomic {
+		if len(pending) < len(results) {
+			skipPending(results, pending)
+			c.respondBulk(w, r, mode, results, http.StatusOK, done)
+			return
+		}
+
+		failed := -1
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, i := range pending {
+				if err := write(tx, i); err != nil {
+					failed = i
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			if failed < 0 {
+				c.respondWriteError(w, r, action, err)
+				return
+			}
+			rollBack(results, pending, failed, c.writeError(action, err))
+			c.respondBulk(w, r, mode, results, http.StatusOK, done)
+			return
+		}
+	} else {
+		for _, i := range pending {
+			err := db.Transaction(func(tx *gorm.DB) error {
+				return write(tx, i)
+			})
+			if err != nil {
+				results[i] = bulkFailure(i, results[i].ID, c.writeError(action, err))
+			}
+		}
+	}
+
+	for _, i := range pending {
+		if results[i].Status == 0 {
+			results[i].Status = http.StatusOK
+		}
+	}
+	c.respondBulk(w, r, mode, results, http.StatusOK, done)
+}
@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"went-framework/app/database"
+	"went-framework/internal/handlers"
+	"went-framework/internal/render"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// Response structure for JSON responses
+type Response struct {
+	Status  string      `json:"status"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+	Meta    interface{} `json:"meta,omitempty"`
+	Errors  interface{} `json:"errors,omitempty"`
+}
+
+// respond writes a response envelope with the given status code, in the format
+// negotiated from the Accept header
+func respond(w http.ResponseWriter, r *http.Request, statusCode int, response Response) {
+	render.Render(w, r, statusCode, response)
+}
+
+// respondError writes the error response of err, see handlers.RespondError
+func respondError(w http.ResponseWriter, r *http.Request, err error) {
+	handlers.RespondError(w, r, err)
+}
+
+// getDB returns the database connection, connecting on first use. Its
+// database.ErrUnavailable error responds 503 through respondError.
+func getDB() (*gorm.DB, error) {
+	return database.Get()
+}
+
+// parseID parses the {id} route variable
+func parseID(r *http.Request) (uint, error) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	return uint(id), err
+}
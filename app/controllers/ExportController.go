@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"went-framework/internal/handlers"
+	"went-framework/internal/query"
+	"went-framework/internal/render"
+	"went-framework/internal/tabular"
+
+	wentlog "went-framework/internal/logger"
+)
+
+// exportFlushRows is the number of rows after which an export is flushed to the client
+const exportFlushRows = 500
+
+// Export handles GET /{resource}/export?format=csv|xlsx. It takes the filters,
+// search and sort of the list endpoint and streams every matching row from a
+// database cursor, so the export is never held in memory.
+func (c *Resource[T]) Export(w http.ResponseWriter, r *http.Request) {
+	var model T
+
+	format, ok := tabular.Lookup(r.URL.Query().Get("format"))
+	if !ok {
+		respondError(w, r, handlers.BadRequest(fmt.Sprintf("Invalid format '%s', use %s",
+			r.URL.Query().Get("format"), strings.Join(tabular.Names(), " or "))))
+		return
+	}
+
+	params, err := query.Parse(r.URL.Query(), model)
+	if err != nil {
+		respondError(w, r, handlers.BadRequest(err.Error()))
+		return
+	}
+
+	// The columns come from the output of an empty model, so they are known
+	// before the first row and the header is written even for empty exports
+	columns, _, err := render.Row(c.output(&model))
+	if err != nil {
+		respondError(w, r, handlers.Wrap(err, fmt.Sprintf("Failed to export %ss", c.name())))
+		return
+	}
+
+	db, err := getDB()
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	db = db.WithContext(r.Context())
+	rows, err := db.Model(&model).Scopes(params.FilterScope, params.SortScope).Rows()
+	if err != nil {
+		respondError(w, r, handlers.Wrap(err, fmt.Sprintf("Failed to export %ss", c.name())))
+		return
+	}
+	defer rows.Close()
+
+	filename := fmt.Sprintf("%ss-%s.%s", c.name(), time.Now().Format("20060102-150405"), format.Extension)
+	w.Header().Set("Content-Type", format.MediaType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	// Large tables are streamed for longer than SERVER_WRITE_TIMEOUT
+	controller := http.NewResponseController(w)
+	controller.SetWriteDeadline(time.Time{})
+	w.WriteHeader(http.StatusOK)
+
+	// The status is sent, so failures from here on can only be logged
+	fail := func(err error) {
+		wentlog.ErrorContext(r.Context(), fmt.Sprintf("Failed to export %ss", c.name()), map[string]interface{}{
+			"cause":  err.Error(),
+			"method": r.Method,
+			"path":   r.URL.Path,
+		})
+	}
+
+	writer := format.New(w)
+	if err := writer.Write(columns); err != nil {
+		fail(err)
+		return
+	}
+
+	count := 0
+	for rows.Next() {
+		var item T
+		if err := db.ScanRows(rows, &item); err != nil {
+			fail(err)
+			return
+		}
+		_, cells, err := render.Row(c.output(&item))
+		if err != nil {
+			fail(err)
+			return
+		}
+
+		record := make([]string, len(columns))
+		for i, column := range columns {
+			record[i] = cells[column]
+		}
+		if err := writer.Write(record); err != nil {
+			fail(err)
+			return
+		}
+
+		if count++; count%exportFlushRows == 0 {
+			controller.Flush()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		fail(err)
+		return
+	}
+
+	if err := writer.Close(); err != nil {
+		fail(err)
+	}
+}
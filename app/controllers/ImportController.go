@@ -0,0 +1,306 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"went-framework/internal/handlers"
+	"went-framework/internal/render"
+	"went-framework/internal/tabular"
+
+	"gorm.io/gorm"
+)
+
+// DefaultMaxImportRows is the default row limit of one import
+const DefaultMaxImportRows = 10000
+
+// errDryRun rolls back the transaction of a dry run import
+var errDryRun = errors.New("dry run")
+
+// ImportFailure is a row of an imported file that was not imported
+type ImportFailure struct {
+	// Row is the line of the row in the file, the header being line 1
+	Row     int               `json:"row"`
+	Status  int               `json:"status"`
+	Message string            `json:"message"`
+	Errors  map[string]string `json:"errors,omitempty"`
+}
+
+// ImportSummary describes the outcome of an import
+type ImportSummary struct {
+	DryRun   bool `json:"dry_run"`
+	Total    int  `json:"total"`
+	Imported int  `json:"imported"`
+	Failed   int  `json:"failed"`
+	// Columns maps the columns of the file to the fields they were imported into
+	Columns map[string]string `json:"columns"`
+	Ignored []string          `json:"ignored_columns,omitempty"`
+}
+
+// importFile returns the CSV file of an import request: the "file" field of a
+// multipart/form-data upload or a text/csv body
+func importFile(r *http.Request) (io.ReadCloser, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "multipart/form-data":
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, handlers.ReadError(err, "Upload the CSV file in the 'file' field")
+		}
+		return file, nil
+	case "text/csv":
+		return r.Body, nil
+	default:
+		return nil, handlers.NewError(http.StatusUnsupportedMediaType, handlers.CodeUnsupportedMediaType,
+			"Import requires a multipart/form-data upload or a text/csv body")
+	}
+}
+
+// importColumns parses the explicit column mappings given as ?columns[Column]=field
+func importColumns(values url.Values) map[string]string {
+	columns := make(map[string]string)
+	for key, vals := range values {
+		if column, ok := strings.CutPrefix(key, "columns["); ok && strings.HasSuffix(column, "]") && len(vals) > 0 {
+			columns[strings.TrimSuffix(column, "]")] = vals[0]
+		}
+	}
+	return columns
+}
+
+// Import handles POST /{resource}/import with a CSV file. Columns are mapped to
+// the fields of the request body by name or with ?columns[Column]=field, each
+// row is validated like a store request and the valid rows are created. With
+// ?dry_run=true nothing is saved. With ?report=csv the failed rows are returned
+// as a CSV file with their line number and errors, to be fixed and imported again.
+func (c *Resource[T]) Import(w http.ResponseWriter, r *http.Request) {
+	dryRun := false
+	if value := r.URL.Query().Get("dry_run"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			respondError(w, r, handlers.BadRequest("dry_run must be true or false"))
+			return
+		}
+		dryRun = parsed
+	}
+
+	report := r.URL.Query().Get("report")
+	if report != "" && report != "csv" {
+		respondError(w, r, handlers.BadRequest(fmt.Sprintf("Invalid report '%s', use csv", report)))
+		return
+	}
+
+	// Large files take longer than SERVER_READ_TIMEOUT and SERVER_WRITE_TIMEOUT,
+	// so the connection gets the deadline of the route instead, with a minute
+	// to write the response, or no deadline for routes without one
+	deadline, hasDeadline := r.Context().Deadline()
+	controller := http.NewResponseController(w)
+	controller.SetReadDeadline(deadline)
+	if hasDeadline {
+		deadline = deadline.Add(time.Minute)
+	}
+	controller.SetWriteDeadline(deadline)
+
+	file, err := importFile(r)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		respondError(w, r, handlers.BadRequest("The file is empty"))
+		return
+	}
+	if err != nil {
+		respondError(w, r, handlers.ReadError(err, fmt.Sprintf("Invalid CSV file: %v", err)))
+		return
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+	// Spreadsheet applications start UTF-8 CSV files with a byte order mark
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+
+	mapping, err := tabular.MapColumns(header, render.FieldNames(c.config.Input.Body()), importColumns(r.URL.Query()))
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	var records [][]string
+	var lines []int
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			respondError(w, r, handlers.ReadError(err, fmt.Sprintf("Invalid CSV file: %v", err)))
+			return
+		}
+		if len(records) == c.config.MaxImportRows {
+			respondError(w, r, handlers.NewError(http.StatusRequestEntityTooLarge, handlers.CodePayloadTooLarge,
+				fmt.Sprintf("At most %d rows can be imported at once", c.config.MaxImportRows)))
+			return
+		}
+		line, _ := reader.FieldPos(0)
+		records = append(records, record)
+		lines = append(lines, line)
+	}
+	if len(records) == 0 {
+		respondError(w, r, handlers.BadRequest("The file has no rows"))
+		return
+	}
+
+	// Validate every row, then create the valid ones
+	models := make([]T, len(records))
+	results := make([]BulkResult, len(records))
+	var pending []int
+	for i, record := range records {
+		fields, values := mapping.Record(record)
+		if err := c.applyRow(r, fields, values, &models[i]); err != nil {
+			results[i] = bulkFailure(i, 0, err)
+			continue
+		}
+		results[i].Index = i
+		pending = append(pending, i)
+	}
+
+	db, err := getDB()
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	if dryRun {
+		// Insert in a transaction that is rolled back, so database
+		// constraints are checked as well
+		db.Transaction(func(tx *gorm.DB) error {
+			c.createBestEffort(r, tx, models, pending, results)
+			return errDryRun
+		})
+	} else {
+		c.createBestEffort(r, db, models, pending, results)
+	}
+
+	summary := ImportSummary{DryRun: dryRun, Total: len(records), Columns: mapping.Columns(header), Ignored: mapping.Ignored}
+	failures := []ImportFailure{}
+	var failed [][]string
+	for i, result := range results {
+		if result.Status < http.StatusBadRequest {
+			summary.Imported++
+			continue
+		}
+		summary.Failed++
+		failures = append(failures, ImportFailure{Row: lines[i], Status: result.Status, Message: result.Message, Errors: result.Errors})
+		failed = append(failed, records[i])
+	}
+
+	status, responseStatus := http.StatusCreated, "success"
+	if dryRun {
+		status = http.StatusOK
+	}
+	switch {
+	case summary.Failed > 0 && summary.Imported == 0:
+		status, responseStatus = http.StatusUnprocessableEntity, "error"
+	case summary.Failed > 0:
+		status, responseStatus = http.StatusMultiStatus, "partial"
+	}
+
+	if report == "csv" {
+		c.writeImportReport(w, status, header, failed, failures)
+		return
+	}
+
+	respond(w, r, status, Response{
+		Status:  responseStatus,
+		Message: c.importMessage(summary),
+		Data:    failures,
+		Meta:    summary,
+	})
+}
+
+// applyRow applies the mapped cells of a row to the model through the Input of
+// the resource, as if they were the one-row CSV body of a store request
+func (c *Resource[T]) applyRow(r *http.Request, fields, values []string, model *T) error {
+	var body bytes.Buffer
+	writer := csv.NewWriter(&body)
+	writer.Write(fields)
+	writer.Write(values)
+	writer.Flush()
+
+	row := r.Clone(r.Context())
+	row.Body = io.NopCloser(&body)
+	row.ContentLength = int64(body.Len())
+	row.Header.Set("Content-Type", "text/csv")
+	if err := c.config.Input.Apply(row, model); err != nil {
+		return err
+	}
+	restoreProtected(model, new(T))
+	return nil
+}
+
+// importMessage describes the outcome of an import
+func (c *Resource[T]) importMessage(summary ImportSummary) string {
+	plural := c.name() + "s"
+	done := "imported"
+	if summary.DryRun {
+		done = "would be imported"
+	}
+
+	switch {
+	case summary.Failed == 0:
+		return fmt.Sprintf("%d %s %s", summary.Imported, plural, done)
+	case summary.Imported == 0:
+		return fmt.Sprintf("No %s %s, see the errors of each row", plural, done)
+	default:
+		return fmt.Sprintf("%d of %d %s %s, see the errors of the other rows", summary.Imported, summary.Total, plural, done)
+	}
+}
+
+// writeImportReport writes the failed rows of an import as a CSV file: their line
+// number, original cells and errors
+func (c *Resource[T]) writeImportReport(w http.ResponseWriter, status int, header []string, failed [][]string, failures []ImportFailure) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%ss-import-errors.csv"`, c.name()))
+	w.WriteHeader(status)
+
+	writer := tabular.NewCSVWriter(w)
+	writer.Write(append(append([]string{"row"}, header...), "errors"))
+	for i, record := range failed {
+		cells := make([]string, len(header))
+		copy(cells, record)
+		writer.Write(append(append([]string{strconv.Itoa(failures[i].Row)}, cells...), importErrors(failures[i])))
+	}
+	writer.Close()
+}
+
+// importErrors formats the errors of a failed row as one cell
+func importErrors(failure ImportFailure) string {
+	if len(failure.Errors) == 0 {
+		return failure.Message
+	}
+
+	fields := make([]string, 0, len(failure.Errors))
+	for field := range failure.Errors {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	messages := make([]string, len(fields))
+	for i, field := range fields {
+		messages[i] = failure.Errors[field]
+	}
+	return strings.Join(messages, "; ")
+}
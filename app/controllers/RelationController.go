@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"went-framework/internal/handlers"
+	"went-framework/internal/query"
+
+	"gorm.io/gorm"
+)
+
+// NestedIndex returns a handler listing the records related to the parent in {id},
+// e.g. GET /api/users/{id}/posts. relation is the JSON name of the relation on P.
+// The related records support the same filter, sort, include and pagination parameters as C's list.
+func NestedIndex[P any, C any](relation string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var parent P
+		var child C
+		parentName := reflect.TypeOf(parent).Name()
+
+		id, err := parseID(r)
+		if err != nil {
+			respondError(w, r, handlers.BadRequest(fmt.Sprintf("Invalid %s ID", strings.ToLower(parentName))))
+			return
+		}
+
+		// Parse filter, sort and pagination parameters of the related model
+		params, err := query.Parse(r.URL.Query(), child)
+		if err != nil {
+			respondError(w, r, handlers.BadRequest(err.Error()))
+			return
+		}
+
+		db, err := getDB()
+		if err != nil {
+			respondError(w, r, err)
+			return
+		}
+
+		// Make sure the parent exists
+		if err := db.First(&parent, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				err = handlers.Wrap(err, fmt.Sprintf("%s not found", parentName))
+			}
+			respondError(w, r, err)
+			return
+		}
+
+		scope, err := query.RelationScope(parent, relation, id)
+		if err != nil {
+			respondError(w, r, handlers.Wrap(err, fmt.Sprintf("Failed to retrieve %s", relation)))
+			return
+		}
+
+		listModels[C](w, r, db.Scopes(scope), params, parentName+" "+relation, nil)
+	}
+}
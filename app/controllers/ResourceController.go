@@ -0,0 +1,656 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"went-framework/internal/handlers"
+	"went-framework/internal/httpcache"
+	"went-framework/internal/locking"
+	"went-framework/internal/patch"
+	"went-framework/internal/query"
+	"went-framework/internal/render"
+	"went-framework/internal/validation"
+
+	"gorm.io/gorm"
+)
+
+// Hook runs inside the transaction of a create, update or delete
+type Hook[T any] func(r *http.Request, tx *gorm.DB, model *T) error
+
+// Hooks run around the database operations of a Resource. Returning an error
+// rolls back the transaction and responds with 400 and the error message, or
+// with the status of a handlers.AppError.
+type Hooks[T any] struct {
+	BeforeCreate Hook[T]
+	AfterCreate  Hook[T]
+	BeforeUpdate Hook[T]
+	AfterUpdate  Hook[T]
+	BeforeDelete Hook[T]
+	AfterDelete  Hook[T]
+}
+
+// Input applies a request body to a model
+type Input[T any] interface {
+	Apply(r *http.Request, model *T) error
+	// ApplyAll decodes a list body into one model per item. errs holds the
+	// validation error of each item, err is set if the body cannot be read.
+	ApplyAll(r *http.Request) (models []T, errs []error, err error)
+	// Body returns a value of the request body type, used for documentation
+	Body() interface{}
+}
+
+// ResourceConfig configures a Resource controller
+type ResourceConfig[T any] struct {
+	// Name is the singular name used in messages, defaults to the model type name
+	Name string
+	// Hooks run around create, update and delete
+	Hooks Hooks[T]
+	// Input applies the request body to the model on store and update.
+	// Defaults to decoding the request body straight into the model; see BindDTO.
+	Input Input[T]
+	// UpdateInput overrides Input on update, e.g. to make fields optional
+	UpdateInput Input[T]
+	// Output maps a model to its response representation, defaults to the model itself
+	Output func(model *T) interface{}
+	// MaxBulkItems limits the items of one bulk request, defaults to DefaultMaxBulkItems
+	MaxBulkItems int
+	// BulkBatchSize is the number of rows per bulk INSERT, defaults to DefaultBulkBatchSize
+	BulkBatchSize int
+	// MaxImportRows limits the rows of one imported file, defaults to DefaultMaxImportRows
+	MaxImportRows int
+}
+
+// Resource is a generic controller providing index, show, store, update and
+// destroy over a GORM model using the standard Response envelope
+type Resource[T any] struct {
+	config ResourceConfig[T]
+}
+
+// hookError marks errors returned by hooks so they are reported as bad requests
+type hookError struct {
+	err error
+}
+
+func (e *hookError) Error() string {
+	return e.err.Error()
+}
+
+func (e *hookError) Unwrap() error {
+	return e.err
+}
+
+// NewResource creates a resource controller for the model T
+func NewResource[T any](config ResourceConfig[T]) *Resource[T] {
+	if config.Name == "" {
+		var model T
+		config.Name = reflect.TypeOf(model).Name()
+	}
+	if config.Input == nil {
+		config.Input = modelInput[T]{}
+	}
+	if config.UpdateInput == nil {
+		config.UpdateInput = config.Input
+	}
+	if config.MaxBulkItems <= 0 {
+		config.MaxBulkItems = DefaultMaxBulkItems
+	}
+	if config.BulkBatchSize <= 0 {
+		config.BulkBatchSize = DefaultBulkBatchSize
+	}
+	if config.MaxImportRows <= 0 {
+		config.MaxImportRows = DefaultMaxImportRows
+	}
+
+	return &Resource[T]{config: config}
+}
+
+// modelInput decodes the request body straight into the model
+type modelInput[T any] struct{}
+
+func (modelInput[T]) Apply(r *http.Request, model *T) error {
+	if err := render.Decode(r, model); err != nil {
+		return err
+	}
+	return validation.Validate(r.Context(), model)
+}
+
+func (modelInput[T]) ApplyAll(r *http.Request) ([]T, []error, error) {
+	var models []T
+	if err := render.Decode(r, &models); err != nil {
+		return nil, nil, err
+	}
+
+	errs := make([]error, len(models))
+	for i := range models {
+		errs[i] = validation.Validate(r.Context(), &models[i])
+	}
+	return models, errs, nil
+}
+
+func (modelInput[T]) Body() interface{} {
+	var model T
+	return model
+}
+
+// protectedFields are the fields a request body never sets, besides the
+// primary key: they are managed by GORM and optimistic locking
+var protectedFields = map[string]bool{"CreatedAt": true, "UpdatedAt": true, "DeletedAt": true, "Version": true}
+
+// restoreProtected copies the primary key and protected fields of stored into
+// model, undoing what an input decoded into them. Creates pass a zero model, so
+// the database assigns them.
+func restoreProtected[T any](model, stored *T) {
+	restoreFields(reflect.ValueOf(model).Elem(), reflect.ValueOf(stored).Elem())
+}
+
+// restoreFields copies the primary key and protected fields of a struct,
+// including those of embedded structs such as gorm.Model
+func restoreFields(model, stored reflect.Value) {
+	if model.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < model.NumField(); i++ {
+		field := model.Type().Field(i)
+		switch {
+		case !field.IsExported():
+		case field.Anonymous && field.Type.Kind() == reflect.Struct:
+			restoreFields(model.Field(i), stored.Field(i))
+		case field.Name == "ID" || protectedFields[field.Name] || strings.Contains(field.Tag.Get("gorm"), "primaryKey"):
+			model.Field(i).Set(stored.Field(i))
+		}
+	}
+}
+
+// dtoInput decodes the request body into a D, validates it and applies it to the model
+type dtoInput[T any, D any] struct {
+	apply func(dto *D, model *T) error
+}
+
+func (i dtoInput[T, D]) Apply(r *http.Request, model *T) error {
+	var dto D
+	if err := render.Decode(r, &dto); err != nil {
+		return err
+	}
+	if err := validation.Validate(r.Context(), &dto); err != nil {
+		return err
+	}
+	return i.apply(&dto, model)
+}
+
+func (i dtoInput[T, D]) ApplyAll(r *http.Request) ([]T, []error, error) {
+	var dtos []D
+	if err := render.Decode(r, &dtos); err != nil {
+		return nil, nil, err
+	}
+
+	models := make([]T, len(dtos))
+	errs := make([]error, len(dtos))
+	for n := range dtos {
+		if errs[n] = validation.Validate(r.Context(), &dtos[n]); errs[n] == nil {
+			errs[n] = i.apply(&dtos[n], &models[n])
+		}
+	}
+	return models, errs, nil
+}
+
+func (i dtoInput[T, D]) Body() interface{} {
+	var dto D
+	return dto
+}
+
+// BindDTO returns an Input that decodes the request body into a D, validates its
+// validate tags and applies it to the model, so clients can only write the
+// fields the DTO exposes
+func BindDTO[T any, D any](apply func(dto *D, model *T) error) Input[T] {
+	return dtoInput[T, D]{apply: apply}
+}
+
+// Model returns the zero value of the resource model
+func (c *Resource[T]) Model() interface{} {
+	var model T
+	return model
+}
+
+// RequestBody returns a value of the request body type of the store, update or
+// bulk_store action, or nil for other actions
+func (c *Resource[T]) RequestBody(action string) interface{} {
+	switch action {
+	case "store":
+		return c.config.Input.Body()
+	case "update":
+		return c.config.UpdateInput.Body()
+	case "bulk_store":
+		body := c.config.Input.Body()
+		return reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(body)), 0, 0).Interface()
+	default:
+		return nil
+	}
+}
+
+// name returns the lowercase singular name used in messages
+func (c *Resource[T]) name() string {
+	return strings.ToLower(c.config.Name)
+}
+
+// runHook runs a hook if it is set
+func (c *Resource[T]) runHook(hook Hook[T], r *http.Request, tx *gorm.DB, model *T) error {
+	if hook == nil {
+		return nil
+	}
+	if err := hook(r, tx, model); err != nil {
+		return &hookError{err: err}
+	}
+	return nil
+}
+
+// runHookSavepoint runs a hook in a savepoint of tx, so the writes of a
+// failing hook are undone without rolling back tx
+func (c *Resource[T]) runHookSavepoint(hook Hook[T], r *http.Request, tx *gorm.DB, model *T) error {
+	if hook == nil {
+		return nil
+	}
+	return tx.Transaction(func(savepoint *gorm.DB) error {
+		return c.runHook(hook, r, savepoint, model)
+	})
+}
+
+// output maps the model to its response representation
+func (c *Resource[T]) output(model *T) interface{} {
+	if c.config.Output == nil {
+		return model
+	}
+	return c.config.Output(model)
+}
+
+// find loads the model addressed by {id}, writing the error response on failure
+func (c *Resource[T]) find(w http.ResponseWriter, r *http.Request, db *gorm.DB) (*T, bool) {
+	id, err := parseID(r)
+	if err != nil {
+		respondError(w, r, handlers.BadRequest(fmt.Sprintf("Invalid %s ID", c.name())))
+		return nil, false
+	}
+
+	var model T
+	if err := db.First(&model, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = handlers.Wrap(err, fmt.Sprintf("%s not found", c.config.Name))
+		}
+		respondError(w, r, err)
+		return nil, false
+	}
+
+	return &model, true
+}
+
+// writeError maps the error of a failed create, update or delete to the error reported to the client
+func (c *Resource[T]) writeError(action string, err error) error {
+	var hookErr *hookError
+	var appErr *handlers.AppError
+	switch {
+	case errors.Is(err, locking.ErrConflict):
+		return handlers.Wrap(err, fmt.Sprintf("%s has been modified, reload it and retry", c.config.Name))
+	case errors.As(err, &hookErr) && !errors.As(err, &appErr):
+		return handlers.BadRequest(hookErr.Error())
+	case handlers.FromError(err).Status == http.StatusInternalServerError:
+		return handlers.Wrap(err, fmt.Sprintf("Failed to %s %s", action, c.name()))
+	default:
+		return err
+	}
+}
+
+// respondWriteError reports a failed create, update or delete
+func (c *Resource[T]) respondWriteError(w http.ResponseWriter, r *http.Request, action string, err error) {
+	respondError(w, r, c.writeError(action, err))
+}
+
+// Index handles GET /{resource}
+func (c *Resource[T]) Index(w http.ResponseWriter, r *http.Request) {
+	var model T
+
+	// Parse filter, sort and pagination parameters
+	params, err := query.Parse(r.URL.Query(), model)
+	if err != nil {
+		respondError(w, r, handlers.BadRequest(err.Error()))
+		return
+	}
+
+	db, err := getDB()
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	listModels(w, r, db, params, c.config.Name+"s", c.config.Output)
+}
+
+// Show handles GET /{resource}/{id}
+func (c *Resource[T]) Show(w http.ResponseWriter, r *http.Request) {
+	var zero T
+
+	// Parse the relations to eager load and the fields to return
+	includes, err := query.ParseIncludes(r.URL.Query(), zero)
+	if err != nil {
+		respondError(w, r, handlers.BadRequest(err.Error()))
+		return
+	}
+	fields, err := query.ParseFields(r.URL.Query(), zero)
+	if err != nil {
+		respondError(w, r, handlers.BadRequest(err.Error()))
+		return
+	}
+
+	db, err := getDB()
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	model, ok := c.find(w, r, db.Scopes(fields.SelectScope, fields.PreloadScope(includes)))
+	if !ok {
+		return
+	}
+
+	// Conditional GETs are answered with 304 by the cache middleware, from an
+	// ETag hashed from the rendered body: the same version is rendered
+	// differently per format, fieldset, included relations and API version.
+	// UpdatedAt says nothing of included relations, so it is only sent without.
+	if len(includes) == 0 {
+		modified, _ := httpcache.LastModified(model)
+		httpcache.SetValidators(w, "", modified)
+	}
+
+	data, err := fields.Shape(c.output(model))
+	if err != nil {
+		respondError(w, r, handlers.Wrap(err, fmt.Sprintf("Failed to retrieve %s", c.name())))
+		return
+	}
+
+	respond(w, r, http.StatusOK, Response{
+		Status:  "success",
+		Message: fmt.Sprintf("%s retrieved successfully", c.config.Name),
+		Data:    data,
+	})
+}
+
+// Store handles POST /{resource}
+func (c *Resource[T]) Store(w http.ResponseWriter, r *http.Request) {
+	// Connect before validating, the unique and exists rules query the database
+	db, err := getDB()
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	var model T
+	if err := c.config.Input.Apply(r, &model); err != nil {
+		respondError(w, r, err)
+		return
+	}
+	restoreProtected(&model, new(T))
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := c.runHook(c.config.Hooks.BeforeCreate, r, tx, &model); err != nil {
+			return err
+		}
+		if err := tx.Create(&model).Error; err != nil {
+			return err
+		}
+		return c.runHook(c.config.Hooks.AfterCreate, r, tx, &model)
+	})
+	if err != nil {
+		c.respondWriteError(w, r, "create", err)
+		return
+	}
+
+	respond(w, r, http.StatusCreated, Response{
+		Status:  "success",
+		Message: fmt.Sprintf("%s created successfully", c.config.Name),
+		Data:    c.output(&model),
+	})
+}
+
+// Update handles PUT /{resource}/{id}
+func (c *Resource[T]) Update(w http.ResponseWriter, r *http.Request) {
+	db, err := getDB()
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	model, ok := c.findCurrent(w, r, db)
+	if !ok {
+		return
+	}
+
+	versioned, isVersioned := any(model).(locking.Versioned)
+	var version uint
+	if isVersioned {
+		version = versioned.GetVersion()
+	}
+	stored := *model
+
+	// Unique rules must not conflict with the record being updated
+	id, _ := parseID(r)
+	if err := c.config.UpdateInput.Apply(r.WithContext(validation.IgnoreID(r.Context(), id)), model); err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	// A version sent in the body must match the stored one
+	if isVersioned && versioned.GetVersion() != version {
+		respondError(w, r, handlers.Wrap(locking.ErrConflict, fmt.Sprintf("%s has been modified, reload it and retry", c.config.Name)))
+		return
+	}
+
+	// The body cannot move the update to another row or rewrite its history
+	restoreProtected(model, &stored)
+
+	c.save(w, r, db, model)
+}
+
+// Patch handles PATCH /{resource}/{id} with an application/merge-patch+json or
+// application/json-patch+json body. Only the model's patchable fields can change.
+func (c *Resource[T]) Patch(w http.ResponseWriter, r *http.Request) {
+	db, err := getDB()
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	model, ok := c.findCurrent(w, r, db)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondError(w, r, handlers.ReadError(err, "Failed to read request body"))
+		return
+	}
+
+	if err := patch.Apply(model, r.Header.Get("Content-Type"), body); err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	// Validate the patched model, without conflicting with itself on unique rules
+	id, _ := parseID(r)
+	if err := validation.Validate(validation.IgnoreID(r.Context(), id), model); err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	c.save(w, r, db, model)
+}
+
+// findCurrent loads the model addressed by {id} and checks that the client's
+// If-Match, if any, matches its current version
+func (c *Resource[T]) findCurrent(w http.ResponseWriter, r *http.Request, db *gorm.DB) (*T, bool) {
+	model, ok := c.find(w, r, db)
+	if !ok {
+		return nil, false
+	}
+
+	// Reject the write if the client's copy is stale
+	if versioned, isVersioned := any(model).(locking.Versioned); isVersioned {
+		if err := locking.CheckIfMatch(r, versioned); err != nil {
+			respondError(w, r, handlers.Wrap(err, fmt.Sprintf("%s has been modified, reload it and retry", c.config.Name)))
+			return nil, false
+		}
+	}
+
+	return model, true
+}
+
+// save stores the updated model with the update hooks and writes the response
+func (c *Resource[T]) save(w http.ResponseWriter, r *http.Request, db *gorm.DB, model *T) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return c.update(r, tx, model)
+	})
+	if err != nil {
+		c.respondWriteError(w, r, "update", err)
+		return
+	}
+
+	if versioned, isVersioned := any(model).(locking.Versioned); isVersioned {
+		w.Header().Set("ETag", locking.ETag(versioned))
+	}
+
+	respond(w, r, http.StatusOK, Response{
+		Status:  "success",
+		Message: fmt.Sprintf("%s updated successfully", c.config.Name),
+		Data:    c.output(model),
+	})
+}
+
+// Destroy handles DELETE /{resource}/{id}
+func (c *Resource[T]) Destroy(w http.ResponseWriter, r *http.Request) {
+	db, err := getDB()
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	model, ok := c.findCurrent(w, r, db)
+	if !ok {
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return c.delete(r, tx, model)
+	})
+	if err != nil {
+		c.respondWriteError(w, r, "delete", err)
+		return
+	}
+
+	id, _ := parseID(r)
+	respond(w, r, http.StatusOK, Response{
+		Status:  "success",
+		Message: fmt.Sprintf("%s %d deleted successfully", c.config.Name, id),
+	})
+}
+
+// update saves the model with the update hooks, checking its version if it is versioned
+func (c *Resource[T]) update(r *http.Request, tx *gorm.DB, model *T) error {
+	if err := c.runHook(c.config.Hooks.BeforeUpdate, r, tx, model); err != nil {
+		return err
+	}
+
+	var err error
+	if versioned, isVersioned := any(model).(locking.Versioned); isVersioned {
+		err = locking.Save(tx, versioned)
+	} else {
+		err = tx.Save(model).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.runHook(c.config.Hooks.AfterUpdate, r, tx, model)
+}
+
+// delete deletes the model with the delete hooks, checking its version if it is versioned
+func (c *Resource[T]) delete(r *http.Request, tx *gorm.DB, model *T) error {
+	if err := c.runHook(c.config.Hooks.BeforeDelete, r, tx, model); err != nil {
+		return err
+	}
+
+	var err error
+	if versioned, isVersioned := any(model).(locking.Versioned); isVersioned {
+		err = locking.Delete(tx, versioned)
+	} else {
+		err = tx.Delete(model).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.runHook(c.config.Hooks.AfterDelete, r, tx, model)
+}
+
+// listModels loads the page of T selected by params from db and writes it in the
+// response envelope. name is the plural used in messages, output maps each item.
+func listModels[T any](w http.ResponseWriter, r *http.Request, db *gorm.DB, params *query.Params, name string, output func(*T) interface{}) {
+	var items []T
+	var meta interface{}
+	var err error
+
+	if params.Keyset != nil {
+		var page *query.CursorPage
+		page, err = params.CursorPaginate(db, &items)
+		if err == nil {
+			if link := query.LinkHeader(r.URL, page); link != "" {
+				w.Header().Set("Link", link)
+			}
+			meta = page
+		}
+	} else {
+		meta, err = params.Paginate(db, &items)
+	}
+
+	if err != nil {
+		respondError(w, r, handlers.Wrap(err, fmt.Sprintf("Failed to retrieve %s", strings.ToLower(name))))
+		return
+	}
+
+	var data interface{} = items
+	if output != nil || params.Fields != nil {
+		mapped := make([]interface{}, len(items))
+		for i := range items {
+			var item interface{} = &items[i]
+			if output != nil {
+				item = output(&items[i])
+			}
+			if mapped[i], err = params.Fields.Shape(item); err != nil {
+				respondError(w, r, handlers.Wrap(err, fmt.Sprintf("Failed to retrieve %s", strings.ToLower(name))))
+				return
+			}
+		}
+		data = mapped
+	}
+
+	// Wrap search results with their rank and highlighted snippets
+	if params.Searching() {
+		hits, err := params.SearchHits(db, items)
+		if err != nil {
+			respondError(w, r, handlers.Wrap(err, fmt.Sprintf("Failed to retrieve %s", strings.ToLower(name))))
+			return
+		}
+		if mapped, ok := data.([]interface{}); ok {
+			for i := range hits {
+				hits[i].Item = mapped[i]
+			}
+		}
+		data = hits
+	}
+
+	respond(w, r, http.StatusOK, Response{
+		Status:  "success",
+		Message: fmt.Sprintf("%s retrieved successfully", name),
+		Data:    data,
+		Meta:    meta,
+	})
+}
@@ -1,9 +1,11 @@
 package database
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"sync"
 	"time"
 
 	"gorm.io/driver/postgres"
@@ -13,7 +15,22 @@ import (
 
 var DB *gorm.DB
 
+// ErrUnavailable is returned by Get when the database cannot be reached
+var ErrUnavailable = errors.New("database is unavailable")
+
+// connectMu serializes the connection attempts of Get
+var connectMu sync.Mutex
+
+// Connect connects to the database and exits when it cannot, for commands
 func Connect() {
+	if err := Open(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Open connects to the database and sets DB, returning the error instead of
+// exiting, for use while serving requests
+func Open() error {
 	// Get database configuration from environment variables
 	host := getEnv("DB_HOST", "localhost")
 	port := getEnv("DB_PORT", "5432")
@@ -37,13 +54,29 @@ func Connect() {
 	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s",
 		host, user, password, dbname, port, sslmode)
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: dblogger})
+	// TranslateError maps constraint violations to gorm.ErrDuplicatedKey and gorm.ErrForeignKeyViolated
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: dblogger, TranslateError: true})
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		return fmt.Errorf("failed to connect to database: %w", err)
 	}
 
 	log.Printf("Connected to database: %s@%s:%s/%s", user, host, port, dbname)
 	DB = db
+	return nil
+}
+
+// Get returns DB, connecting on first use. Concurrent callers wait for the same
+// attempt, and a failed attempt is retried by the next call.
+func Get() (*gorm.DB, error) {
+	connectMu.Lock()
+	defer connectMu.Unlock()
+	if DB != nil {
+		return DB, nil
+	}
+	if err := Open(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	return DB, nil
 }
 
 // getEnv gets environment variable with fallback
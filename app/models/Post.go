@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Post struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	Title     string    `json:"title" gorm:"not null"`
+	Body      string    `json:"body" gorm:"type:text"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Belongs to
+	User *User `json:"user,omitempty"`
+}
+
+// TableName specifies the table name for GORM
+func (Post) TableName() string {
+	return "posts"
+}
+
+// FilterableFields lists the fields that can be used with ?filter[field]=value
+func (Post) FilterableFields() []string {
+	return []string{"id", "user_id", "title", "created_at", "updated_at"}
+}
+
+// SortableFields lists the fields that can be used with ?sort=field
+func (Post) SortableFields() []string {
+	return []string{"id", "title", "created_at", "updated_at"}
+}
+
+// IncludableRelations lists the relations that can be loaded with ?include=
+func (Post) IncludableRelations() []string {
+	return []string{"user"}
+}
+
+// SelectableFields lists the fields that can be requested with ?fields=
+func (Post) SelectableFields() []string {
+	return []string{"id", "user_id", "title", "body", "created_at", "updated_at"}
+}
+
+// Create creates a new post
+func (p *Post) Create(db *gorm.DB) error {
+	return db.Create(p).Error
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Profile struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"not null;uniqueIndex"`
+	Bio       string    `json:"bio" gorm:"type:text"`
+	AvatarURL string    `json:"avatar_url"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName specifies the table name for GORM
+func (Profile) TableName() string {
+	return "profiles"
+}
+
+// SelectableFields lists the fields that can be requested with ?fields=
+func (Profile) SelectableFields() []string {
+	return []string{"id", "user_id", "bio", "avatar_url", "created_at", "updated_at"}
+}
+
+// Create creates a new profile
+func (p *Profile) Create(db *gorm.DB) error {
+	return db.Create(p).Error
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Role struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"unique;not null"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName specifies the table name for GORM
+func (Role) TableName() string {
+	return "roles"
+}
+
+// FilterableFields lists the fields that can be used with ?filter[field]=value
+func (Role) FilterableFields() []string {
+	return []string{"id", "name"}
+}
+
+// SortableFields lists the fields that can be used with ?sort=field
+func (Role) SortableFields() []string {
+	return []string{"id", "name", "created_at"}
+}
+
+// SelectableFields lists the fields that can be requested with ?fields=
+func (Role) SelectableFields() []string {
+	return []string{"id", "name", "created_at", "updated_at"}
+}
+
+// Create creates a new role
+func (r *Role) Create(db *gorm.DB) error {
+	return db.Create(r).Error
+}
@@ -2,16 +2,25 @@ package models
 
 import (
 	"time"
+	"went-framework/internal/locking"
 
 	"gorm.io/gorm"
 )
 
 type User struct {
 	ID        uint      `json:"id" gorm:"primaryKey"`
-	Name      string    `json:"name" gorm:"not null"`
-	Email     string    `json:"email" gorm:"unique;not null"`
+	Name      string    `json:"name" gorm:"not null" validate:"required,max=255"`
+	Email     string    `json:"email" gorm:"unique;not null" validate:"required,email,max=255,unique=users.email"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	locking.Versioning
+
+	// Has one
+	Profile *Profile `json:"profile,omitempty"`
+	// Has many
+	Posts []Post `json:"posts,omitempty"`
+	// Many to many
+	Roles []Role `json:"roles,omitempty" gorm:"many2many:user_roles"`
 }
 
 // TableName specifies the table name for GORM
@@ -19,6 +28,36 @@ func (User) TableName() string {
 	return "users"
 }
 
+// FilterableFields lists the fields that can be used with ?filter[field]=value
+func (User) FilterableFields() []string {
+	return []string{"id", "name", "email", "created_at", "updated_at"}
+}
+
+// SortableFields lists the fields that can be used with ?sort=field
+func (User) SortableFields() []string {
+	return []string{"id", "name", "email", "created_at", "updated_at"}
+}
+
+// SearchableFields lists the text fields covered by ?q= full-text search
+func (User) SearchableFields() []string {
+	return []string{"name", "email"}
+}
+
+// PatchableFields lists the fields that can be changed with PATCH
+func (User) PatchableFields() []string {
+	return []string{"name", "email"}
+}
+
+// IncludableRelations lists the relations that can be loaded with ?include=
+func (User) IncludableRelations() []string {
+	return []string{"profile", "posts", "roles", "posts.user"}
+}
+
+// SelectableFields lists the fields that can be requested with ?fields=
+func (User) SelectableFields() []string {
+	return []string{"id", "name", "email", "created_at", "updated_at", "version"}
+}
+
 // Create creates a new user
 func (u *User) Create(db *gorm.DB) error {
 	return db.Create(u).Error
@@ -41,12 +80,12 @@ func GetUserByID(db *gorm.DB, id uint) (*User, error) {
 	return &user, nil
 }
 
-// Update updates a user
+// Update updates a user, failing with locking.ErrConflict if it was modified meanwhile
 func (u *User) Update(db *gorm.DB) error {
-	return db.Save(u).Error
+	return locking.Save(db, u)
 }
 
-// Delete deletes a user
+// Delete deletes a user, failing with locking.ErrConflict if it was modified meanwhile
 func (u *User) Delete(db *gorm.DB) error {
-	return db.Delete(u).Error
+	return locking.Delete(db, u)
 }
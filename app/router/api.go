@@ -2,17 +2,62 @@ package router
 
 import (
 	"went-framework/app/controllers"
+	"went-framework/app/models"
+	"went-framework/internal/swagger"
+	"went-framework/internal/versioning"
 
 	"github.com/gorilla/mux"
 )
 
+// APIVersions lists the versions of the API, each mounted under /api/{name}.
+// Unversioned requests such as /api/users are served by the version asked for
+// with Accept-Version or the version parameter of Accept, and by Default
+// otherwise. To retire a version, set Deprecated and later Sunset: its responses
+// then carry the Deprecation and Sunset headers.
+var APIVersions = &versioning.Set{
+	Base:    "/api",
+	Default: "v1",
+	Versions: []versioning.Version{
+		{Name: "v1", Routes: setupV1Routes},
+		{Name: "v2", Routes: setupV2Routes},
+	},
+}
+
+// setupV1Routes configures the routes of /api/v1
+func setupV1Routes(api *mux.Router) {
+	setupUserRoutes(api)
+
+	// Placeholder for other route groups
+	setupOtherRoutes(api)
+}
+
+// setupV2Routes configures the routes of /api/v2, which serves the v1 routes
+// until breaking changes are made here
+func setupV2Routes(api *mux.Router) {
+	setupUserRoutes(api)
+	setupOtherRoutes(api)
+}
+
+func setupOtherRoutes(api *mux.Router) {
+	// Placeholder for other routes
+	// Add more route groups as needed
+}
+
 func setupUserRoutes(api *mux.Router) {
 
 	// User routes
-	api.HandleFunc("/users", controllers.GetAllUsers).Methods("GET")
-	api.HandleFunc("/users/{id}", controllers.GetUser).Methods("GET")
-	api.HandleFunc("/users", controllers.CreateUser).Methods("POST")
-	api.HandleFunc("/users/{id}", controllers.UpdateUser).Methods("PUT")
-	api.HandleFunc("/users/{id}", controllers.DeleteUser).Methods("DELETE")
+	Resource(api, "users", controllers.Users)
+
+	// Nested relation routes
+	posts := api.HandleFunc("/users/{id}/posts", controllers.NestedIndex[models.User, models.Post]("posts")).Methods("GET")
+	roles := api.HandleFunc("/users/{id}/roles", controllers.NestedIndex[models.User, models.Role]("roles")).Methods("GET")
+
+	// Document the filter, sort and pagination parameters of the nested lists
+	if path, err := posts.GetPathTemplate(); err == nil {
+		swagger.RegisterModel(path, models.Post{})
+	}
+	if path, err := roles.GetPathTemplate(); err == nil {
+		swagger.RegisterModel(path, models.Role{})
+	}
 
 }
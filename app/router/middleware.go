@@ -0,0 +1,120 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+	"went-framework/internal/idempotency"
+	"went-framework/internal/middleware"
+)
+
+// Middleware is the registry of named middleware, attached to route groups
+// with Middleware.Group(subrouter, "throttle:60,1m") and to single routes with
+// Middleware.Route(route, "throttle:10,1m"). Register the middleware of the
+// application here, e.g. Register("auth", middleware.Static(auth)) or a factory
+// reading parameters such as role:admin: the framework has no authentication,
+// so auth and role are not registered until the application provides them.
+// go run main.go route:list shows the stack of each route.
+var Middleware = middleware.NewRegistry().
+	Register("request_id", lazy(func() func(http.Handler) http.Handler {
+		return middleware.RequestID(middleware.RequestIDConfig{
+			// Keep the X-Request-ID of a trusted load balancer or upstream service
+			TrustIncoming: os.Getenv("REQUEST_ID_TRUST_INCOMING") == "true",
+		})
+	})).
+	// security applies the API policy, security:swagger the looser policy of
+	// the Swagger UI, whose page runs inline scripts and styles
+	Register("security", func(params []string) (func(http.Handler) http.Handler, error) {
+		switch {
+		case len(params) == 0:
+			return middleware.SecurityHeaders(middleware.SecurityConfigFromEnv()), nil
+		case len(params) == 1 && params[0] == "swagger":
+			return middleware.SecurityHeaders(middleware.SwaggerSecurityConfigFromEnv()), nil
+		default:
+			return nil, fmt.Errorf("use security or security:swagger")
+		}
+	}).
+	// CORS policy from the environment, with the route groups of routeCORS
+	Register("cors", lazy(func() func(http.Handler) http.Handler {
+		return routeCORS().Middleware
+	})).
+	Register("body_limit", lazy(func() func(http.Handler) http.Handler {
+		return routeLimits().BodyLimit
+	})).
+	Register("compress", lazy(func() func(http.Handler) http.Handler {
+		return middleware.Compression(middleware.CompressionConfigFromEnv())
+	})).
+	Register("log", lazy(func() func(http.Handler) http.Handler {
+		return middleware.Logging(middleware.LoggingConfigFromEnv())
+	})).
+	Register("recover", lazy(func() func(http.Handler) http.Handler {
+		return middleware.Recovery(middleware.RecoveryConfig{
+			// Panic messages may leak internals, they are only shown in development
+			ShowDetails: os.Getenv("APP_ENV") == "development",
+		})
+	})).
+	Register("cache", lazy(func() func(http.Handler) http.Handler {
+		return routeCache().Middleware
+	})).
+	// Idempotency keys belong to the clients of rate limiting, see clientKey
+	Register("idempotency", func(params []string) (func(http.Handler) http.Handler, error) {
+		if len(params) > 0 {
+			return nil, fmt.Errorf("takes no parameters")
+		}
+		client, err := clientKey()
+		if err != nil {
+			return nil, err
+		}
+		return idempotency.Middleware(idempotency.Config{
+			TTL:    getDurationEnv("IDEMPOTENCY_TTL", idempotency.DefaultTTL),
+			Client: client,
+		}), nil
+	}).
+	Register("deadline", lazy(func() func(http.Handler) http.Handler {
+		return routeLimits().Deadline
+	})).
+	Register("throttle", throttle)
+
+// lazy returns the factory of a middleware without parameters that reads its
+// configuration when attached, after the environment is loaded
+func lazy(build func() func(http.Handler) http.Handler) middleware.Factory {
+	return func(params []string) (func(http.Handler) http.Handler, error) {
+		return middleware.Static(build())(params)
+	}
+}
+
+// routeLimits returns the body size limit and handler deadline from the
+// environment, with the overrides of the routes that need more
+func routeLimits() *middleware.RouteLimits {
+	return middleware.NewRouteLimits(middleware.LimitsFromEnv()).
+		Route("POST /api/*/*/import", middleware.Limits{MaxBodySize: 20 << 20, Timeout: 5 * time.Minute}).
+		// Exports are streamed for as long as the table takes
+		Route("GET /api/*/*/export", middleware.Limits{Timeout: -1})
+}
+
+// routeCORS returns the CORS policy from the environment, and the policies of
+// the API versions with their own variables, e.g. CORS_V2_ALLOWED_ORIGINS.
+// Groups are matched against the path a request is served under, so
+// unversioned requests such as /api/users get the policy of their negotiated
+// version. Add other groups with Group("/api/v2/admin", config).
+func routeCORS() *middleware.CORS {
+	config := middleware.CORSConfigFromEnv()
+	cors := middleware.NewCORS(config).Paths(APIVersions.Resolve)
+	for _, version := range APIVersions.Versions {
+		if group, ok := middleware.CORSGroupConfigFromEnv(version.Name, config); ok {
+			cors.Group(APIVersions.Prefix(version), group)
+		}
+	}
+	return cors
+}
+
+// routeCache returns the conditional GETs with ETags, and the Cache-Control
+// policies of routes that differ from revalidating on every use
+func routeCache() *middleware.Cache {
+	return middleware.NewCache(middleware.DefaultCacheConfig()).
+		Route("/swagger.json", "public, max-age=300").
+		Route("/swagger/*", "public, max-age=300").
+		Route("/api/health", "no-store").
+		Route("/api/*/*/export", "no-store")
+}
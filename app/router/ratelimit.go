@@ -0,0 +1,118 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"went-framework/internal/ratelimit"
+)
+
+// rateLimitStore is shared by the rate limits of all route groups
+var (
+	rateLimitStore     ratelimit.Store
+	rateLimitStoreErr  error
+	rateLimitStoreOnce sync.Once
+)
+
+// rateLimitGroups are the default limits of the named rate limit groups
+var rateLimitGroups = map[string]string{
+	"api": "100/1m",
+}
+
+// throttle is the factory of the throttle middleware: throttle:60,1m allows 60
+// requests per minute to each client, shared by the routes with the same
+// limit, and throttle:api applies the limit of a group, see rateLimit
+func throttle(params []string) (func(http.Handler) http.Handler, error) {
+	switch len(params) {
+	case 1:
+		fallback, ok := rateLimitGroups[params[0]]
+		if !ok && os.Getenv("RATE_LIMIT_"+strings.ToUpper(params[0])) == "" {
+			return nil, fmt.Errorf("unknown rate limit group %q, set RATE_LIMIT_%s", params[0], strings.ToUpper(params[0]))
+		}
+		return rateLimit(params[0], fallback)
+	case 2:
+		limit, err := ratelimit.ParseLimit(params[0] + "/" + params[1])
+		if err != nil {
+			return nil, err
+		}
+		return newRateLimit("throttle:"+limit.String(), limit)
+	default:
+		return nil, fmt.Errorf("use throttle:<requests>,<period> or throttle:<group>")
+	}
+}
+
+// rateLimit returns the rate limit middleware of a route group. The limit is
+// read from RATE_LIMIT_<GROUP>, e.g. RATE_LIMIT_API=100/1m, with "off" disabling
+// it. RATE_LIMIT_ALGORITHM (token_bucket or sliding_window), RATE_LIMIT_KEY
+// (ip, forwarded_ip or api_key) and RATE_LIMIT_STORE (memory or postgres)
+// apply to all groups.
+func rateLimit(group, fallback string) (func(http.Handler) http.Handler, error) {
+	value := getEnv("RATE_LIMIT_"+strings.ToUpper(group), fallback)
+	if value == "off" {
+		return func(next http.Handler) http.Handler { return next }, nil
+	}
+
+	limit, err := ratelimit.ParseLimit(value)
+	if err != nil {
+		return nil, fmt.Errorf("RATE_LIMIT_%s: %w", strings.ToUpper(group), err)
+	}
+	return newRateLimit(group, limit)
+}
+
+// newRateLimit returns a rate limit middleware whose counters are scoped by name
+func newRateLimit(name string, limit ratelimit.Limit) (func(http.Handler) http.Handler, error) {
+	algorithm, err := ratelimit.ParseAlgorithm(os.Getenv("RATE_LIMIT_ALGORITHM"))
+	if err != nil {
+		return nil, fmt.Errorf("RATE_LIMIT_ALGORITHM: %w", err)
+	}
+	key, err := clientKey()
+	if err != nil {
+		return nil, err
+	}
+	store, err := sharedRateLimitStore()
+	if err != nil {
+		return nil, err
+	}
+
+	return ratelimit.Middleware(ratelimit.Config{
+		Name:      name,
+		Limit:     limit,
+		Algorithm: algorithm,
+		Store:     store,
+		Key:       key,
+	}), nil
+}
+
+// clientKey returns how rate limits and idempotency keys tell clients apart,
+// according to RATE_LIMIT_KEY. There is no authentication yet, so clients
+// cannot be told apart per user.
+func clientKey() (ratelimit.KeyFunc, error) {
+	switch getEnv("RATE_LIMIT_KEY", "ip") {
+	case "ip":
+		return ratelimit.ByIP, nil
+	case "forwarded_ip":
+		return ratelimit.ByForwardedIP, nil
+	case "api_key":
+		return ratelimit.ByAPIKey("X-API-Key"), nil
+	default:
+		return nil, fmt.Errorf("RATE_LIMIT_KEY must be ip, forwarded_ip or api_key")
+	}
+}
+
+// sharedRateLimitStore returns the store of RATE_LIMIT_STORE shared by all
+// rate limits, created on first use
+func sharedRateLimitStore() (ratelimit.Store, error) {
+	rateLimitStoreOnce.Do(func() {
+		switch getEnv("RATE_LIMIT_STORE", "memory") {
+		case "memory":
+			rateLimitStore = ratelimit.NewMemoryStore()
+		case "postgres":
+			rateLimitStore = ratelimit.NewPostgresStore(nil)
+		default:
+			rateLimitStoreErr = fmt.Errorf("RATE_LIMIT_STORE must be memory or postgres")
+		}
+	})
+	return rateLimitStore, rateLimitStoreErr
+}
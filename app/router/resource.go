@@ -0,0 +1,121 @@
+package router
+
+import (
+	"net/http"
+	"strings"
+	"went-framework/internal/swagger"
+
+	"github.com/gorilla/mux"
+)
+
+// ResourceController is implemented by controllers.Resource
+type ResourceController interface {
+	Index(w http.ResponseWriter, r *http.Request)
+	Show(w http.ResponseWriter, r *http.Request)
+	Store(w http.ResponseWriter, r *http.Request)
+	Update(w http.ResponseWriter, r *http.Request)
+	Patch(w http.ResponseWriter, r *http.Request)
+	Destroy(w http.ResponseWriter, r *http.Request)
+	BulkStore(w http.ResponseWriter, r *http.Request)
+	BulkPatch(w http.ResponseWriter, r *http.Request)
+	BulkDestroy(w http.ResponseWriter, r *http.Request)
+	Export(w http.ResponseWriter, r *http.Request)
+	Import(w http.ResponseWriter, r *http.Request)
+	Model() interface{}
+	RequestBody(action string) interface{}
+}
+
+// resourceOptions holds the actions selected with Only and Except
+type resourceOptions struct {
+	only   map[string]bool
+	except map[string]bool
+}
+
+// ResourceOption configures the routes registered by Resource
+type ResourceOption func(*resourceOptions)
+
+// Only registers just the given actions (index, show, store, update, patch, destroy,
+// bulk_store, bulk_patch, bulk_destroy, export, import)
+func Only(actions ...string) ResourceOption {
+	return func(o *resourceOptions) {
+		o.only = make(map[string]bool)
+		for _, action := range actions {
+			o.only[action] = true
+		}
+	}
+}
+
+// Except registers all actions but the given ones
+func Except(actions ...string) ResourceOption {
+	return func(o *resourceOptions) {
+		for _, action := range actions {
+			o.except[action] = true
+		}
+	}
+}
+
+// Resource registers the index, show, store, update, patch and destroy routes of a resource
+// controller under /{name}, plus the bulk routes under /{name}/bulk and the
+// export and import routes, e.g. Resource(api, "users", controllers.Users, Except("destroy", "bulk_destroy"))
+func Resource(router *mux.Router, name string, controller ResourceController, options ...ResourceOption) {
+	opts := &resourceOptions{except: make(map[string]bool)}
+	for _, option := range options {
+		option(opts)
+	}
+
+	collection := "/" + strings.Trim(name, "/")
+	member := collection + "/{id}"
+	bulk := collection + "/bulk"
+
+	routes := []struct {
+		action  string
+		method  string
+		path    string
+		handler http.HandlerFunc
+	}{
+		{"index", "GET", collection, controller.Index},
+		// Collection routes come before the member routes, which would match "bulk" as {id}
+		{"bulk_store", "POST", bulk, controller.BulkStore},
+		{"bulk_patch", "PATCH", bulk, controller.BulkPatch},
+		{"bulk_destroy", "DELETE", bulk, controller.BulkDestroy},
+		{"export", "GET", collection + "/export", controller.Export},
+		{"import", "POST", collection + "/import", controller.Import},
+		{"show", "GET", member, controller.Show},
+		{"store", "POST", collection, controller.Store},
+		{"update", "PUT", member, controller.Update},
+		{"patch", "PATCH", member, controller.Patch},
+		{"destroy", "DELETE", member, controller.Destroy},
+	}
+
+	var registered *mux.Route
+	for _, route := range routes {
+		if opts.except[route.action] || (opts.only != nil && !opts.only[route.action]) {
+			continue
+		}
+		registered = router.HandleFunc(route.path, route.handler).Methods(route.method)
+
+		// Document the request body of the store and update actions
+		if body := controller.RequestBody(route.action); body != nil {
+			if path, err := registered.GetPathTemplate(); err == nil {
+				swagger.RegisterRequestBody(route.method, path, body)
+			}
+		}
+	}
+
+	// Document the model of the resource
+	if registered != nil {
+		if path, err := registered.GetPathTemplate(); err == nil {
+			swagger.RegisterModel(collectionPath(path), controller.Model())
+		}
+	}
+}
+
+// collectionPath returns the collection path of a route registered by Resource
+func collectionPath(path string) string {
+	for _, suffix := range []string{"/{id}", "/bulk", "/export", "/import"} {
+		if trimmed, ok := strings.CutSuffix(path, suffix); ok {
+			return trimmed
+		}
+	}
+	return path
+}
@@ -7,8 +7,13 @@ import (
 	"os"
 	"sort"
 	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+	"went-framework/internal/httpcache"
 	"went-framework/internal/middleware"
 	"went-framework/internal/swagger"
+	"went-framework/internal/versioning"
 
 	"github.com/gorilla/mux"
 	httpSwagger "github.com/swaggo/http-swagger"
@@ -18,32 +23,49 @@ import (
 func SetupRoutes() *mux.Router {
 	router := mux.NewRouter()
 
-	// Apply global middleware
-	router.Use(middleware.MiddlewareChain(
-		middleware.RequestIDMiddleware,
-		middleware.CORSMiddleware,
-		middleware.LoggingMiddleware,
-	))
+	// Apply global middleware, see Middleware for their configuration
+	global := []string{
+		"request_id",
+		"recover",
+		"security",
+		"cors",
+		"body_limit",
+		"compress",
+		"log",
+		"cache",
+		"idempotency",
+		"deadline",
+	}
+	Middleware.Group(router, global...)
 
-	// API routes
-	api := router.PathPrefix("/api").Subrouter()
+	// Preflight requests of every path, answered by the CORS middleware. A
+	// method matcher would turn requests to unknown paths into 405 instead of 404.
+	router.MatcherFunc(func(r *http.Request, _ *mux.RouteMatch) bool {
+		return r.Method == http.MethodOptions
+	}).HandlerFunc(middleware.Preflight)
 
-	// Setup different route groups
-	setupUserRoutes(api)
+	// Unversioned API routes
+	api := router.PathPrefix("/api").Subrouter()
 	setupHealthRoutes(api)
+
+	// Versioned route groups under /api/{version}, sharing one rate limit
+	APIVersions.Mount(router, func(api *mux.Router) {
+		Middleware.Group(api, "throttle:api")
+	})
 	setupSwaggerRoutes(router)
 
-	// Placeholder for other route groups
-	setupOtherRoutes(api)
+	// Unversioned requests such as /api/users are served by the negotiated
+	// version. mux runs no middleware for requests matching no route, so the
+	// 404, 405 and 406 responses get the global middleware here.
+	unmatched := Middleware.MustResolve(global...)
+	router.NotFoundHandler = APIVersions.Negotiate(router, unmatched)
+	router.MethodNotAllowedHandler = unmatched(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
 
 	return router
 }
 
-func setupOtherRoutes(api *mux.Router) {
-	// Placeholder for other routes
-	// Add more route groups as needed
-}
-
 // setupHealthRoutes configures health check routes
 func setupHealthRoutes(api *mux.Router) {
 	api.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -55,27 +77,53 @@ func setupHealthRoutes(api *mux.Router) {
 
 // setupSwaggerRoutes configures Swagger documentation routes
 func setupSwaggerRoutes(router *mux.Router) {
-	// Swagger JSON endpoint
-	router.HandleFunc("/swagger.json", func(w http.ResponseWriter, r *http.Request) {
-		// Generate swagger spec dynamically
-		spec, err := generateSwaggerSpec(router)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Error generating swagger spec: %v", err), http.StatusInternalServerError)
+	// Swagger JSON endpoints, /swagger.json documents the default version.
+	// The routes do not change once set up, so each specification is generated
+	// on first use and served from memory afterwards.
+	var (
+		specsMu sync.Mutex
+		specs   = map[string][]byte{}
+	)
+	serveSpec := func(w http.ResponseWriter, name string) {
+		version, ok := APIVersions.Lookup(name)
+		if !ok {
+			http.Error(w, fmt.Sprintf("Unknown API version: %s", name), http.StatusNotFound)
 			return
 		}
 
+		specsMu.Lock()
+		body, ok := specs[version.Name]
+		if !ok {
+			spec, err := generateSwaggerSpec(router, version)
+			if err != nil {
+				specsMu.Unlock()
+				http.Error(w, fmt.Sprintf("Error generating swagger spec: %v", err), http.StatusInternalServerError)
+				return
+			}
+			body, _ = json.Marshal(spec)
+			specs[version.Name] = body
+		}
+		specsMu.Unlock()
+
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(spec)
+		w.Header().Set("ETag", httpcache.StrongETag(body))
+		w.Write(body)
+	}
+	router.HandleFunc("/swagger.json", func(w http.ResponseWriter, r *http.Request) {
+		serveSpec(w, APIVersions.Default)
+	}).Methods("GET")
+	router.HandleFunc("/swagger/{version:v[0-9]+}.json", func(w http.ResponseWriter, r *http.Request) {
+		serveSpec(w, mux.Vars(r)["version"])
 	}).Methods("GET")
 
-	// Swagger UI
-	router.PathPrefix("/swagger/").Handler(httpSwagger.Handler(
-		httpSwagger.URL("/swagger.json"),
-	))
+	// Swagger UI, a page running inline scripts and styles that the API
+	// security policy would block
+	Middleware.Route(router.PathPrefix("/swagger/").Handler(httpSwagger.Handler(httpSwagger.URL("/swagger.json"))),
+		"security:swagger")
 }
 
-// generateSwaggerSpec generates the Swagger specification for the current router
-func generateSwaggerSpec(router *mux.Router) (*swagger.SwaggerSpec, error) {
+// generateSwaggerSpec generates the Swagger specification of an API version
+func generateSwaggerSpec(router *mux.Router, version versioning.Version) (*swagger.SwaggerSpec, error) {
 	host := getEnv("SERVER_HOST", "localhost")
 	port := getEnv("SERVER_PORT", "3000")
 
@@ -88,10 +136,44 @@ func generateSwaggerSpec(router *mux.Router) (*swagger.SwaggerSpec, error) {
 		Title:       getEnv("APP_NAME", "WentFramework API"),
 		Description: "Auto-generated API documentation for WentFramework",
 		Host:        fmt.Sprintf("%s:%s", host, port),
-		BasePath:    "/api",
 	}
 
-	return swagger.GenerateSwagger(router, info)
+	return GenerateVersionSpec(router, version, info)
+}
+
+// GenerateVersionSpec generates the Swagger specification of an API version: its
+// own routes and the unversioned ones, such as /api/health. The base path of
+// info is set to the prefix of the version.
+func GenerateVersionSpec(router *mux.Router, version versioning.Version, info swagger.SwaggerInfo) (*swagger.SwaggerSpec, error) {
+	info.BasePath = APIVersions.Prefix(version)
+	if version.IsDeprecated() {
+		info.Description = strings.TrimSuffix(info.Description, ".") + fmt.Sprintf(". Version %s is deprecated since %s", version.Name, version.Deprecated.Format("2006-01-02"))
+		if !version.Sunset.IsZero() {
+			info.Description += fmt.Sprintf(" and will be removed on %s", version.Sunset.Format("2006-01-02"))
+		}
+		info.Description += "."
+	}
+
+	spec, err := swagger.GenerateSwagger(router, info)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, route := range extractRoutes(router) {
+		spec.SetMiddleware(route.Method, route.Path, route.Middleware)
+	}
+
+	spec.Only(func(path string) bool {
+		owner, versioned := APIVersions.Match(path)
+		return !versioned || owner.Name == version.Name
+	})
+	if version.IsDeprecated() {
+		spec.Deprecate(func(path string) bool {
+			_, versioned := APIVersions.Match(path)
+			return versioned
+		})
+	}
+	return spec, nil
 }
 
 // PrintRoutes displays all available routes in a formatted way
@@ -107,35 +189,62 @@ func PrintRoutes(router *mux.Router) {
 	fmt.Printf("📡 API available at http://%s:%s/api\n", host, port)
 	fmt.Printf("📚 Swagger UI available at http://%s:%s/swagger/\n", host, port)
 	fmt.Printf("📄 Swagger JSON available at http://%s:%s/swagger.json\n", host, port)
+	fmt.Printf("🔖 API versions: %s (default %s)\n", strings.Join(APIVersions.Names(), ", "), APIVersions.Default)
 	fmt.Println("👥 Available endpoints:")
 
-	// Extract routes from the router
-	routes := extractRoutes(router)
+	// Display routes in a formatted way
+	for _, route := range sortedRoutes(router) {
+		description := getRouteDescription(route.Method, route.Path)
+		fmt.Printf("   %-6s %s - %s\n", route.Method, route.Path, description)
+	}
+}
+
+// PrintRouteList displays a table of the routes with their middleware stack,
+// for the route:list command. Only the routes whose path starts with prefix
+// are listed.
+func PrintRouteList(router *mux.Router, prefix string) {
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "METHOD\tPATH\tDESCRIPTION\tMIDDLEWARE")
+
+	count := 0
+	for _, route := range sortedRoutes(router) {
+		if !strings.HasPrefix(route.Path, prefix) {
+			continue
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", route.Method, route.Path,
+			getRouteDescription(route.Method, route.Path), strings.Join(route.Middleware, " "))
+		count++
+	}
+	table.Flush()
+
+	fmt.Printf("\n%d routes\n", count)
+}
 
-	// Sort routes for consistent display
+// sortedRoutes returns the routes of a router sorted by path, then method
+func sortedRoutes(router *mux.Router) []RouteInfo {
+	routes := extractRoutes(router)
 	sort.Slice(routes, func(i, j int) bool {
 		if routes[i].Path == routes[j].Path {
 			return routes[i].Method < routes[j].Method
 		}
 		return routes[i].Path < routes[j].Path
 	})
-
-	// Display routes in a formatted way
-	for _, route := range routes {
-		description := getRouteDescription(route.Method, route.Path)
-		fmt.Printf("   %-6s %s - %s\n", route.Method, route.Path, description)
-	}
+	return routes
 }
 
 // RouteInfo holds information about a route
 type RouteInfo struct {
 	Method string
 	Path   string
+	// Middleware lists the named middleware of the route, outermost first
+	Middleware []string
 }
 
-// extractRoutes extracts all routes from the mux router
+// extractRoutes extracts all routes from the mux router. Routes matching any
+// method, such as the Swagger UI, are listed with the method ANY.
 func extractRoutes(router *mux.Router) []RouteInfo {
 	var routes []RouteInfo
+	stacks := Middleware.Stacks(router)
 
 	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
 		pathTemplate, err := route.GetPathTemplate()
@@ -145,14 +254,18 @@ func extractRoutes(router *mux.Router) []RouteInfo {
 
 		methods, err := route.GetMethods()
 		if err != nil {
-			// If no methods specified, skip this route
-			return nil
+			// Subrouters have no methods nor handler, skip them
+			if route.GetHandler() == nil {
+				return nil
+			}
+			methods = []string{"ANY"}
 		}
 
 		for _, method := range methods {
 			routes = append(routes, RouteInfo{
-				Method: method,
-				Path:   pathTemplate,
+				Method:     method,
+				Path:       pathTemplate,
+				Middleware: stacks[route],
 			})
 		}
 
@@ -170,14 +283,37 @@ func extractRoutes(router *mux.Router) []RouteInfo {
 func getRouteDescription(method, path string) string {
 	// Clean up the path for matching
 	cleanPath := strings.TrimPrefix(path, "/api")
+	if version, ok := APIVersions.Match(path); ok {
+		cleanPath = strings.TrimPrefix(path, APIVersions.Prefix(version))
+	}
 
 	switch {
 	case path == "/api/health":
 		return "Health check"
 	case path == "/swagger.json":
 		return "Swagger JSON specification"
+	case strings.HasPrefix(path, "/swagger/{version"):
+		return "Swagger JSON specification of an API version"
 	case strings.HasPrefix(path, "/swagger/"):
 		return "Swagger UI documentation"
+	case method == "GET" && strings.Contains(cleanPath, "/{id}/"):
+		// Nested relation routes such as /users/{id}/posts
+		pathParts := strings.Split(strings.Trim(cleanPath, "/"), "/")
+		return fmt.Sprintf("Get %s of %s", pathParts[len(pathParts)-1], strings.TrimSuffix(pathParts[0], "s"))
+	case strings.HasSuffix(cleanPath, "/bulk"):
+		resource := strings.Split(strings.Trim(cleanPath, "/"), "/")[0]
+		switch method {
+		case "POST":
+			return fmt.Sprintf("Create %s in bulk", resource)
+		case "PATCH":
+			return fmt.Sprintf("Patch %s in bulk", resource)
+		default:
+			return fmt.Sprintf("Delete %s in bulk", resource)
+		}
+	case strings.HasSuffix(cleanPath, "/export"):
+		return fmt.Sprintf("Export %s", strings.Split(strings.Trim(cleanPath, "/"), "/")[0])
+	case strings.HasSuffix(cleanPath, "/import"):
+		return fmt.Sprintf("Import %s", strings.Split(strings.Trim(cleanPath, "/"), "/")[0])
 	case method == "GET" && cleanPath == "/users":
 		return "Get all users"
 	case method == "GET" && strings.Contains(cleanPath, "/users/{id}"):
@@ -186,6 +322,8 @@ func getRouteDescription(method, path string) string {
 		return "Create new user"
 	case method == "PUT" && strings.Contains(cleanPath, "/users/{id}"):
 		return "Update user"
+	case method == "PATCH" && strings.Contains(cleanPath, "/users/{id}"):
+		return "Patch user"
 	case method == "DELETE" && strings.Contains(cleanPath, "/users/{id}"):
 		return "Delete user"
 	default:
@@ -222,3 +360,11 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// getDurationEnv gets a duration environment variable such as "24h" with fallback
+func getDurationEnv(key string, fallback time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return value
+	}
+	return fallback
+}
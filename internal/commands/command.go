@@ -10,13 +10,23 @@ import (
 	"os"
 	"strings"
 	"text/template"
+	"time"
 	"went-framework/app/database"
 	"went-framework/app/router"
+	wentlog "went-framework/internal/logger"
+	"went-framework/internal/query"
 	"went-framework/internal/swagger"
 )
 
 // StartServer starts the HTTP server
 func StartServer() {
+	// Cursors are signed with APP_KEY, fail now rather than on the first cursor
+	if key := os.Getenv("APP_KEY"); key == "" {
+		wentlog.Warn("APP_KEY is not set, cursors are signed with a random key and are only valid on this process until it restarts")
+	} else if err := query.ValidateSigningKey(key); err != nil {
+		log.Fatalf("Invalid APP_KEY: %v", err)
+	}
+
 	// Setup routes using the router package
 	r := router.SetupRoutes()
 
@@ -30,10 +40,20 @@ func StartServer() {
 	// Override the port in PrintRoutes output
 	fmt.Printf("🌐 Server will bind to %s:%s\n", host, port)
 
-	// Start the server
-	address := fmt.Sprintf("%s:%s", host, port)
-	log.Printf("Starting server on %s", address)
-	log.Fatal(http.ListenAndServe(address, r))
+	// Start the server. The timeouts keep slow clients from holding
+	// connections: the headers must arrive within SERVER_READ_HEADER_TIMEOUT,
+	// the whole request within SERVER_READ_TIMEOUT and the response must be
+	// written within SERVER_WRITE_TIMEOUT of the end of the request headers.
+	server := &http.Server{
+		Addr:              fmt.Sprintf("%s:%s", host, port),
+		Handler:           r,
+		ReadHeaderTimeout: getDurationEnv("SERVER_READ_HEADER_TIMEOUT", 5*time.Second),
+		ReadTimeout:       getDurationEnv("SERVER_READ_TIMEOUT", 30*time.Second),
+		WriteTimeout:      getDurationEnv("SERVER_WRITE_TIMEOUT", 60*time.Second),
+		IdleTimeout:       getDurationEnv("SERVER_IDLE_TIMEOUT", 120*time.Second),
+	}
+	log.Printf("Starting server on %s", server.Addr)
+	log.Fatal(server.ListenAndServe())
 }
 
 // TestDatabaseConnection tests the database connection
@@ -72,25 +92,37 @@ func GenerateSwaggerDocs() {
 		Title:       getEnv("APP_NAME", "WentFramework API"),
 		Description: "Auto-generated API documentation for WentFramework - A lightweight Go framework for building RESTful APIs",
 		Host:        fmt.Sprintf("%s:%s", host, port),
-		BasePath:    "/api",
 	}
 
-	spec, err := swagger.GenerateSwagger(r, info)
-	if err != nil {
-		log.Fatalf("Error generating swagger spec: %v", err)
-	}
-
-	// Save to file
-	filename := "docs/swagger.json"
-	if err := swagger.SaveSwaggerSpec(spec, filename); err != nil {
-		log.Fatalf("Error saving swagger spec: %v", err)
+	// One specification per API version, docs/swagger.json documents the default one
+	for _, version := range router.APIVersions.Versions {
+		spec, err := router.GenerateVersionSpec(r, version, info)
+		if err != nil {
+			log.Fatalf("Error generating swagger spec of %s: %v", version.Name, err)
+		}
+
+		filenames := []string{fmt.Sprintf("docs/swagger-%s.json", version.Name)}
+		if version.Name == router.APIVersions.Default {
+			filenames = append([]string{"docs/swagger.json"}, filenames...)
+		}
+		for _, filename := range filenames {
+			if err := swagger.SaveSwaggerSpec(spec, filename); err != nil {
+				log.Fatalf("Error saving swagger spec: %v", err)
+			}
+			fmt.Printf("📄 Saved %s to: %s\n", version.Name, filename)
+		}
 	}
 
 	fmt.Printf("✅ Swagger documentation generated successfully!\n")
-	fmt.Printf("📄 Saved to: %s\n", filename)
 	fmt.Printf("🌐 When server is running, view at: http://%s:%s/swagger/\n", host, port)
 }
 
+// ListRoutes prints the routes with their middleware stack, only those whose
+// path starts with prefix when it is not empty
+func ListRoutes(prefix string) {
+	router.PrintRouteList(router.SetupRoutes(), prefix)
+}
+
 // MakeModel creates model and controller files from templates
 func MakeModel(modelName string) {
 	createFileFromTemplate("internal/templates/model.tpl", "app/models/"+modelName+".go", modelName)
@@ -106,6 +138,14 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+// getDurationEnv gets a duration environment variable such as "30s" with fallback
+func getDurationEnv(key string, fallback time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return value
+	}
+	return fallback
+}
+
 // createFileFromTemplate creates a file from a template
 func createFileFromTemplate(templatePath, outputPath, modelName string) {
 	tpl, err := template.ParseFiles(templatePath)
@@ -8,7 +8,10 @@ import (
 	"fmt"
 	"went-framework/app/database"
 	"went-framework/app/models"
+	"went-framework/internal/idempotency"
 	"went-framework/internal/logger"
+	"went-framework/internal/query"
+	"went-framework/internal/ratelimit"
 )
 
 func Migrate() {
@@ -16,14 +19,25 @@ func Migrate() {
 
 	err := database.DB.AutoMigrate(
 		// System Tables
-		&logger.LogEntry{}, // Add logs table
+		&logger.LogEntry{},    // Add logs table
+		&idempotency.Record{}, // Stored responses of idempotency keys
+		&ratelimit.Entry{},    // Rate limit counters of the postgres store
 
 		&models.User{},
+		&models.Profile{},
+		&models.Post{},
+		&models.Role{},
 		// ... Add other models here as needed
 	)
 	if err != nil {
 		panic(err)
 	}
+
+	// Full-text search columns and indexes for searchable models
+	if err := query.CreateSearchIndex(database.DB, models.User{}); err != nil {
+		panic(err)
+	}
+
 	fmt.Println("Migration completed.")
 }
 
@@ -33,8 +47,14 @@ func MigrateFresh() {
 	// Tüm tabloları sil
 	err := database.DB.Migrator().DropTable(
 		// System Tables
-		&logger.LogEntry{}, // Add logs table
+		&logger.LogEntry{},    // Add logs table
+		&idempotency.Record{}, // Stored responses of idempotency keys
+		&ratelimit.Entry{},    // Rate limit counters of the postgres store
 
+		"user_roles", // many-to-many join table
+		&models.Post{},
+		&models.Profile{},
+		&models.Role{},
 		&models.User{},
 		// ... Add other models here as needed
 	)
@@ -54,8 +74,14 @@ func MigrateRollback() {
 	// Tüm tabloları sil
 	err := database.DB.Migrator().DropTable(
 		// System Tables
-		&logger.LogEntry{}, // Add logs table
+		&logger.LogEntry{},    // Add logs table
+		&idempotency.Record{}, // Stored responses of idempotency keys
+		&ratelimit.Entry{},    // Rate limit counters of the postgres store
 
+		"user_roles", // many-to-many join table
+		&models.Post{},
+		&models.Profile{},
+		&models.Role{},
 		&models.User{},
 		// ... Add other models here as needed
 	)
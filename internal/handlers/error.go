@@ -1,5 +1,229 @@
 package handlers
 
-//
-//    TODO: Implement centralized error handling
-//
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"went-framework/app/database"
+	"went-framework/internal/render"
+	"went-framework/internal/validation"
+
+	wentlog "went-framework/internal/logger"
+
+	"gorm.io/gorm"
+)
+
+// StatusClientClosedRequest is the non-standard status used when the client
+// went away before the response was written
+const StatusClientClosedRequest = 499
+
+// Error codes returned in the "code" field of error responses
+const (
+	CodeBadRequest           = "bad_request"
+	CodeNotFound             = "not_found"
+	CodeForbidden            = "forbidden"
+	CodeConflict             = "conflict"
+	CodeValidationFailed     = "validation_failed"
+	CodePreconditionFailed   = "precondition_failed"
+	CodePreconditionRequired = "precondition_required"
+	CodeClientClosed         = "client_closed_request"
+	CodeTimeout              = "timeout"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeNotAcceptable        = "not_acceptable"
+	CodeIdempotencyKeyReused = "idempotency_key_reused"
+	CodeTooManyRequests      = "too_many_requests"
+	CodePayloadTooLarge      = "payload_too_large"
+	CodeUnavailable          = "service_unavailable"
+	CodeInternal             = "internal_error"
+)
+
+// PostgreSQL error codes of constraint violations
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+)
+
+// AppError is an error with its HTTP status, a machine-readable code and a message
+// that is safe to show to clients. The internal cause is logged but never sent.
+type AppError struct {
+	Code    string
+	Status  int
+	Message string
+	// Errors holds per-field messages of validation failures
+	Errors map[string]string
+	// Err is the internal cause
+	Err error
+}
+
+func (e *AppError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *AppError) Unwrap() error {
+	return e.Err
+}
+
+// NewError creates an AppError without an internal cause
+func NewError(status int, code, message string) *AppError {
+	return &AppError{Code: code, Status: status, Message: message}
+}
+
+// BadRequest creates a 400 error
+func BadRequest(message string) *AppError {
+	return NewError(http.StatusBadRequest, CodeBadRequest, message)
+}
+
+// NotFound creates a 404 error
+func NotFound(message string) *AppError {
+	return NewError(http.StatusNotFound, CodeNotFound, message)
+}
+
+// Conflict creates a 409 error
+func Conflict(message string) *AppError {
+	return NewError(http.StatusConflict, CodeConflict, message)
+}
+
+// PreconditionFailed creates a 412 error
+func PreconditionFailed(message string) *AppError {
+	return NewError(http.StatusPreconditionFailed, CodePreconditionFailed, message)
+}
+
+// FromError maps any error to an AppError: AppErrors are returned as they are,
+// validation, GORM, database constraint and context errors get their matching
+// status and everything else is an internal error
+func FromError(err error) *AppError {
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+
+	var validationErrors validation.Errors
+	var decodeErr *render.DecodeError
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return &AppError{Code: CodePayloadTooLarge, Status: http.StatusRequestEntityTooLarge,
+			Message: fmt.Sprintf("The request body must be at most %d bytes", maxBytesErr.Limit), Err: err}
+	case errors.Is(err, render.ErrUnsupportedMediaType):
+		return &AppError{Code: CodeUnsupportedMediaType, Status: http.StatusUnsupportedMediaType,
+			Message: "The request body media type is not supported", Err: err}
+	case errors.As(err, &decodeErr):
+		return &AppError{Code: CodeBadRequest, Status: http.StatusBadRequest, Message: decodeErr.Error(), Err: err}
+	case errors.As(err, &validationErrors):
+		return &AppError{Code: CodeValidationFailed, Status: http.StatusUnprocessableEntity,
+			Message: "The given data was invalid", Errors: validationErrors, Err: err}
+	case errors.Is(err, database.ErrUnavailable):
+		return &AppError{Code: CodeUnavailable, Status: http.StatusServiceUnavailable, Message: "Database is unavailable", Err: err}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return &AppError{Code: CodeNotFound, Status: http.StatusNotFound, Message: "Resource not found", Err: err}
+	case errors.Is(err, gorm.ErrDuplicatedKey) || sqlState(err) == pgUniqueViolation:
+		return &AppError{Code: CodeConflict, Status: http.StatusConflict,
+			Message: "A record with the same unique value already exists", Err: err}
+	case errors.Is(err, gorm.ErrForeignKeyViolated) || sqlState(err) == pgForeignKeyViolation:
+		return &AppError{Code: CodeValidationFailed, Status: http.StatusUnprocessableEntity,
+			Message: "A referenced record does not exist or is still in use", Err: err}
+	case errors.Is(err, context.Canceled):
+		return &AppError{Code: CodeClientClosed, Status: StatusClientClosedRequest, Message: "Request was cancelled", Err: err}
+	case errors.Is(err, context.DeadlineExceeded):
+		return &AppError{Code: CodeTimeout, Status: http.StatusGatewayTimeout, Message: "Request timed out", Err: err}
+	default:
+		return &AppError{Code: CodeInternal, Status: http.StatusInternalServerError, Message: "Internal server error", Err: err}
+	}
+}
+
+// ReadError maps a failure to read the request body: 413 when the body is over
+// the size limit of the route, 400 with message otherwise
+func ReadError(err error, message string) *AppError {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return FromError(err)
+	}
+	return BadRequest(message)
+}
+
+// Wrap maps err like FromError but replaces the public message, e.g. to name the
+// resource that was not found
+func Wrap(err error, message string) *AppError {
+	wrapped := *FromError(err)
+	wrapped.Message = message
+	wrapped.Err = err
+	return &wrapped
+}
+
+// sqlState returns the SQLSTATE code of a database driver error, if any
+func sqlState(err error) string {
+	var state interface{ SQLState() string }
+	if errors.As(err, &state) {
+		return state.SQLState()
+	}
+	return ""
+}
+
+// errorResponse is the standard error envelope
+type errorResponse struct {
+	Status  string            `json:"status"`
+	Message string            `json:"message"`
+	Code    string            `json:"code,omitempty"`
+	Errors  map[string]string `json:"errors,omitempty"`
+}
+
+// problemResponse is an RFC 7807 problem details document
+type problemResponse struct {
+	Type     string            `json:"type"`
+	Title    string            `json:"title"`
+	Status   int               `json:"status"`
+	Detail   string            `json:"detail"`
+	Instance string            `json:"instance,omitempty"`
+	Code     string            `json:"code,omitempty"`
+	Errors   map[string]string `json:"errors,omitempty"`
+}
+
+// RespondError writes err as an error response. The envelope is the standard
+// {"status": "error", ...} one in the format negotiated by render, or
+// application/problem+json when the client accepts it. Internal causes of
+// server errors are logged, not returned.
+func RespondError(w http.ResponseWriter, r *http.Request, err error) {
+	appErr := FromError(err)
+
+	if appErr.Status >= http.StatusInternalServerError && appErr.Err != nil {
+		wentlog.ErrorContext(r.Context(), appErr.Message, map[string]interface{}{
+			"code":   appErr.Code,
+			"cause":  appErr.Err.Error(),
+			"method": r.Method,
+			"path":   r.URL.Path,
+		})
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "application/problem+json") {
+		title := http.StatusText(appErr.Status)
+		if appErr.Status == StatusClientClosedRequest {
+			title = "Client Closed Request"
+		}
+
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(appErr.Status)
+		json.NewEncoder(w).Encode(problemResponse{
+			Type:     "about:blank",
+			Title:    title,
+			Status:   appErr.Status,
+			Detail:   appErr.Message,
+			Instance: r.URL.Path,
+			Code:     appErr.Code,
+			Errors:   appErr.Errors,
+		})
+		return
+	}
+
+	render.RenderError(w, r, appErr.Status, errorResponse{
+		Status:  "error",
+		Message: appErr.Message,
+		Code:    appErr.Code,
+		Errors:  appErr.Errors,
+	})
+}
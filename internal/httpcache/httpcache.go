@@ -0,0 +1,95 @@
+package httpcache
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// StrongETag returns a strong entity tag for a response body: byte-for-byte
+// identical bodies get the same tag
+func StrongETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:18]) + `"`
+}
+
+// WeakETag returns a weak entity tag for a response body, for representations
+// that are equivalent but not byte-for-byte identical, e.g. once compressed
+func WeakETag(body []byte) string {
+	return "W/" + StrongETag(body)
+}
+
+// LastModified returns the UpdatedAt field of a model, if it has one
+func LastModified(model interface{}) (time.Time, bool) {
+	value := reflect.ValueOf(model)
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return time.Time{}, false
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return time.Time{}, false
+	}
+
+	field := value.FieldByName("UpdatedAt")
+	if !field.IsValid() {
+		return time.Time{}, false
+	}
+	modified, ok := field.Interface().(time.Time)
+	return modified, ok && !modified.IsZero()
+}
+
+// SetValidators sets the ETag and Last-Modified headers of a response, leaving
+// out the empty ones
+func SetValidators(w http.ResponseWriter, etag string, modified time.Time) {
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// NotModified reports whether the client has the current representation of a
+// GET or HEAD request: If-None-Match matches etag, or without If-None-Match,
+// the resource is unchanged since If-Modified-Since. Tags are compared weakly,
+// as required for If-None-Match.
+func NotModified(r *http.Request, etag string, modified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(header, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if header := r.Header.Get("If-Modified-Since"); header != "" && !modified.IsZero() {
+		since, err := http.ParseTime(header)
+		// HTTP dates have a precision of one second
+		return err == nil && !modified.Truncate(time.Second).After(since)
+	}
+	return false
+}
+
+// WriteNotModified answers with 304 Not Modified, keeping the validators and
+// caching headers but not the headers describing a body
+func WriteNotModified(w http.ResponseWriter) {
+	header := w.Header()
+	for _, name := range []string{"Content-Type", "Content-Length", "Content-Encoding", "Content-Disposition"} {
+		header.Del(name)
+	}
+	w.WriteHeader(http.StatusNotModified)
+}
@@ -0,0 +1,319 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+	"went-framework/app/database"
+	"went-framework/internal/handlers"
+	"went-framework/internal/middleware"
+	"went-framework/internal/ratelimit"
+
+	wentlog "went-framework/internal/logger"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Header is the request header carrying the idempotency key
+const Header = "Idempotency-Key"
+
+// MaxKeyLength is the longest accepted idempotency key
+const MaxKeyLength = 255
+
+const (
+	// DefaultTTL is how long responses are kept for replay by default
+	DefaultTTL = 24 * time.Hour
+	// DefaultLockTimeout is how long a request may hold its key by default
+	// before the key is considered abandoned, e.g. after a crash
+	DefaultLockTimeout = time.Minute
+)
+
+// purgeInterval is the minimum time between two purges of expired keys
+const purgeInterval = time.Hour
+
+// Record is the stored request fingerprint and response of an idempotency key.
+// Status is 0 while the first request with the key is being processed. Key
+// is a hash of the client and of the key it sent, see RecordKey.
+type Record struct {
+	Key         string `gorm:"column:idempotency_key;primaryKey;size:255"`
+	Fingerprint string `gorm:"size:64;not null"`
+	Status      int    `gorm:"not null;default:0"`
+	Header      string `gorm:"type:text"`
+	Body        []byte
+	CreatedAt   time.Time `gorm:"not null"`
+	ExpiresAt   time.Time `gorm:"not null;index"`
+}
+
+// TableName returns the table of idempotency records
+func (Record) TableName() string {
+	return "idempotency_keys"
+}
+
+// Config configures the idempotency middleware, zero values take the defaults
+type Config struct {
+	// TTL is how long a response is replayed for its key
+	TTL time.Duration
+	// LockTimeout is how long a request may hold its key before another
+	// request with the key may take it over
+	LockTimeout time.Duration
+	// Client identifies the caller owning the keys, e.g. its API key or user,
+	// so the same key sent by another client never replays its response.
+	// Requests are told apart by IP by default.
+	Client ratelimit.KeyFunc
+}
+
+// lastPurge is the Unix time of the last purge of expired keys
+var lastPurge atomic.Int64
+
+// Middleware honours the Idempotency-Key header of POST and PATCH requests. The
+// first request with a key is processed and its response is stored for the TTL;
+// later requests of the same client with the key and the same method, path,
+// query and body get the stored response replayed with Idempotent-Replayed:
+// true. Keys of other clients are distinct, see Config.Client. A request
+// arriving while the key is still being processed gets 409 Conflict, and one
+// reusing the key for a different request gets 422 Unprocessable Entity. Server
+// errors are not stored, so the request can be retried once its handler has
+// returned, even when Deadline answered in its place. Requests with a key get
+// 503 Service Unavailable while the database cannot be reached.
+func Middleware(config Config) func(http.Handler) http.Handler {
+	if config.TTL <= 0 {
+		config.TTL = DefaultTTL
+	}
+	if config.LockTimeout <= 0 {
+		config.LockTimeout = DefaultLockTimeout
+	}
+	if config.Client == nil {
+		config.Client = ratelimit.ByIP
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sent := r.Header.Get(Header)
+			if sent == "" || (r.Method != http.MethodPost && r.Method != http.MethodPatch) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(sent) > MaxKeyLength {
+				handlers.RespondError(w, r, handlers.BadRequest(fmt.Sprintf("%s must be at most %d characters", Header, MaxKeyLength)))
+				return
+			}
+			key := RecordKey(config.Client(r), sent)
+
+			// Never process the request unchecked: without the store a retry
+			// could be processed twice, so it gets 503 and can be retried later
+			conn, err := database.Get()
+			if err != nil {
+				handlers.RespondError(w, r, err)
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				handlers.RespondError(w, r, handlers.ReadError(err, "Failed to read the request body"))
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			db := conn.WithContext(r.Context())
+			purgeExpired(db)
+
+			fingerprint := Fingerprint(r, body)
+			acquired, err := acquire(db, key, fingerprint, config)
+			if err != nil {
+				handlers.RespondError(w, r, handlers.Wrap(err, "Failed to check the idempotency key"))
+				return
+			}
+			if !acquired {
+				replay(w, r, db, key, fingerprint)
+				return
+			}
+
+			rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+			r, handlerDone := middleware.WaitHandler(r)
+			completed := false
+			defer func() {
+				// Release the key when the handler panicked, so the request can be retried
+				if !completed {
+					release(conn, key)
+				}
+			}()
+
+			next.ServeHTTP(rec, r)
+			completed = true
+
+			if rec.status >= http.StatusInternalServerError {
+				// After a timeout the handler may still be running and commit, the
+				// key is held until it returns so a retry cannot run alongside it
+				go func() {
+					handlerDone()
+					release(conn, key)
+				}()
+				return
+			}
+			if err := store(conn, key, rec); err != nil {
+				wentlog.ErrorContext(r.Context(), "Failed to store the idempotent response", map[string]interface{}{
+					"cause":  err.Error(),
+					"method": r.Method,
+					"path":   r.URL.Path,
+				})
+			}
+		})
+	}
+}
+
+// RecordKey returns the key of the record of an idempotency key sent by a client
+func RecordKey(client, key string) string {
+	sum := sha256.Sum256([]byte(client + "\n" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Fingerprint identifies a request by its method, path, query and body
+func Fingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s?%s\n", r.Method, r.URL.Path, r.URL.RawQuery)
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// acquire claims a key for a request. It creates the record of a new key, or
+// takes over the record of an expired or abandoned key.
+func acquire(db *gorm.DB, key, fingerprint string, config Config) (bool, error) {
+	now := time.Now()
+	record := Record{Key: key, Fingerprint: fingerprint, CreatedAt: now, ExpiresAt: now.Add(config.TTL)}
+
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return true, nil
+	}
+
+	result = db.Model(&Record{}).
+		Where("idempotency_key = ? AND (expires_at < ? OR (status = 0 AND created_at < ?))", key, now, now.Add(-config.LockTimeout)).
+		Updates(map[string]interface{}{
+			"fingerprint": fingerprint,
+			"status":      0,
+			"header":      "",
+			"body":        nil,
+			"created_at":  now,
+			"expires_at":  record.ExpiresAt,
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+// replay writes the stored response of a key, or the error explaining why the
+// request cannot be processed
+func replay(w http.ResponseWriter, r *http.Request, db *gorm.DB, key, fingerprint string) {
+	var record Record
+	err := db.Where("idempotency_key = ?", key).First(&record).Error
+	switch {
+	case err == gorm.ErrRecordNotFound:
+		// The first request failed and released the key in the meantime
+		handlers.RespondError(w, r, handlers.Conflict("A request with this Idempotency-Key is being processed, retry later"))
+		return
+	case err != nil:
+		handlers.RespondError(w, r, handlers.Wrap(err, "Failed to check the idempotency key"))
+		return
+	case record.Fingerprint != fingerprint:
+		handlers.RespondError(w, r, handlers.NewError(http.StatusUnprocessableEntity, handlers.CodeIdempotencyKeyReused,
+			"This Idempotency-Key was used for a different request"))
+		return
+	case record.Status == 0:
+		handlers.RespondError(w, r, handlers.Conflict("A request with this Idempotency-Key is being processed, retry later"))
+		return
+	}
+
+	var header http.Header
+	if err := json.Unmarshal([]byte(record.Header), &header); err != nil {
+		handlers.RespondError(w, r, handlers.Wrap(err, "Failed to replay the stored response"))
+		return
+	}
+	for name, values := range header {
+		// Headers of this request, such as X-Request-ID, are not overwritten
+		if _, ok := w.Header()[name]; !ok {
+			w.Header()[name] = values
+		}
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(record.Status)
+	w.Write(record.Body)
+}
+
+// store saves the response of the request holding a key
+func store(db *gorm.DB, key string, rec *recorder) error {
+	header, err := json.Marshal(rec.header)
+	if err != nil {
+		return err
+	}
+
+	return db.Model(&Record{}).Where("idempotency_key = ?", key).Updates(map[string]interface{}{
+		"status": rec.status,
+		"header": string(header),
+		"body":   rec.body.Bytes(),
+	}).Error
+}
+
+// release deletes the record of a key whose request did not complete
+func release(db *gorm.DB, key string) {
+	db.Where("idempotency_key = ? AND status = 0", key).Delete(&Record{})
+}
+
+// Purge deletes the records of expired keys
+func Purge(db *gorm.DB) error {
+	return db.Where("expires_at < ?", time.Now()).Delete(&Record{}).Error
+}
+
+// purgeExpired purges expired keys in the background, at most once per purgeInterval
+func purgeExpired(db *gorm.DB) {
+	now := time.Now().Unix()
+	last := lastPurge.Load()
+	if now-last < int64(purgeInterval/time.Second) || !lastPurge.CompareAndSwap(last, now) {
+		return
+	}
+
+	go func() {
+		if err := Purge(db.WithContext(context.Background())); err != nil {
+			wentlog.Error("Failed to purge expired idempotency keys", map[string]interface{}{"cause": err.Error()})
+		}
+	}()
+}
+
+// recorder passes the response through while keeping a copy of it
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	header      http.Header
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.wroteHeader = true
+		rec.status = status
+		rec.header = rec.ResponseWriter.Header().Clone()
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rec *recorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
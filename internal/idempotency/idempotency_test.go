@@ -0,0 +1,268 @@
+package idempotency
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"went-framework/app/database"
+	"went-framework/internal/ratelimit"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openDB sets database.DB to an empty in-memory database for the test
+func openDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", strings.ReplaceAll(t.Name(), "/", "_"))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&Record{}); err != nil {
+		t.Fatal(err)
+	}
+	// Keep the purge from running in the background of the test
+	lastPurge.Store(time.Now().Unix())
+
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = previous
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func TestAcquire(t *testing.T) {
+	config := Config{TTL: time.Hour, LockTimeout: time.Minute}
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		existing *Record
+		want     bool
+	}{
+		{
+			name: "new key",
+			want: true,
+		},
+		{
+			name:     "being processed",
+			existing: &Record{Status: 0, CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+			want:     false,
+		},
+		{
+			name:     "abandoned",
+			existing: &Record{Status: 0, CreatedAt: now.Add(-2 * time.Minute), ExpiresAt: now.Add(time.Hour)},
+			want:     true,
+		},
+		{
+			name:     "completed",
+			existing: &Record{Status: http.StatusCreated, CreatedAt: now.Add(-2 * time.Minute), ExpiresAt: now.Add(time.Hour)},
+			want:     false,
+		},
+		{
+			name:     "expired",
+			existing: &Record{Status: http.StatusCreated, CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)},
+			want:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openDB(t)
+			if tt.existing != nil {
+				tt.existing.Key, tt.existing.Fingerprint = "key", "old"
+				if err := db.Create(tt.existing).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			acquired, err := acquire(db, "key", "new", config)
+			if err != nil || acquired != tt.want {
+				t.Fatalf("acquire() = %v, %v, want %v", acquired, err, tt.want)
+			}
+
+			var record Record
+			db.First(&record, "idempotency_key = ?", "key")
+			if acquired && (record.Fingerprint != "new" || record.Status != 0 || len(record.Body) > 0) {
+				t.Errorf("record of an acquired key = %+v, want a fresh record", record)
+			}
+			if !acquired && record.Fingerprint != "old" {
+				t.Errorf("record of a key held elsewhere was changed: %+v", record)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	openDB(t)
+	var calls atomic.Int32
+	handler := Middleware(Config{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "fail") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Location", "/api/users/1")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"call":%d}`, calls.Load())
+	}))
+
+	tests := []struct {
+		name       string
+		method     string
+		key        string
+		remoteAddr string
+		body       string
+		status     int
+		response   string
+		replayed   bool
+		calls      int32
+	}{
+		{"first request", http.MethodPost, "k1", "192.0.2.1:1", `{"a":1}`, http.StatusCreated, `{"call":1}`, false, 1},
+		{"retry is replayed", http.MethodPost, "k1", "192.0.2.1:2", `{"a":1}`, http.StatusCreated, `{"call":1}`, true, 1},
+		{"key reused for another body", http.MethodPost, "k1", "192.0.2.1:3", `{"a":2}`, http.StatusUnprocessableEntity, "", false, 1},
+		{"same key of another client", http.MethodPost, "k1", "192.0.2.2:1", `{"a":1}`, http.StatusCreated, `{"call":2}`, false, 2},
+		{"without a key", http.MethodPost, "", "192.0.2.1:4", `{"a":1}`, http.StatusCreated, `{"call":3}`, false, 3},
+		{"safe method", http.MethodGet, "k1", "192.0.2.1:5", "", http.StatusCreated, `{"call":4}`, false, 4},
+		{"key too long", http.MethodPost, strings.Repeat("k", MaxKeyLength+1), "192.0.2.1:6", `{"a":1}`, http.StatusBadRequest, "", false, 4},
+		{"server error", http.MethodPost, "k2", "192.0.2.1:7", `fail`, http.StatusInternalServerError, "", false, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/api/users", strings.NewReader(tt.body))
+			r.RemoteAddr = tt.remoteAddr
+			if tt.key != "" {
+				r.Header.Set(Header, tt.key)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.response != "" && w.Body.String() != tt.response {
+				t.Errorf("body = %s, want %s", w.Body, tt.response)
+			}
+			if replayed := w.Header().Get("Idempotent-Replayed") == "true"; replayed != tt.replayed {
+				t.Errorf("replayed = %v, want %v", replayed, tt.replayed)
+			}
+			if tt.replayed && w.Header().Get("Location") != "/api/users/1" {
+				t.Errorf("replayed headers = %v", w.Header())
+			}
+			if calls.Load() != tt.calls {
+				t.Errorf("handler called %d times, want %d", calls.Load(), tt.calls)
+			}
+		})
+	}
+
+	// The key of a server error is released once the handler has returned
+	deadline := time.Now().Add(time.Second)
+	for {
+		var count int64
+		database.DB.Model(&Record{}).Where("idempotency_key = ?", RecordKey("ip:192.0.2.1", "k2")).Count(&count)
+		if count == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the key of a server error was not released")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestMiddlewareInProgress(t *testing.T) {
+	openDB(t)
+	started, finish := make(chan struct{}), make(chan struct{})
+	handler := Middleware(Config{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-finish
+		w.WriteHeader(http.StatusCreated)
+	}))
+	request := func() *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader(`{}`))
+		r.Header.Set(Header, "k")
+		return r
+	}
+
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), request())
+		close(done)
+	}()
+	<-started
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, request())
+	if w.Code != http.StatusConflict {
+		t.Errorf("status while the key is processed = %d, want 409", w.Code)
+	}
+
+	close(finish)
+	<-done
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, request())
+	if w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("status once processed = %d, replayed %q, want a replayed 201", w.Code, w.Header().Get("Idempotent-Replayed"))
+	}
+}
+
+func TestReplayUnreadableHeader(t *testing.T) {
+	db := openDB(t)
+	r := httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader(`{}`))
+	r.Header.Set(Header, "k")
+	now := time.Now()
+	db.Create(&Record{
+		Key:         RecordKey(ratelimit.ByIP(r), "k"),
+		Fingerprint: Fingerprint(r, []byte(`{}`)),
+		Status:      http.StatusCreated,
+		Header:      "not json",
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(time.Hour),
+	})
+
+	w := httptest.NewRecorder()
+	Middleware(Config{})(http.NotFoundHandler()).ServeHTTP(w, r)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	base := httptest.NewRequest(http.MethodPost, "/api/users?x=1", nil)
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		same   bool
+	}{
+		{"same request", http.MethodPost, "/api/users?x=1", "{}", true},
+		{"other method", http.MethodPatch, "/api/users?x=1", "{}", false},
+		{"other path", http.MethodPost, "/api/posts?x=1", "{}", false},
+		{"other query", http.MethodPost, "/api/users?x=2", "{}", false},
+		{"other body", http.MethodPost, "/api/users?x=1", "[]", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.target, nil)
+		if same := Fingerprint(r, []byte(tt.body)) == Fingerprint(base, []byte("{}")); same != tt.same {
+			t.Errorf("%s: same fingerprint = %v, want %v", tt.name, same, tt.same)
+		}
+	}
+
+	if RecordKey("ip:192.0.2.1", "k") == RecordKey("ip:192.0.2.2", "k") {
+		t.Error("the record keys of two clients are equal")
+	}
+}
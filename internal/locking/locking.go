@@ -0,0 +1,111 @@
+package locking
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"went-framework/internal/handlers"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrConflict is returned when the row was modified since it was loaded
+	ErrConflict = handlers.Conflict("Resource was modified by another request")
+	// ErrPreconditionFailed is returned when If-Match does not match the current ETag
+	ErrPreconditionFailed = handlers.PreconditionFailed("If-Match does not match the current version")
+)
+
+// Versioned is implemented by models with an optimistic locking version column
+type Versioned interface {
+	GetVersion() uint
+	SetVersion(version uint)
+}
+
+// Versioning adds an optimistic locking version column when embedded in a model
+type Versioning struct {
+	Version uint `json:"version" gorm:"not null;default:1"`
+}
+
+// GetVersion returns the current version
+func (v *Versioning) GetVersion() uint {
+	return v.Version
+}
+
+// SetVersion sets the version
+func (v *Versioning) SetVersion(version uint) {
+	v.Version = version
+}
+
+// ETag returns the strong entity tag for a model version
+func ETag(model Versioned) string {
+	return fmt.Sprintf(`"%d"`, model.GetVersion())
+}
+
+// CheckIfMatch validates the If-Match header against the model's current ETag.
+// A missing header passes; use RequireIfMatch to make it mandatory.
+func CheckIfMatch(r *http.Request, model Versioned) error {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return nil
+	}
+
+	etag := ETag(model)
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return nil
+		}
+	}
+
+	return ErrPreconditionFailed
+}
+
+// Save updates all fields of the model if its version is unchanged in the database,
+// and increments the version. ErrConflict is returned when another write won.
+func Save(db *gorm.DB, model Versioned) error {
+	version := model.GetVersion()
+	model.SetVersion(version + 1)
+
+	result := db.Model(model).Where("version = ?", version).Select("*").Omit(clause.Associations).Updates(model)
+	if result.Error == nil && result.RowsAffected == 0 {
+		result.Error = ErrConflict
+	}
+
+	if result.Error != nil {
+		model.SetVersion(version)
+		return result.Error
+	}
+
+	return nil
+}
+
+// Delete deletes the model if its version is unchanged in the database
+func Delete(db *gorm.DB, model Versioned) error {
+	result := db.Where("version = ?", model.GetVersion()).Delete(model)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+// RequireIfMatch rejects PUT, PATCH and DELETE requests without an If-Match header
+// with 428 Precondition Required. Apply it to routes that must not lose updates.
+func RequireIfMatch(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut, http.MethodPatch, http.MethodDelete:
+			if r.Header.Get("If-Match") == "" {
+				handlers.RespondError(w, r, handlers.NewError(http.StatusPreconditionRequired,
+					handlers.CodePreconditionRequired, "This request requires an If-Match header"))
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,6 +11,8 @@ import (
 	"strings"
 	"time"
 	"went-framework/app/database"
+	"went-framework/internal/query"
+	"went-framework/internal/requestid"
 )
 
 // LogLevel represents the severity of a log entry
@@ -246,6 +249,48 @@ func Error(message string, context ...map[string]interface{}) {
 	}
 }
 
+// Logging functions with a context
+
+// DebugContext logs a debug message with the request ID of ctx
+func DebugContext(ctx context.Context, message string, context ...map[string]interface{}) {
+	Debug(message, withRequestID(ctx, context))
+}
+
+// InfoContext logs an info message with the request ID of ctx
+func InfoContext(ctx context.Context, message string, context ...map[string]interface{}) {
+	Info(message, withRequestID(ctx, context))
+}
+
+// WarnContext logs a warning message with the request ID of ctx
+func WarnContext(ctx context.Context, message string, context ...map[string]interface{}) {
+	Warn(message, withRequestID(ctx, context))
+}
+
+// ErrorContext logs an error message with the request ID of ctx
+func ErrorContext(ctx context.Context, message string, context ...map[string]interface{}) {
+	Error(message, withRequestID(ctx, context))
+}
+
+// withRequestID returns a copy of the log context with the request ID of ctx,
+// unless the context sets request_id itself
+func withRequestID(ctx context.Context, context []map[string]interface{}) map[string]interface{} {
+	fields := make(map[string]interface{})
+	if len(context) > 0 {
+		for key, value := range context[0] {
+			fields[key] = value
+		}
+	}
+	if id, ok := requestid.FromContext(ctx); ok {
+		if _, set := fields["request_id"]; !set {
+			fields["request_id"] = id
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
 // Convenience functions with formatting
 
 // Debugf logs a formatted debug message
@@ -315,6 +360,32 @@ func GetLogs(limit int, level LogLevel) ([]LogEntry, error) {
 	return logs, err
 }
 
+// GetLogsPage retrieves a page of logs newest first using keyset pagination.
+// Pass an empty cursor for the first page, then the returned next/prev cursors.
+func GetLogsPage(cursor string, limit int, level LogLevel) ([]LogEntry, *query.CursorPage, error) {
+	if database.DB == nil {
+		return nil, nil, fmt.Errorf("database not available")
+	}
+
+	if limit <= 0 || limit > query.MaxPerPage {
+		limit = query.MaxPerPage
+	}
+
+	keyset, err := query.NewKeyset("timestamp", true, limit, cursor)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	db := database.DB
+	if level != "" {
+		db = db.Where("level = ?", string(level))
+	}
+
+	var logs []LogEntry
+	page, err := keyset.Paginate(db, &logs)
+	return logs, page, err
+}
+
 // getEnv helper function
 func getEnv(key, fallback string) string {
 	if value := os.Getenv(key); value != "" {
@@ -0,0 +1,172 @@
+package middleware
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"went-framework/internal/httpcache"
+)
+
+// CacheConfig configures HTTP caching
+type CacheConfig struct {
+	// CacheControl is the Cache-Control header of GET responses, unless a
+	// route policy or the handler sets another one
+	CacheControl string
+	// WeakETags tags response bodies with weak instead of strong ETags
+	WeakETags bool
+}
+
+// DefaultCacheConfig lets clients keep API responses but revalidate them on
+// every use, which the ETags make cheap
+func DefaultCacheConfig() CacheConfig {
+	return CacheConfig{CacheControl: "private, no-cache"}
+}
+
+// Cache handles conditional GET requests: successful GET and HEAD responses
+// without an ETag are tagged from their body, and answered with 304 Not
+// Modified when If-None-Match matches their ETag or, without it, when they are
+// unchanged since If-Modified-Since according to their Last-Modified header.
+// Routes declare Cache-Control policies with Route.
+type Cache struct {
+	config   CacheConfig
+	policies []cachePolicy
+}
+
+// cachePolicy is the Cache-Control header of the routes matching a pattern
+type cachePolicy struct {
+	pattern      routePattern
+	cacheControl string
+}
+
+// NewCache returns caching middleware applying config to all routes
+func NewCache(config CacheConfig) *Cache {
+	return &Cache{config: config}
+}
+
+// Route sets the Cache-Control header of the GET routes matching pattern, e.g.
+// "/swagger.json" or "/api/*/users/{id}/posts", see routePattern. The first
+// matching policy wins.
+func (c *Cache) Route(pattern, cacheControl string) *Cache {
+	c.policies = append(c.policies, cachePolicy{pattern: parseRoutePattern(pattern), cacheControl: cacheControl})
+	return c
+}
+
+// cacheControlFor returns the Cache-Control header of the route matched by a request
+func (c *Cache) cacheControlFor(r *http.Request) string {
+	for _, policy := range c.policies {
+		if policy.pattern.matches(r) {
+			return policy.cacheControl
+		}
+	}
+	return c.config.CacheControl
+}
+
+// Middleware applies the caching policy. Responses are held back until the
+// handler returns to tag them, except for streaming handlers, whose responses
+// are sent as is from their first flush.
+func (c *Cache) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if cacheControl := c.cacheControlFor(r); cacheControl != "" {
+			w.Header().Set("Cache-Control", cacheControl)
+		}
+
+		cw := &cacheWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(cw, r)
+		if cw.passthrough {
+			return
+		}
+
+		header := w.Header()
+		if cw.status == http.StatusOK {
+			etag := header.Get("ETag")
+			if etag == "" && len(cw.body) > 0 {
+				etag = httpcache.StrongETag(cw.body)
+				if c.config.WeakETags {
+					etag = httpcache.WeakETag(cw.body)
+				}
+				header.Set("ETag", etag)
+			}
+
+			modified, _ := http.ParseTime(header.Get("Last-Modified"))
+			if httpcache.NotModified(r, etag, modified) {
+				httpcache.WriteNotModified(w)
+				return
+			}
+		}
+
+		w.WriteHeader(cw.status)
+		w.Write(cw.body)
+	})
+}
+
+// cacheWriter holds a response back until the handler returns
+type cacheWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        []byte
+	// passthrough is set once the response is sent as is
+	passthrough bool
+}
+
+func (cw *cacheWriter) WriteHeader(code int) {
+	if cw.passthrough {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	// Informational responses are sent right away, the final one is held back
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if !cw.wroteHeader {
+		cw.status = code
+		cw.wroteHeader = true
+	}
+}
+
+func (cw *cacheWriter) Write(b []byte) (int, error) {
+	if cw.passthrough {
+		return cw.ResponseWriter.Write(b)
+	}
+	cw.wroteHeader = true
+	cw.body = append(cw.body, b...)
+	return len(b), nil
+}
+
+// Flush sends the response as is from now on, for streaming handlers
+func (cw *cacheWriter) Flush() {
+	if !cw.passthrough {
+		cw.passthrough = true
+		cw.ResponseWriter.WriteHeader(cw.status)
+		cw.ResponseWriter.Write(cw.body)
+		cw.body = nil
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack lets handlers take over the connection, e.g. for WebSockets
+func (cw *cacheWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("the response writer does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		cw.passthrough = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (cw *cacheWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
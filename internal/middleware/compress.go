@@ -0,0 +1,369 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressionConfig configures response compression
+type CompressionConfig struct {
+	// Encodings lists the supported content codings, gzip, deflate and zstd,
+	// in order of preference when the client accepts several equally
+	Encodings []string
+	// MinSize is the minimum size of a response body worth compressing.
+	// Streamed responses are compressed once flushed, whatever their size.
+	MinSize int
+	// ContentTypes lists the compressed media types. Entries ending with /
+	// match a whole type, e.g. text/.
+	ContentTypes []string
+}
+
+// DefaultCompressionConfig compresses text, JSON, XML and JavaScript responses
+// of 1 KB or more with gzip or deflate
+func DefaultCompressionConfig() CompressionConfig {
+	return CompressionConfig{
+		Encodings: []string{"gzip", "deflate"},
+		MinSize:   1024,
+		ContentTypes: []string{
+			"text/",
+			"application/json",
+			"application/problem+json",
+			"application/x-ndjson",
+			"application/xml",
+			"application/javascript",
+			"application/yaml",
+			"image/svg+xml",
+		},
+	}
+}
+
+// CompressionConfigFromEnv returns the default config overridden by
+// COMPRESSION_ENCODINGS (a comma separated list, e.g. zstd,gzip,deflate, or off)
+// and COMPRESSION_MIN_SIZE (in bytes)
+func CompressionConfigFromEnv() CompressionConfig {
+	config := DefaultCompressionConfig()
+
+	if value := os.Getenv("COMPRESSION_ENCODINGS"); value == "off" {
+		config.Encodings = nil
+	} else if value != "" {
+		config.Encodings = nil
+		for _, encoding := range strings.Split(value, ",") {
+			if encoding = strings.ToLower(strings.TrimSpace(encoding)); encoding != "" {
+				config.Encodings = append(config.Encodings, encoding)
+			}
+		}
+	}
+	if value, err := strconv.Atoi(os.Getenv("COMPRESSION_MIN_SIZE")); err == nil && value >= 0 {
+		config.MinSize = value
+	}
+
+	return config
+}
+
+// compressedTypes are media types that are compressed already, and are never
+// compressed again even when the allowlist matches them
+var compressedTypes = map[string]bool{
+	"application/gzip":             true,
+	"application/zip":              true,
+	"application/zstd":             true,
+	"application/x-bzip2":          true,
+	"application/x-7z-compressed":  true,
+	"application/x-rar-compressed": true,
+	"application/pdf":              true,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": true,
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+	"image/avif": true,
+	"font/woff":  true,
+	"font/woff2": true,
+}
+
+// encoder is a compressing writer that can be reused with Reset
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// encoderPools reuse the encoders of each content coding
+var encoderPools = map[string]*sync.Pool{
+	"gzip": {New: func() interface{} {
+		return gzip.NewWriter(nil)
+	}},
+	"deflate": {New: func() interface{} {
+		// The deflate content coding is the zlib format, see RFC 9110
+		return zlib.NewWriter(nil)
+	}},
+	"zstd": {New: func() interface{} {
+		encoder, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return encoder
+	}},
+}
+
+// Compression compresses responses with the content coding negotiated from
+// Accept-Encoding. Responses smaller than MinSize, of a media type outside the
+// allowlist or already compressed, with a Content-Encoding set by the handler,
+// partial content and responses without a body are sent as is. Streaming
+// handlers may flush at any time. Strong ETags are made weak, as the
+// compressed body differs from the one they identify. Invalid encodings are
+// programming errors and panic.
+func Compression(config CompressionConfig) func(http.Handler) http.Handler {
+	for _, encoding := range config.Encodings {
+		if encoderPools[encoding] == nil {
+			panic(fmt.Sprintf("unsupported content coding %q, use gzip, deflate or zstd", encoding))
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(config.Encodings) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Accept-Encoding")
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), config.Encodings)
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, config: config, encoding: encoding, status: http.StatusOK}
+			defer func() {
+				// After a panic nothing is sent, so Recovery further out can
+				// answer, and a started response is not made to look complete
+				if recovered := recover(); recovered != nil {
+					cw.release()
+					panic(recovered)
+				}
+				cw.close()
+			}()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiateEncoding returns the supported encoding with the highest quality in
+// an Accept-Encoding header, preferring the earliest supported one on ties, or
+// "" when the response must not be compressed
+func negotiateEncoding(header string, supported []string) string {
+	if header == "" {
+		return ""
+	}
+
+	qualities := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if q, err := strconv.ParseFloat(value, 64); err == nil {
+				quality = q
+			}
+		}
+		if name == "x-gzip" {
+			name = "gzip"
+		}
+		qualities[name] = quality
+	}
+
+	best, bestQuality := "", 0.0
+	for _, encoding := range supported {
+		quality, ok := qualities[encoding]
+		if !ok {
+			quality, ok = qualities["*"]
+		}
+		if ok && quality > bestQuality {
+			best, bestQuality = encoding, quality
+		}
+	}
+	return best
+}
+
+// compressWriter holds the start of a response back until it knows whether to
+// compress it: once MinSize bytes are written, the handler flushes, or the
+// response ends
+type compressWriter struct {
+	http.ResponseWriter
+	config   CompressionConfig
+	encoding string
+	status   int
+	buffer   []byte
+	// decided is set once the headers are sent, encoder when compressing
+	decided bool
+	encoder encoder
+	// hijacked connections are not written by the middleware anymore
+	hijacked bool
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.decided || cw.hijacked {
+		return
+	}
+	// Informational responses are sent right away, the final one is held back
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	cw.status = code
+	if !bodyAllowed(code) {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.decided {
+		cw.buffer = append(cw.buffer, b...)
+		if len(cw.buffer) < cw.config.MinSize {
+			return len(b), nil
+		}
+		cw.decide(true)
+		return len(b), cw.writeBuffer()
+	}
+	if cw.encoder != nil {
+		return cw.encoder.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush sends what is written so far to the client, for streaming handlers
+func (cw *compressWriter) Flush() {
+	if cw.hijacked {
+		return
+	}
+	if !cw.decided {
+		cw.decide(true)
+		cw.writeBuffer()
+	}
+	if cw.encoder != nil {
+		cw.encoder.Flush()
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack lets handlers take over the connection, e.g. for WebSockets
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("the response writer does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		cw.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// decide sends the headers, compressing the body if allowed. enough is whether
+// the body is large enough or streamed.
+func (cw *compressWriter) decide(enough bool) {
+	cw.decided = true
+	header := cw.Header()
+
+	if header.Get("Content-Type") == "" && len(cw.buffer) > 0 {
+		// Sniff now, net/http would do it from the compressed body otherwise
+		header.Set("Content-Type", http.DetectContentType(cw.buffer))
+	}
+
+	if enough && cw.compressible() {
+		header.Set("Content-Encoding", cw.encoding)
+		header.Del("Content-Length")
+		header.Del("Accept-Ranges")
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+
+		cw.encoder = encoderPools[cw.encoding].Get().(encoder)
+		cw.encoder.Reset(cw.ResponseWriter)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+}
+
+// compressible reports whether the response may be compressed
+func (cw *compressWriter) compressible() bool {
+	header := cw.Header()
+	if !bodyAllowed(cw.status) || cw.status == http.StatusPartialContent {
+		return false
+	}
+	if header.Get("Content-Encoding") != "" || header.Get("Content-Range") != "" {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil || compressedTypes[mediaType] {
+		return false
+	}
+	for _, allowed := range cw.config.ContentTypes {
+		if mediaType == allowed || (strings.HasSuffix(allowed, "/") && strings.HasPrefix(mediaType, allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeBuffer writes the held back start of the body
+func (cw *compressWriter) writeBuffer() error {
+	if len(cw.buffer) == 0 {
+		return nil
+	}
+	buffer := cw.buffer
+	cw.buffer = nil
+	if cw.encoder != nil {
+		_, err := cw.encoder.Write(buffer)
+		return err
+	}
+	_, err := cw.ResponseWriter.Write(buffer)
+	return err
+}
+
+// close ends the response, deciding on short bodies and finishing the
+// compressed stream
+func (cw *compressWriter) close() {
+	if cw.hijacked {
+		return
+	}
+	if !cw.decided {
+		cw.decide(len(cw.buffer) >= cw.config.MinSize && len(cw.buffer) > 0)
+		cw.writeBuffer()
+	}
+	if cw.encoder != nil {
+		cw.encoder.Close()
+	}
+	cw.release()
+}
+
+// release returns the encoder to its pool
+func (cw *compressWriter) release() {
+	if cw.encoder != nil {
+		cw.encoder.Reset(nil)
+		encoderPools[cw.encoding].Put(cw.encoder)
+		cw.encoder = nil
+	}
+}
+
+// bodyAllowed reports whether a response status may have a body
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
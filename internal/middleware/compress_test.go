@@ -0,0 +1,212 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	supported := []string{"gzip", "deflate"}
+
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"deflate", "deflate"},
+		{"deflate, gzip", "gzip"},
+		{"gzip;q=0.5, deflate", "deflate"},
+		{"GZIP", "gzip"},
+		{"x-gzip", "gzip"},
+		{"br", ""},
+		{"identity", ""},
+		{"*", "gzip"},
+		{"*;q=0.2, gzip;q=0", "deflate"},
+		{"gzip;q=0", ""},
+		{"gzip; q=0.8, deflate;q=0.9", "deflate"},
+	}
+	for _, tt := range tests {
+		if got := negotiateEncoding(tt.header, supported); got != tt.want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestCompression(t *testing.T) {
+	large := strings.Repeat(`{"name":"Ada"}`, 200)
+	config := DefaultCompressionConfig()
+	config.Encodings = []string{"zstd", "gzip"}
+
+	tests := []struct {
+		name           string
+		method         string
+		acceptEncoding string
+		handler        http.HandlerFunc
+		encoding       string
+		etag           string
+	}{
+		{
+			name:           "gzip",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("ETag", `"v1"`)
+				io.WriteString(w, large)
+			},
+			encoding: "gzip",
+			etag:     `W/"v1"`,
+		},
+		{
+			name:           "zstd preferred on ties",
+			acceptEncoding: "gzip, zstd",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				io.WriteString(w, large)
+			},
+			encoding: "zstd",
+		},
+		{
+			name:           "not accepted",
+			acceptEncoding: "br",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				io.WriteString(w, large)
+			},
+		},
+		{
+			name:           "small body",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("ETag", `"v1"`)
+				io.WriteString(w, `{"name":"Ada"}`)
+			},
+			etag: `"v1"`,
+		},
+		{
+			name:           "media type not in the allowlist",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "image/png")
+				io.WriteString(w, large)
+			},
+		},
+		{
+			name:           "already encoded",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Content-Encoding", "br")
+				io.WriteString(w, large)
+			},
+			encoding: "br",
+		},
+		{
+			name:           "partial content",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.WriteHeader(http.StatusPartialContent)
+				io.WriteString(w, large)
+			},
+		},
+		{
+			name:           "streamed",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/x-ndjson")
+				io.WriteString(w, "{}\n")
+				w.(http.Flusher).Flush()
+				io.WriteString(w, "{}\n")
+			},
+			encoding: "gzip",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			w := httptest.NewRecorder()
+			Compression(config)(tt.handler).ServeHTTP(w, r)
+
+			if got := w.Header().Get("Content-Encoding"); got != tt.encoding {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.encoding)
+			}
+			if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Vary = %q, want Accept-Encoding", got)
+			}
+			if tt.etag != "" && w.Header().Get("ETag") != tt.etag {
+				t.Errorf("ETag = %q, want %q", w.Header().Get("ETag"), tt.etag)
+			}
+
+			var body io.Reader = w.Body
+			switch tt.encoding {
+			case "gzip":
+				reader, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = reader
+			case "zstd":
+				reader, err := zstd.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer reader.Close()
+				body = reader
+			}
+			decoded, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatalf("decoding the body: %v", err)
+			}
+			if tt.name == "streamed" {
+				if string(decoded) != "{}\n{}\n" {
+					t.Errorf("body = %q", decoded)
+				}
+			} else if tt.name != "small body" && string(decoded) != large {
+				t.Errorf("body of %d bytes, want %d", len(decoded), len(large))
+			}
+		})
+	}
+}
+
+func TestCompressionPanic(t *testing.T) {
+	handler := Compression(DefaultCompressionConfig())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "partial")
+		panic("boom")
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("the panic was not passed on")
+			}
+		}()
+		handler.ServeHTTP(w, r)
+	}()
+
+	if w.Code != http.StatusOK || w.Body.Len() > 0 || w.Header().Get("Content-Encoding") != "" || w.Flushed {
+		t.Errorf("a response was sent after the panic: %d %v %q", w.Code, w.Header(), w.Body)
+	}
+}
+
+func TestCompressionUnsupportedEncoding(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("an unsupported encoding did not panic")
+		}
+	}()
+	Compression(CompressionConfig{Encodings: []string{"br"}})
+}
@@ -0,0 +1,302 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"went-framework/internal/handlers"
+)
+
+// CORSConfig is a Cross-Origin Resource Sharing policy
+type CORSConfig struct {
+	// AllowedOrigins lists the origins allowed to call the API: exact origins
+	// such as https://app.example.com, wildcard subdomains such as
+	// https://*.example.com, regular expressions starting with ^, or * for any origin
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	// ExposedHeaders lists the response headers readable by browser scripts
+	ExposedHeaders []string
+	// AllowCredentials lets browsers send cookies and Authorization. The
+	// request origin is then echoed, so it needs a list of origins instead of *.
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response
+	MaxAge time.Duration
+}
+
+// DefaultCORSConfig allows any origin without credentials, with the methods and
+// headers used by the API
+func DefaultCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+		AllowedHeaders: []string{
+			"Content-Type", "Authorization", "X-Requested-With", "X-Request-ID",
+			"Accept-Version", "If-Match", "If-None-Match", "If-Modified-Since", "Idempotency-Key", "X-API-Key",
+		},
+		ExposedHeaders: []string{
+			"ETag", "Location", "Link", "Content-Disposition", "X-Request-ID",
+			"API-Version", "Deprecation", "Sunset", "Idempotent-Replayed", "Retry-After",
+			"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset",
+		},
+		MaxAge: 10 * time.Minute,
+	}
+}
+
+// CORSConfigFromEnv returns the default policy overridden by CORS_ALLOWED_ORIGINS,
+// CORS_ALLOWED_METHODS, CORS_ALLOWED_HEADERS, CORS_EXPOSED_HEADERS (comma
+// separated lists), CORS_ALLOW_CREDENTIALS (true/false) and CORS_MAX_AGE (e.g. 10m)
+func CORSConfigFromEnv() CORSConfig {
+	config, _ := corsConfigFromEnv("CORS_", DefaultCORSConfig())
+	return config
+}
+
+// CORSGroupConfigFromEnv returns config overridden by the variables of
+// CORSConfigFromEnv prefixed with the name of a route group, e.g.
+// CORS_V2_ALLOWED_ORIGINS for v2, and whether any of them is set
+func CORSGroupConfigFromEnv(group string, config CORSConfig) (CORSConfig, bool) {
+	return corsConfigFromEnv("CORS_"+strings.ToUpper(group)+"_", config)
+}
+
+// corsConfigFromEnv overrides config with the variables starting with prefix,
+// and reports whether any of them is set
+func corsConfigFromEnv(prefix string, config CORSConfig) (CORSConfig, bool) {
+	found := false
+	lists := map[string]*[]string{
+		"ALLOWED_ORIGINS": &config.AllowedOrigins,
+		"ALLOWED_METHODS": &config.AllowedMethods,
+		"ALLOWED_HEADERS": &config.AllowedHeaders,
+		"EXPOSED_HEADERS": &config.ExposedHeaders,
+	}
+	for key, list := range lists {
+		if value := os.Getenv(prefix + key); value != "" {
+			found = true
+			*list = nil
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					*list = append(*list, item)
+				}
+			}
+		}
+	}
+
+	if value, err := strconv.ParseBool(os.Getenv(prefix + "ALLOW_CREDENTIALS")); err == nil {
+		found = true
+		config.AllowCredentials = value
+	}
+	if value, err := time.ParseDuration(os.Getenv(prefix + "MAX_AGE")); err == nil {
+		found = true
+		config.MaxAge = value
+	}
+
+	return config, found
+}
+
+// corsPolicy is a CORSConfig prepared for matching requests
+type corsPolicy struct {
+	config   CORSConfig
+	any      bool
+	exact    map[string]bool
+	patterns []*regexp.Regexp
+	methods  map[string]bool
+	headers  map[string]bool
+}
+
+// newCORSPolicy compiles the origins of a config. Invalid regular expressions,
+// and credentials allowed for any origin, are programming errors and panic.
+func newCORSPolicy(config CORSConfig) *corsPolicy {
+	p := &corsPolicy{config: config, exact: map[string]bool{}, methods: map[string]bool{}, headers: map[string]bool{}}
+
+	for _, origin := range config.AllowedOrigins {
+		switch {
+		case origin == "*":
+			p.any = true
+		case strings.HasPrefix(origin, "^"):
+			p.patterns = append(p.patterns, regexp.MustCompile(origin))
+		case strings.Contains(origin, "*"):
+			// https://*.example.com matches any subdomain, at any depth
+			pattern := "^" + strings.ReplaceAll(regexp.QuoteMeta(strings.ToLower(origin)), `\*`, `[a-z0-9-]+(\.[a-z0-9-]+)*`) + "$"
+			p.patterns = append(p.patterns, regexp.MustCompile(pattern))
+		default:
+			p.exact[strings.ToLower(origin)] = true
+		}
+	}
+	if p.any && config.AllowCredentials {
+		panic("CORS cannot allow credentials for any origin (*), list the allowed origins")
+	}
+	for _, method := range config.AllowedMethods {
+		p.methods[strings.ToUpper(method)] = true
+	}
+	for _, header := range config.AllowedHeaders {
+		p.headers[http.CanonicalHeaderKey(header)] = true
+	}
+
+	return p
+}
+
+// allows reports whether an origin may call the API
+func (p *corsPolicy) allows(origin string) bool {
+	if p.any {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if p.exact[origin] {
+		return true
+	}
+	for _, pattern := range p.patterns {
+		if pattern.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsHeaders reports whether every header of an Access-Control-Request-Headers list is allowed
+func (p *corsPolicy) allowsHeaders(list string) bool {
+	for _, header := range strings.Split(list, ",") {
+		if header = strings.TrimSpace(header); header != "" && !p.headers[http.CanonicalHeaderKey(header)] {
+			return false
+		}
+	}
+	return true
+}
+
+// CORS applies a CORS policy to the routes of a router, with overrides for
+// route groups
+type CORS struct {
+	policy *corsPolicy
+	groups []corsGroup
+	path   func(r *http.Request) string
+}
+
+// corsGroup is the policy of the routes under a path prefix
+type corsGroup struct {
+	prefix string
+	policy *corsPolicy
+}
+
+// NewCORS returns CORS middleware applying config to all routes
+func NewCORS(config CORSConfig) *CORS {
+	return &CORS{policy: newCORSPolicy(config)}
+}
+
+// Group applies config instead of the default policy to the routes under a path
+// prefix, e.g. /api/v2. The longest matching prefix wins.
+func (c *CORS) Group(prefix string, config CORSConfig) *CORS {
+	c.groups = append(c.groups, corsGroup{prefix: strings.TrimSuffix(prefix, "/"), policy: newCORSPolicy(config)})
+	sort.SliceStable(c.groups, func(i, j int) bool {
+		return len(c.groups[i].prefix) > len(c.groups[j].prefix)
+	})
+	return c
+}
+
+// Paths sets the path that groups are matched against, when a request is
+// served under another path than its own, e.g. the versioned path of an
+// unversioned API request
+func (c *CORS) Paths(path func(r *http.Request) string) *CORS {
+	c.path = path
+	return c
+}
+
+// policyFor returns the policy of a request
+func (c *CORS) policyFor(r *http.Request) *corsPolicy {
+	path := r.URL.Path
+	if c.path != nil {
+		path = c.path(r)
+	}
+	for _, group := range c.groups {
+		if path == group.prefix || strings.HasPrefix(path, group.prefix+"/") {
+			return group.policy
+		}
+	}
+	return c.policy
+}
+
+// Middleware answers preflight requests and adds the CORS headers of allowed
+// origins to responses. Preflights from disallowed origins, or asking for a
+// method or header that is not allowed, get 403 Forbidden; other requests from
+// disallowed origins are served without CORS headers, so browsers block them.
+// Preflights only reach the middleware for routes accepting OPTIONS, see Preflight.
+func (c *CORS) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy := c.policyFor(r)
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		// Responses depend on the Origin unless every origin gets the same *
+		if !policy.any {
+			w.Header().Add("Vary", "Origin")
+		}
+		if preflight {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !policy.allows(origin) {
+			if preflight {
+				handlers.RespondError(w, r, handlers.NewError(http.StatusForbidden, handlers.CodeForbidden,
+					fmt.Sprintf("Origin %s is not allowed", origin)))
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if policy.any {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		if policy.config.AllowCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if len(policy.config.ExposedHeaders) > 0 {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(policy.config.ExposedHeaders, ", "))
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+		if !policy.methods[method] {
+			handlers.RespondError(w, r, handlers.NewError(http.StatusForbidden, handlers.CodeForbidden,
+				fmt.Sprintf("Method %s is not allowed", method)))
+			return
+		}
+		if requested := r.Header.Get("Access-Control-Request-Headers"); !policy.allowsHeaders(requested) {
+			handlers.RespondError(w, r, handlers.NewError(http.StatusForbidden, handlers.CodeForbidden,
+				fmt.Sprintf("Headers %s are not all allowed", requested)))
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(policy.config.AllowedMethods, ", "))
+		if len(policy.config.AllowedHeaders) > 0 {
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(policy.config.AllowedHeaders, ", "))
+		}
+		if policy.config.MaxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(policy.config.MaxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// Preflight answers OPTIONS requests with 204 No Content. Register it for
+// OPTIONS on every path, so preflight requests match a route and reach the
+// CORS middleware, with a matcher rather than Methods, which would answer
+// requests to unknown paths with 405 Method Not Allowed:
+// router.MatcherFunc(func(r *http.Request, _ *mux.RouteMatch) bool { return r.Method == http.MethodOptions })
+func Preflight(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,230 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCORSOrigins(t *testing.T) {
+	policy := newCORSPolicy(CORSConfig{AllowedOrigins: []string{
+		"https://app.example.com",
+		"https://*.example.org",
+		`^https://preview-\d+\.example\.net$`,
+	}})
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://app.example.com", true},
+		{"HTTPS://APP.EXAMPLE.COM", true},
+		{"http://app.example.com", false},
+		{"https://app.example.com.evil.com", false},
+		{"https://a.example.org", true},
+		{"https://a.b.example.org", true},
+		{"https://example.org", false},
+		{"https://a.example.org.evil.com", false},
+		{"https://evil.com/.example.org", false},
+		{"https://preview-42.example.net", true},
+		{"https://preview-x.example.net", false},
+		{"null", false},
+	}
+	for _, tt := range tests {
+		if got := policy.allows(tt.origin); got != tt.want {
+			t.Errorf("allows(%q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestCORSCredentialsForAnyOrigin(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("credentials for any origin did not panic")
+		}
+	}()
+	NewCORS(CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true})
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	config := CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com"},
+		AllowedMethods:   []string{"GET", "POST"},
+		AllowedHeaders:   []string{"Content-Type", "X-Request-ID"},
+		ExposedHeaders:   []string{"ETag"},
+		AllowCredentials: true,
+		MaxAge:           time.Minute,
+	}
+	admin := DefaultCORSConfig()
+	admin.AllowedOrigins = []string{"https://admin.example.com"}
+	cors := NewCORS(config).Group("/api/admin/", admin)
+	handler := cors.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string]string
+		status  int
+		want    map[string]string
+	}{
+		{
+			name:   "same origin request",
+			method: http.MethodGet,
+			path:   "/api/users",
+			status: http.StatusOK,
+			want:   map[string]string{"Access-Control-Allow-Origin": "", "Vary": "Origin"},
+		},
+		{
+			name:    "allowed origin",
+			method:  http.MethodGet,
+			path:    "/api/users",
+			headers: map[string]string{"Origin": "https://app.example.com"},
+			status:  http.StatusOK,
+			want: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    "ETag",
+			},
+		},
+		{
+			name:    "disallowed origin is served without CORS headers",
+			method:  http.MethodGet,
+			path:    "/api/users",
+			headers: map[string]string{"Origin": "https://evil.com"},
+			status:  http.StatusOK,
+			want:    map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:   "preflight",
+			method: http.MethodOptions,
+			path:   "/api/users",
+			headers: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  "post",
+				"Access-Control-Request-Headers": "content-type, x-request-id",
+			},
+			status: http.StatusNoContent,
+			want: map[string]string{
+				"Access-Control-Allow-Origin":  "https://app.example.com",
+				"Access-Control-Allow-Methods": "GET, POST",
+				"Access-Control-Allow-Headers": "Content-Type, X-Request-ID",
+				"Access-Control-Max-Age":       "60",
+			},
+		},
+		{
+			name:   "preflight from a disallowed origin",
+			method: http.MethodOptions,
+			path:   "/api/users",
+			headers: map[string]string{
+				"Origin":                        "https://evil.com",
+				"Access-Control-Request-Method": "GET",
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "preflight of a disallowed method",
+			method: http.MethodOptions,
+			path:   "/api/users",
+			headers: map[string]string{
+				"Origin":                        "https://app.example.com",
+				"Access-Control-Request-Method": "DELETE",
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "preflight of a disallowed header",
+			method: http.MethodOptions,
+			path:   "/api/users",
+			headers: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  "GET",
+				"Access-Control-Request-Headers": "X-Secret",
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name:    "group policy",
+			method:  http.MethodGet,
+			path:    "/api/admin/users",
+			headers: map[string]string{"Origin": "https://admin.example.com"},
+			status:  http.StatusOK,
+			want:    map[string]string{"Access-Control-Allow-Origin": "https://admin.example.com"},
+		},
+		{
+			name:    "group policy replaces the default",
+			method:  http.MethodGet,
+			path:    "/api/admin",
+			headers: map[string]string{"Origin": "https://app.example.com"},
+			status:  http.StatusOK,
+			want:    map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:    "group prefix matches whole segments",
+			method:  http.MethodGet,
+			path:    "/api/administrators",
+			headers: map[string]string{"Origin": "https://app.example.com"},
+			status:  http.StatusOK,
+			want:    map[string]string{"Access-Control-Allow-Origin": "https://app.example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			for name, want := range tt.want {
+				if got := strings.Join(w.Header().Values(name), ", "); !strings.HasPrefix(got, want) || want == "" && got != "" {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCORSPaths(t *testing.T) {
+	v1 := DefaultCORSConfig()
+	v1.AllowedOrigins = []string{"https://legacy.example.com"}
+	cors := NewCORS(CORSConfig{AllowedOrigins: []string{"https://app.example.com"}}).
+		Group("/api/v1", v1).
+		Paths(func(r *http.Request) string {
+			return strings.Replace(r.URL.Path, "/api/", "/api/v1/", 1)
+		})
+	handler := cors.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	r := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+	r.Header.Set("Origin", "https://legacy.example.com")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://legacy.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want the policy of the resolved path", got)
+	}
+}
+
+func TestCORSGroupConfigFromEnv(t *testing.T) {
+	t.Setenv("CORS_V2_ALLOWED_ORIGINS", "https://a.example.com, https://b.example.com")
+	t.Setenv("CORS_V2_MAX_AGE", "1h")
+
+	config, ok := CORSGroupConfigFromEnv("v2", DefaultCORSConfig())
+	if !ok {
+		t.Fatal("group config not found")
+	}
+	if strings.Join(config.AllowedOrigins, " ") != "https://a.example.com https://b.example.com" || config.MaxAge != time.Hour {
+		t.Errorf("config = %+v", config)
+	}
+	if _, ok := CORSGroupConfigFromEnv("v3", DefaultCORSConfig()); ok {
+		t.Error("group config found without variables")
+	}
+}
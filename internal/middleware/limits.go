@@ -0,0 +1,353 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"went-framework/internal/handlers"
+
+	"github.com/gorilla/mux"
+)
+
+// Limits are the resource limits of a route. In overrides, zero fields keep the
+// default and negative ones remove the limit.
+type Limits struct {
+	// MaxBodySize is the maximum size of a request body in bytes
+	MaxBodySize int64
+	// Timeout is the time a handler has to respond before its context is cancelled
+	Timeout time.Duration
+}
+
+// DefaultLimits allows 1 MB request bodies and 30 seconds per request
+func DefaultLimits() Limits {
+	return Limits{MaxBodySize: 1 << 20, Timeout: 30 * time.Second}
+}
+
+// LimitsFromEnv returns the default limits overridden by MAX_BODY_SIZE (bytes,
+// or with a KB, MB or GB suffix) and REQUEST_TIMEOUT (e.g. 30s)
+func LimitsFromEnv() Limits {
+	limits := DefaultLimits()
+	if value := os.Getenv("MAX_BODY_SIZE"); value != "" {
+		size, err := ParseSize(value)
+		if err != nil {
+			panic(fmt.Sprintf("MAX_BODY_SIZE: %v", err))
+		}
+		limits.MaxBodySize = size
+	}
+	if value, err := time.ParseDuration(os.Getenv("REQUEST_TIMEOUT")); err == nil {
+		limits.Timeout = value
+	}
+	return limits
+}
+
+// ParseSize parses a size in bytes such as 512, 64KB, 10MB or 1GB
+func ParseSize(value string) (int64, error) {
+	units := []struct {
+		suffix string
+		bytes  int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+
+	number, multiplier := strings.ToUpper(strings.TrimSpace(value)), int64(1)
+	for _, unit := range units {
+		if trimmed, ok := strings.CutSuffix(number, unit.suffix); ok {
+			number, multiplier = strings.TrimSpace(trimmed), unit.bytes
+			break
+		}
+	}
+	size, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid size %q, use bytes or a KB, MB or GB suffix", value)
+	}
+	return size * multiplier, nil
+}
+
+// RouteLimits applies limits to the routes of a router, with overrides for
+// routes matching a pattern
+type RouteLimits struct {
+	defaults  Limits
+	overrides []limitsOverride
+}
+
+// limitsOverride are the limits of the routes matching a pattern
+type limitsOverride struct {
+	pattern routePattern
+	limits  Limits
+}
+
+// NewRouteLimits returns limits applying defaults to all routes
+func NewRouteLimits(defaults Limits) *RouteLimits {
+	return &RouteLimits{defaults: defaults}
+}
+
+// Route overrides the limits of the routes matching pattern, e.g.
+// "POST /api/*/users/import" or "/api/*/*/export", see routePattern. The first
+// matching override wins.
+func (l *RouteLimits) Route(pattern string, limits Limits) *RouteLimits {
+	l.overrides = append(l.overrides, limitsOverride{pattern: parseRoutePattern(pattern), limits: limits})
+	return l
+}
+
+// limitsFor returns the limits of the route matched by a request
+func (l *RouteLimits) limitsFor(r *http.Request) Limits {
+	limits := l.defaults
+	for _, override := range l.overrides {
+		if !override.pattern.matches(r) {
+			continue
+		}
+		if override.limits.MaxBodySize != 0 {
+			limits.MaxBodySize = override.limits.MaxBodySize
+		}
+		if override.limits.Timeout != 0 {
+			limits.Timeout = override.limits.Timeout
+		}
+		break
+	}
+	return limits
+}
+
+// routePattern selects routes by a glob on their mux path template, where *
+// matches one path segment, optionally preceded by a method: "GET /api/*/users"
+type routePattern struct {
+	method string
+	path   string
+}
+
+// parseRoutePattern parses a route pattern. Invalid patterns are programming
+// errors and panic.
+func parseRoutePattern(pattern string) routePattern {
+	parsed := routePattern{path: pattern}
+	if method, rest, ok := strings.Cut(pattern, " "); ok {
+		parsed.method, parsed.path = strings.ToUpper(method), strings.TrimSpace(rest)
+	}
+	if _, err := path.Match(parsed.path, ""); err != nil {
+		panic(fmt.Sprintf("invalid route pattern %q: %v", pattern, err))
+	}
+	return parsed
+}
+
+// matches reports whether the route matched by a request is selected
+func (p routePattern) matches(r *http.Request) bool {
+	if p.method != "" && p.method != r.Method {
+		return false
+	}
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return false
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return false
+	}
+	matched, _ := path.Match(p.path, template)
+	return matched
+}
+
+// BodyLimit rejects request bodies over the MaxBodySize of their route with
+// 413 Request Entity Too Large. Bodies announcing a larger Content-Length are
+// rejected right away, others fail once the limit is read: handlers map the
+// *http.MaxBytesError with handlers.FromError or handlers.ReadError. It must
+// run before any middleware reading the body.
+func (l *RouteLimits) BodyLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := l.limitsFor(r).MaxBodySize
+		if limit <= 0 || r.Body == nil || r.Body == http.NoBody {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.ContentLength > limit {
+			handlers.RespondError(w, r, handlers.FromError(&http.MaxBytesError{Limit: limit}))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handlerKey is the context key of the handlers tracked by WaitHandler
+type handlerKey struct{}
+
+// WaitHandler returns the request with its handler tracked, and a function
+// blocking until that handler has returned. Deadline answers in place of
+// handlers that are too slow while they keep running, so outer middleware
+// acting on a timeout, such as releasing an idempotency key, waits for the
+// handler first.
+func WaitHandler(r *http.Request) (*http.Request, func()) {
+	running := new(sync.WaitGroup)
+	return r.WithContext(context.WithValue(r.Context(), handlerKey{}, running)), running.Wait
+}
+
+// Deadline cancels the request context once the Timeout of the route is over,
+// so database queries of the handler stop. When the handler has not responded
+// by then, the middleware answers 503 Service Unavailable in its place and
+// drops what the handler writes later; responses that have started, such as
+// streamed exports, are left to finish. Handlers with shorter deadlines of
+// their own respond 504 Gateway Timeout through handlers.RespondError. Panics
+// of the handler are passed on to the outer middleware, e.g. Recovery. See
+// WaitHandler to wait for handlers still running after a timeout.
+func (l *RouteLimits) Deadline(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeout := l.limitsFor(r).Timeout
+		if timeout <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+
+		tw := &timeoutWriter{ResponseWriter: w, header: w.Header().Clone()}
+		done := make(chan struct{})
+		panicked := make(chan interface{}, 1)
+		running, _ := r.Context().Value(handlerKey{}).(*sync.WaitGroup)
+		if running != nil {
+			running.Add(1)
+		}
+		go func() {
+			if running != nil {
+				defer running.Done()
+			}
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					panicked <- recovered
+				}
+			}()
+			next.ServeHTTP(tw, r)
+			close(done)
+		}()
+
+		select {
+		case recovered := <-panicked:
+			panic(recovered)
+		case <-done:
+			return
+		case <-ctx.Done():
+		}
+
+		tw.mu.Lock()
+		if tw.wroteHeader {
+			// The response has started and cannot be replaced, let it finish
+			tw.mu.Unlock()
+			select {
+			case recovered := <-panicked:
+				panic(recovered)
+			case <-done:
+			}
+			return
+		}
+		tw.timedOut = true
+		tw.mu.Unlock()
+
+		w.Header().Set("Retry-After", "1")
+		handlers.RespondError(w, r, handlers.NewError(http.StatusServiceUnavailable, handlers.CodeTimeout,
+			"Request timed out"))
+	})
+}
+
+// timeoutWriter lets the handler write to the response until Deadline answers
+// in its place. The handler gets its own header map, so it never writes the
+// headers of the response concurrently with the middleware.
+type timeoutWriter struct {
+	http.ResponseWriter
+	mu          sync.Mutex
+	header      http.Header
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.writeHeader(code)
+}
+
+// writeHeader sends the headers of the handler, with tw.mu held
+func (tw *timeoutWriter) writeHeader(code int) {
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		copyHeader(tw.ResponseWriter.Header(), tw.header)
+		tw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	tw.wroteHeader = true
+	copyHeader(tw.ResponseWriter.Header(), tw.header)
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.writeHeader(http.StatusOK)
+	}
+	return tw.ResponseWriter.Write(b)
+}
+
+// Flush sends buffered data to the client, for streaming handlers
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return
+	}
+	if !tw.wroteHeader {
+		tw.writeHeader(http.StatusOK)
+	}
+	if flusher, ok := tw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack lets handlers take over the connection, e.g. for WebSockets. Deadline
+// no longer answers for hijacked requests.
+func (tw *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return nil, nil, http.ErrHandlerTimeout
+	}
+	hijacker, ok := tw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("the response writer does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		tw.wroteHeader = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+// copyHeader replaces the values of dst with those of src
+func copyHeader(dst, src http.Header) {
+	for key := range dst {
+		if _, ok := src[key]; !ok {
+			dst.Del(key)
+		}
+	}
+	for key, values := range src {
+		dst[key] = values
+	}
+}
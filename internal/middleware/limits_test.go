@@ -0,0 +1,211 @@
+package middleware
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"went-framework/internal/handlers"
+
+	"github.com/gorilla/mux"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+		err   bool
+	}{
+		{value: "512", want: 512},
+		{value: "512B", want: 512},
+		{value: "64KB", want: 64 << 10},
+		{value: "10 mb", want: 10 << 20},
+		{value: "1GB", want: 1 << 30},
+		{value: "0", want: 0},
+		{value: "-1", err: true},
+		{value: "1TB", err: true},
+		{value: "MB", err: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.value)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d, error %v", tt.value, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+// limitsRouter serves handler under a users route and a users import route,
+// behind middleware
+func limitsRouter(middleware func(http.Handler) http.Handler, handler http.HandlerFunc) *mux.Router {
+	router := mux.NewRouter()
+	router.Use(middleware)
+	router.HandleFunc("/api/{version}/users", handler)
+	router.HandleFunc("/api/{version}/users/import", handler).Methods(http.MethodPost)
+	return router
+}
+
+func TestBodyLimit(t *testing.T) {
+	limits := NewRouteLimits(Limits{MaxBodySize: 8}).
+		Route("POST /api/*/users/import", Limits{MaxBodySize: 64})
+	router := limitsRouter(limits.BodyLimit, func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			handlers.RespondError(w, r, handlers.FromError(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name    string
+		path    string
+		body    string
+		chunked bool
+		status  int
+	}{
+		{"under the limit", "/api/v1/users", "12345678", false, http.StatusNoContent},
+		{"announced over the limit", "/api/v1/users", "123456789", false, http.StatusRequestEntityTooLarge},
+		{"read over the limit", "/api/v1/users", "123456789", true, http.StatusRequestEntityTooLarge},
+		{"route override", "/api/v1/users/import", strings.Repeat("x", 64), false, http.StatusNoContent},
+		{"over the route override", "/api/v1/users/import", strings.Repeat("x", 65), true, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			if tt.chunked {
+				r.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	limits := NewRouteLimits(Limits{Timeout: 20 * time.Millisecond}).
+		Route("/api/*/users/import", Limits{Timeout: -1})
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		handler http.HandlerFunc
+		status  int
+		body    string
+	}{
+		{
+			name: "in time",
+			path: "/api/v1/users",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Handler", "yes")
+				io.WriteString(w, "ok")
+			},
+			status: http.StatusOK,
+			body:   "ok",
+		},
+		{
+			name: "too slow",
+			path: "/api/v1/users",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+				time.Sleep(5 * time.Millisecond)
+				w.Header().Set("X-Handler", "yes")
+				io.WriteString(w, "late")
+			},
+			status: http.StatusServiceUnavailable,
+			body:   `"Request timed out"`,
+		},
+		{
+			name: "started response finishes",
+			path: "/api/v1/users",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Handler", "yes")
+				io.WriteString(w, "start ")
+				<-r.Context().Done()
+				io.WriteString(w, "end")
+			},
+			status: http.StatusOK,
+			body:   "start end",
+		},
+		{
+			name:   "no timeout on the route",
+			method: http.MethodPost,
+			path:   "/api/v1/users/import",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(40 * time.Millisecond)
+				if r.Context().Err() != nil {
+					t.Error("the context was cancelled")
+				}
+				w.Header().Set("X-Handler", "yes")
+				io.WriteString(w, "ok")
+			},
+			status: http.StatusOK,
+			body:   "ok",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			r := httptest.NewRequest(method, tt.path, nil)
+			r, wait := WaitHandler(r)
+			w := httptest.NewRecorder()
+			limitsRouter(limits.Deadline, tt.handler).ServeHTTP(w, r)
+			wait()
+
+			if w.Code != tt.status || !strings.Contains(w.Body.String(), tt.body) {
+				t.Errorf("response = %d %q, want %d %q", w.Code, w.Body, tt.status, tt.body)
+			}
+			timedOut := tt.status == http.StatusServiceUnavailable
+			if timedOut == (w.Header().Get("X-Handler") != "") {
+				t.Errorf("headers of the handler = %v, want them only when it responded", w.Header())
+			}
+			if timedOut && w.Header().Get("Retry-After") != "1" {
+				t.Errorf("Retry-After = %q, want 1", w.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
+
+func TestDeadlineLateWrite(t *testing.T) {
+	limits := NewRouteLimits(Limits{Timeout: 10 * time.Millisecond})
+	var lateErr atomic.Value
+	router := limitsRouter(limits.Deadline, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		time.Sleep(5 * time.Millisecond)
+		if _, err := w.Write([]byte("late")); err != nil {
+			lateErr.Store(err)
+		}
+	})
+
+	r, wait := WaitHandler(httptest.NewRequest(http.MethodGet, "/api/v1/users", nil))
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	wait()
+
+	if err, _ := lateErr.Load().(error); !errors.Is(err, http.ErrHandlerTimeout) {
+		t.Errorf("late write error = %v, want http.ErrHandlerTimeout", err)
+	}
+}
+
+func TestDeadlinePanic(t *testing.T) {
+	limits := NewRouteLimits(Limits{Timeout: time.Second})
+	router := limitsRouter(limits.Deadline, func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	defer func() {
+		if recovered := recover(); recovered != "boom" {
+			t.Errorf("recovered %v, want the panic of the handler", recovered)
+		}
+	}()
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/users", nil))
+}
@@ -1,100 +1,277 @@
 package middleware
 
 import (
-	"bytes"
+	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
+	"went-framework/internal/handlers"
 	wentlog "went-framework/internal/logger"
+	"went-framework/internal/requestid"
 )
 
-// ResponseWriter wrapper to capture response data
-type responseWriter struct {
-	http.ResponseWriter
-	statusCode int
-	body       bytes.Buffer
+// LoggingConfig configures the HTTP request logging
+type LoggingConfig struct {
+	// MaxBodySize is the number of bytes of each request and response body
+	// captured in the log, 0 leaves bodies out. Longer bodies are truncated.
+	MaxBodySize int
+	// SampleRate is the fraction of successful requests logged, from 0 to 1.
+	// Requests failing with a 4xx or 5xx status are always logged.
+	SampleRate float64
+	// SkipPaths lists the request paths that are never logged, as globs where
+	// * matches one path segment, e.g. /swagger/*
+	SkipPaths []string
+	// RedactFields lists the JSON, form and query fields whose values are
+	// replaced by [REDACTED]. Fields containing one of them, ignoring case,
+	// are redacted too: "token" covers access_token.
+	RedactFields []string
 }
 
-func (rw *responseWriter) WriteHeader(code int) {
-	rw.statusCode = code
-	rw.ResponseWriter.WriteHeader(code)
+// DefaultLoggingConfig logs every request with the first 4 KB of its bodies,
+// except health checks and the Swagger UI files, redacting credentials
+func DefaultLoggingConfig() LoggingConfig {
+	return LoggingConfig{
+		MaxBodySize:  4 << 10,
+		SampleRate:   1,
+		SkipPaths:    []string{"/favicon.ico", "/robots.txt", "/health", "/api/health", "/swagger/*"},
+		RedactFields: []string{"password", "token", "secret", "api_key", "authorization", "credit_card"},
+	}
 }
 
-func (rw *responseWriter) Write(b []byte) (int, error) {
-	// Write to both the original response and our buffer
-	rw.body.Write(b)
-	return rw.ResponseWriter.Write(b)
+// LoggingConfigFromEnv returns the default config overridden by
+// LOG_BODY_MAX_SIZE (bytes, or with a KB or MB suffix), LOG_SAMPLE_RATE
+// (0 to 1), LOG_SKIP_PATHS and LOG_REDACT_FIELDS (comma separated lists)
+func LoggingConfigFromEnv() LoggingConfig {
+	config := DefaultLoggingConfig()
+
+	if value := os.Getenv("LOG_BODY_MAX_SIZE"); value != "" {
+		size, err := ParseSize(value)
+		if err != nil {
+			panic(fmt.Sprintf("LOG_BODY_MAX_SIZE: %v", err))
+		}
+		config.MaxBodySize = int(size)
+	}
+	if value, err := strconv.ParseFloat(os.Getenv("LOG_SAMPLE_RATE"), 64); err == nil {
+		config.SampleRate = value
+	}
+
+	lists := map[string]*[]string{
+		"LOG_SKIP_PATHS":    &config.SkipPaths,
+		"LOG_REDACT_FIELDS": &config.RedactFields,
+	}
+	for key, list := range lists {
+		if value := os.Getenv(key); value != "" {
+			*list = nil
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					*list = append(*list, item)
+				}
+			}
+		}
+	}
+
+	return config
 }
 
-// LoggingMiddleware logs all HTTP requests and responses
-func LoggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
+// requestLogger logs requests according to a LoggingConfig
+type requestLogger struct {
+	config LoggingConfig
+	// redactPattern matches the string values of redacted fields in JSON text
+	// that cannot be parsed, such as truncated bodies
+	redactPattern *regexp.Regexp
+}
 
-		// Skip logging for health checks and static files to reduce noise
-		if shouldSkipLogging(r.URL.Path) {
-			next.ServeHTTP(w, r)
-			return
+// Logging logs each request and its response at a level matching the status,
+// with their headers and the start of their bodies. Bodies are captured while
+// the handler reads and writes them, so nothing is buffered beyond
+// MaxBodySize and streamed responses are not held back. Sensitive headers and
+// fields are redacted. Invalid skip paths are programming errors and panic.
+func Logging(config LoggingConfig) func(http.Handler) http.Handler {
+	for _, pattern := range config.SkipPaths {
+		if _, err := path.Match(pattern, ""); err != nil {
+			panic(fmt.Sprintf("invalid skip path %q: %v", pattern, err))
 		}
+	}
 
-		// Read request body
-		var requestBody []byte
-		if r.Body != nil {
-			requestBody, _ = io.ReadAll(r.Body)
-			// Restore the body for the next handler
-			r.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	l := &requestLogger{config: config}
+	if len(config.RedactFields) > 0 {
+		fields := make([]string, len(config.RedactFields))
+		for i, field := range config.RedactFields {
+			fields[i] = regexp.QuoteMeta(field)
 		}
+		l.redactPattern = regexp.MustCompile(`(?i)("[^"]*(?:` + strings.Join(fields, "|") + `)[^"]*"\s*:\s*)"(?:[^"\\]|\\.)*"?`)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if l.skip(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			start := time.Now()
+			sampled := config.SampleRate >= 1 || rand.Float64() < config.SampleRate
+
+			var requestBody *bodyCapture
+			if r.Body != nil && r.Body != http.NoBody {
+				requestBody = &bodyCapture{ReadCloser: r.Body, limit: config.MaxBodySize}
+				r.Body = requestBody
+			}
+			rw := &responseWriter{
+				ResponseWriter: w,
+				statusCode:     http.StatusOK,
+				body:           bodyCapture{limit: config.MaxBodySize},
+			}
+
+			defer func() {
+				// A panic is answered further out by Recovery, log the status
+				// it will send
+				recovered := recover()
+				if recovered == nil {
+					return
+				}
+				if recovered != http.ErrAbortHandler {
+					if !rw.wroteHeader {
+						rw.statusCode = http.StatusInternalServerError
+						var appErr *handlers.AppError
+						if err, ok := recovered.(error); ok && errors.As(err, &appErr) {
+							rw.statusCode = appErr.Status
+						}
+					}
+					l.log(r, requestBody, rw, time.Since(start))
+				}
+				panic(recovered)
+			}()
+
+			next.ServeHTTP(rw, r)
+
+			if sampled || rw.statusCode >= 400 {
+				l.log(r, requestBody, rw, time.Since(start))
+			}
+		})
+	}
+}
+
+// LoggingMiddleware logs requests with the default config, see Logging
+func LoggingMiddleware(next http.Handler) http.Handler {
+	return Logging(DefaultLoggingConfig())(next)
+}
 
-		// Create response writer wrapper
-		rw := &responseWriter{
-			ResponseWriter: w,
-			statusCode:     http.StatusOK, // Default status code
+// skip reports whether requests to a path are not logged
+func (l *requestLogger) skip(requestPath string) bool {
+	for _, pattern := range l.config.SkipPaths {
+		if matched, _ := path.Match(pattern, requestPath); matched {
+			return true
 		}
+	}
+	return false
+}
+
+// bodyCapture keeps the first bytes of a body as it is read or written
+type bodyCapture struct {
+	io.ReadCloser
+	limit   int
+	data    []byte
+	size    int
+	readErr error
+}
+
+// capture records b, up to the limit
+func (c *bodyCapture) capture(b []byte) {
+	c.size += len(b)
+	if room := c.limit - len(c.data); room > 0 {
+		c.data = append(c.data, b[:min(room, len(b))]...)
+	}
+}
 
-		// Call the next handler
-		next.ServeHTTP(rw, r)
+func (c *bodyCapture) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.capture(p[:n])
+	if err != nil && err != io.EOF {
+		c.readErr = err
+	}
+	return n, err
+}
 
-		// Calculate request duration
-		duration := time.Since(start)
+// truncated reports whether the body is longer than what was captured
+func (c *bodyCapture) truncated() bool {
+	return c.size > len(c.data)
+}
+
+// responseWriter records the status and the start of the body of a response
+type responseWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	body        bodyCapture
+}
 
-		// Log the request and response
-		logHTTPRequest(r, rw, requestBody, duration)
-	})
+func (rw *responseWriter) WriteHeader(code int) {
+	if !rw.wroteHeader && (code < 100 || code >= 200 || code == http.StatusSwitchingProtocols) {
+		rw.statusCode = code
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(code)
 }
 
-// logHTTPRequest logs the HTTP request and response details
-func logHTTPRequest(r *http.Request, rw *responseWriter, requestBody []byte, duration time.Duration) {
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	rw.body.capture(b)
+	return rw.ResponseWriter.Write(b)
+}
+
+// Flush sends buffered data to the client, for streaming handlers
+func (rw *responseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		rw.wroteHeader = true
+		flusher.Flush()
+	}
+}
+
+// Hijack lets handlers take over the connection, e.g. for WebSockets
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("the response writer does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// log writes the log entries of a request
+func (l *requestLogger) log(r *http.Request, requestBody *bodyCapture, rw *responseWriter, duration time.Duration) {
 	// Prepare request data
 	requestData := map[string]interface{}{
 		"method":       r.Method,
-		"url":          r.URL.String(),
+		"url":          l.redactURL(r.URL),
 		"path":         r.URL.Path,
 		"remote_addr":  getClientIP(r),
 		"user_agent":   r.UserAgent(),
 		"referer":      r.Referer(),
-		"query_params": r.URL.Query(),
+		"query_params": l.redactValues(r.URL.Query()),
 		"headers":      filterHeaders(r.Header),
 		"content_type": r.Header.Get("Content-Type"),
 	}
-
-	// Add request body if present and not too large
-	if len(requestBody) > 0 && len(requestBody) < 10240 { // Max 10KB
-		if isJSONContent(r.Header.Get("Content-Type")) {
-			var jsonBody interface{}
-			if err := json.Unmarshal(requestBody, &jsonBody); err == nil {
-				requestData["body"] = jsonBody
-			} else {
-				requestData["body"] = string(requestBody)
-			}
-		} else {
-			requestData["body"] = string(requestBody)
+	if requestBody != nil {
+		l.addBody(requestData, requestBody, r.Header.Get("Content-Type"))
+		if requestBody.readErr != nil {
+			requestData["body_error"] = requestBody.readErr.Error()
 		}
-	} else if len(requestBody) > 0 {
-		requestData["body_size"] = len(requestBody)
-		requestData["body_truncated"] = true
 	}
 
 	// Prepare response data
@@ -105,24 +282,7 @@ func logHTTPRequest(r *http.Request, rw *responseWriter, requestBody []byte, dur
 		"content_type":   rw.Header().Get("Content-Type"),
 		"content_length": rw.Header().Get("Content-Length"),
 	}
-
-	// Add response body if present and not too large
-	responseBody := rw.body.Bytes()
-	if len(responseBody) > 0 && len(responseBody) < 10240 { // Max 10KB
-		if isJSONContent(rw.Header().Get("Content-Type")) {
-			var jsonBody interface{}
-			if err := json.Unmarshal(responseBody, &jsonBody); err == nil {
-				responseData["body"] = jsonBody
-			} else {
-				responseData["body"] = string(responseBody)
-			}
-		} else {
-			responseData["body"] = string(responseBody)
-		}
-	} else if len(responseBody) > 0 {
-		responseData["body_size"] = len(responseBody)
-		responseData["body_truncated"] = true
-	}
+	l.addBody(responseData, &rw.body, rw.Header().Get("Content-Type"))
 
 	// Prepare log data
 	logData := map[string]interface{}{
@@ -138,13 +298,13 @@ func logHTTPRequest(r *http.Request, rw *responseWriter, requestBody []byte, dur
 	statusCode := rw.statusCode
 	switch {
 	case statusCode >= 500:
-		wentlog.Error("HTTP Request - Server Error", logData)
+		wentlog.ErrorContext(r.Context(), "HTTP Request - Server Error", logData)
 	case statusCode >= 400:
-		wentlog.Warn("HTTP Request - Client Error", logData)
+		wentlog.WarnContext(r.Context(), "HTTP Request - Client Error", logData)
 	case statusCode >= 300:
-		wentlog.Info("HTTP Request - Redirect", logData)
+		wentlog.InfoContext(r.Context(), "HTTP Request - Redirect", logData)
 	default:
-		wentlog.Info("HTTP Request", logData)
+		wentlog.InfoContext(r.Context(), "HTTP Request", logData)
 	}
 
 	// Also log a summary line for quick scanning
@@ -157,40 +317,110 @@ func logHTTPRequest(r *http.Request, rw *responseWriter, requestBody []byte, dur
 	)
 
 	if statusCode >= 400 {
-		wentlog.Warn(summaryMessage, map[string]interface{}{
+		wentlog.WarnContext(r.Context(), summaryMessage, map[string]interface{}{
 			"client_ip":  getClientIP(r),
 			"user_agent": r.UserAgent(),
 		})
 	} else {
-		wentlog.Debug(summaryMessage, map[string]interface{}{
+		wentlog.DebugContext(r.Context(), summaryMessage, map[string]interface{}{
 			"client_ip": getClientIP(r),
 		})
 	}
 }
 
-// shouldSkipLogging determines if a request should be skipped from logging
-func shouldSkipLogging(path string) bool {
-	skipPaths := []string{
-		"/favicon.ico",
-		"/robots.txt",
-		"/health",     // Skip health checks
-		"/api/health", // Skip API health checks
+// addBody adds the captured body to the log data of a request or response.
+// Complete JSON bodies are logged as JSON, others as text; both are redacted.
+func (l *requestLogger) addBody(data map[string]interface{}, body *bodyCapture, contentType string) {
+	if body.size == 0 {
+		return
+	}
+	data["body_size"] = body.size
+	if body.truncated() {
+		data["body_truncated"] = true
+	}
+	if len(body.data) == 0 {
+		return
 	}
 
-	// Skip swagger static files but log swagger API calls
-	if strings.HasPrefix(path, "/swagger/") && !strings.HasSuffix(path, ".json") {
-		return true
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case isJSONContent(contentType) && !body.truncated():
+		var jsonBody interface{}
+		if err := json.Unmarshal(body.data, &jsonBody); err == nil {
+			data["body"] = l.redactJSON(jsonBody)
+			return
+		}
+	case mediaType == "application/x-www-form-urlencoded" && !body.truncated():
+		if values, err := url.ParseQuery(string(body.data)); err == nil {
+			data["body"] = l.redactValues(values)
+			return
+		}
+	case mediaType == "multipart/form-data":
+		// Uploads are binary, only their size is logged
+		return
 	}
+	data["body"] = l.redactText(string(body.data))
+}
 
-	for _, skipPath := range skipPaths {
-		if path == skipPath {
+// redacted reports whether the value of a field must not be logged
+func (l *requestLogger) redacted(field string) bool {
+	field = strings.ToLower(field)
+	for _, sensitive := range l.config.RedactFields {
+		if strings.Contains(field, strings.ToLower(sensitive)) {
 			return true
 		}
 	}
-
 	return false
 }
 
+// redactJSON replaces the values of redacted fields in a decoded JSON value
+func (l *requestLogger) redactJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if l.redacted(key) {
+				v[key] = "[REDACTED]"
+			} else {
+				v[key] = l.redactJSON(item)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = l.redactJSON(item)
+		}
+	}
+	return value
+}
+
+// redactValues returns query or form values with the redacted fields replaced
+func (l *requestLogger) redactValues(values url.Values) url.Values {
+	for key := range values {
+		if l.redacted(key) {
+			values[key] = []string{"[REDACTED]"}
+		}
+	}
+	return values
+}
+
+// redactURL returns a URL with the redacted query parameters replaced
+func (l *requestLogger) redactURL(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.String()
+	}
+	redacted := *u
+	redacted.RawQuery = l.redactValues(u.Query()).Encode()
+	return redacted.String()
+}
+
+// redactText replaces the string values of redacted fields in JSON text that
+// could not be parsed, such as a truncated body
+func (l *requestLogger) redactText(text string) string {
+	if l.redactPattern == nil {
+		return text
+	}
+	return l.redactPattern.ReplaceAllString(text, `$1"[REDACTED]"`)
+}
+
 // getClientIP extracts the real client IP from request
 func getClientIP(r *http.Request) string {
 	// Check X-Forwarded-For header first (for proxies)
@@ -237,41 +467,35 @@ func isJSONContent(contentType string) bool {
 	return strings.Contains(strings.ToLower(contentType), "application/json")
 }
 
-// RequestIDMiddleware adds a unique request ID to each request
-func RequestIDMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Generate a simple request ID (in production, use uuid)
-		requestID := generateRequestID()
-
-		// Add to request context (you might want to use context.WithValue in production)
-		r.Header.Set("X-Request-ID", requestID)
-		w.Header().Set("X-Request-ID", requestID)
-
-		next.ServeHTTP(w, r)
-	})
+// RequestIDConfig configures the request ID middleware
+type RequestIDConfig struct {
+	// TrustIncoming keeps a valid X-Request-ID sent by the client, e.g. by a
+	// load balancer or an upstream service, instead of generating a new one.
+	// Only enable it when the clients of the API are trusted.
+	TrustIncoming bool
 }
 
-// generateRequestID generates a simple request ID
-func generateRequestID() string {
-	return fmt.Sprintf("%d", time.Now().UnixNano())
-}
+// RequestID gives each request an ID, a new ULID unless a trusted incoming
+// X-Request-ID is kept. The ID is stored in the request context, see
+// requestid.FromContext, so the *Context logging functions include it, and is
+// returned in the X-Request-ID response header.
+func RequestID(config RequestIDConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(requestid.Header)
+			if !config.TrustIncoming || !requestid.Valid(id) {
+				id = requestid.New()
+			}
 
-// CORSMiddleware handles CORS headers
-func CORSMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Set CORS headers
-		w.Header().Set("Access-Control-Allow-Origin", "*") // Configure properly in production
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With")
-
-		// Handle preflight requests
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
+			w.Header().Set(requestid.Header, id)
+			next.ServeHTTP(w, r.WithContext(requestid.NewContext(r.Context(), id)))
+		})
+	}
+}
 
-		next.ServeHTTP(w, r)
-	})
+// RequestIDMiddleware gives each request a new ID, ignoring incoming ones
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return RequestID(RequestIDConfig{})(next)
 }
 
 // MiddlewareChain combines multiple middleware into a single handler
@@ -0,0 +1,231 @@
+package middleware
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	wentlog "went-framework/internal/logger"
+)
+
+// logEntry is a JSON log line of the global logger
+type logEntry struct {
+	Level   string                 `json:"level"`
+	Message string                 `json:"message"`
+	Context map[string]interface{} `json:"context"`
+}
+
+// captureLogs sends the global logger to a file for the rest of the test, and
+// returns a function reading the entries logged so far
+func captureLogs(t *testing.T) func() []logEntry {
+	t.Helper()
+	file, err := os.CreateTemp(t.TempDir(), "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, logger := os.Stdout, wentlog.GlobalLogger
+	os.Stdout = file
+	wentlog.GlobalLogger = wentlog.NewLogger(wentlog.INFO, "json", "stdout")
+	os.Stdout = stdout
+	t.Cleanup(func() {
+		wentlog.GlobalLogger = logger
+		file.Close()
+	})
+
+	return func() []logEntry {
+		var entries []logEntry
+		file.Seek(0, io.SeekStart)
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			var entry logEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				t.Fatalf("log line %q: %v", scanner.Text(), err)
+			}
+			entries = append(entries, entry)
+		}
+		return entries
+	}
+}
+
+// requestEntries returns the request entries of the logs, without summary lines
+func requestEntries(entries []logEntry) []logEntry {
+	var requests []logEntry
+	for _, entry := range entries {
+		if entry.Context["type"] == "http_request" {
+			requests = append(requests, entry)
+		}
+	}
+	return requests
+}
+
+// field returns the value at a dotted path of a log context
+func field(context map[string]interface{}, path string) interface{} {
+	var value interface{} = context
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+func TestLoggingRedaction(t *testing.T) {
+	config := DefaultLoggingConfig()
+	config.MaxBodySize = 128
+
+	tests := []struct {
+		name        string
+		target      string
+		contentType string
+		body        string
+		header      string
+		fields      map[string]interface{}
+	}{
+		{
+			name:        "json body",
+			target:      "/api/login",
+			contentType: "application/json",
+			body:        `{"email":"ada@example.com","password":"hunter2","profile":{"api_key":"k"}}`,
+			fields: map[string]interface{}{
+				"request.body.email":           "ada@example.com",
+				"request.body.password":        "[REDACTED]",
+				"request.body.profile.api_key": "[REDACTED]",
+			},
+		},
+		{
+			name:        "truncated json body",
+			target:      "/api/login",
+			contentType: "application/json",
+			body:        `{"access_token":"abc","padding":"` + strings.Repeat("x", 200) + `"}`,
+			fields: map[string]interface{}{
+				"request.body_truncated": true,
+				// The first 128 bytes, with the token redacted
+				"request.body": `{"access_token":"[REDACTED]","padding":"` + strings.Repeat("x", 128-len(`{"access_token":"abc","padding":"`)),
+			},
+		},
+		{
+			name:        "form body",
+			target:      "/login",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "user=ada&password=hunter2",
+			fields: map[string]interface{}{
+				"request.body.user":     []interface{}{"ada"},
+				"request.body.password": []interface{}{"[REDACTED]"},
+			},
+		},
+		{
+			name:   "query string",
+			target: "/api/users?page=2&token=abc",
+			fields: map[string]interface{}{
+				"request.query_params.page":  []interface{}{"2"},
+				"request.query_params.token": []interface{}{"[REDACTED]"},
+				"request.url":                "/api/users?page=2&token=%5BREDACTED%5D",
+			},
+		},
+		{
+			name:   "headers",
+			target: "/api/users",
+			header: "Bearer secret",
+			fields: map[string]interface{}{
+				"request.headers.Authorization": "[REDACTED]",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			handler := Logging(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				io.ReadAll(r.Body)
+				w.WriteHeader(http.StatusNoContent)
+			}))
+
+			r := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			entries := requestEntries(logs())
+			if len(entries) != 1 {
+				t.Fatalf("logged %d requests, want 1", len(entries))
+			}
+			for path, want := range tt.fields {
+				got, _ := json.Marshal(field(entries[0].Context, path))
+				if wantJSON, _ := json.Marshal(want); string(got) != string(wantJSON) {
+					t.Errorf("%s = %s, want %s", path, got, wantJSON)
+				}
+			}
+		})
+	}
+}
+
+func TestLoggingSelection(t *testing.T) {
+	tests := []struct {
+		name   string
+		config LoggingConfig
+		path   string
+		status int
+		logged bool
+	}{
+		{"logged", LoggingConfig{SampleRate: 1}, "/api/users", http.StatusOK, true},
+		{"skipped path", LoggingConfig{SampleRate: 1, SkipPaths: []string{"/swagger/*"}}, "/swagger/index.html", http.StatusOK, false},
+		{"skip globs match one segment", LoggingConfig{SampleRate: 1, SkipPaths: []string{"/swagger/*"}}, "/swagger/a/b", http.StatusOK, true},
+		{"success not sampled", LoggingConfig{SampleRate: 0}, "/api/users", http.StatusOK, false},
+		{"client error always logged", LoggingConfig{SampleRate: 0}, "/api/users", http.StatusNotFound, true},
+		{"server error always logged", LoggingConfig{SampleRate: 0}, "/api/users", http.StatusBadGateway, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			handler := Logging(tt.config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			entries := requestEntries(logs())
+			if logged := len(entries) == 1; logged != tt.logged {
+				t.Fatalf("logged %d requests, want logged %v", len(entries), tt.logged)
+			}
+			if tt.logged && field(entries[0].Context, "response.status_code") != float64(tt.status) {
+				t.Errorf("status_code = %v, want %d", field(entries[0].Context, "response.status_code"), tt.status)
+			}
+		})
+	}
+}
+
+func TestLoggingResponseBody(t *testing.T) {
+	logs := captureLogs(t)
+	handler := Logging(LoggingConfig{SampleRate: 1, MaxBodySize: 16})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, strings.Repeat("a", 10))
+		io.WriteString(w, strings.Repeat("b", 10))
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Body.Len() != 20 {
+		t.Errorf("response of %d bytes, want it passed through whole", w.Body.Len())
+	}
+	entries := requestEntries(logs())
+	if len(entries) != 1 {
+		t.Fatalf("logged %d requests, want 1", len(entries))
+	}
+	context := entries[0].Context
+	if field(context, "response.body") != "aaaaaaaaaabbbbbb" || field(context, "response.body_size") != float64(20) ||
+		field(context, "response.body_truncated") != true {
+		t.Errorf("response = %v, want the first 16 of 20 bytes", field(context, "response"))
+	}
+}
@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"went-framework/internal/handlers"
+
+	wentlog "went-framework/internal/logger"
+
+	"github.com/gorilla/mux"
+)
+
+// PanicReporter receives the panics recovered by Recovery, e.g. to forward them
+// to an error tracker. It is called after the panic is logged.
+type PanicReporter func(r *http.Request, recovered interface{}, stack []byte)
+
+// RecoveryConfig configures the panic recovery middleware
+type RecoveryConfig struct {
+	// ShowDetails returns the panic value in the error message. It must stay
+	// off in production, where clients only get "Internal server error".
+	ShowDetails bool
+	// Reporter is called with every recovered panic, when set
+	Reporter PanicReporter
+}
+
+// Recovery recovers panics of the next handlers. The panic is logged with its
+// stack trace, request ID and route, passed to the reporter, and answered with
+// a 500 in the standard error envelope. A panic with an *handlers.AppError,
+// such as a database that cannot be reached, is answered with that error.
+// http.ErrAbortHandler is not recovered, it aborts the response on purpose.
+func Recovery(config RecoveryConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rw := &recoveryWriter{ResponseWriter: w}
+
+			defer func() {
+				recovered := recover()
+				if recovered == nil {
+					return
+				}
+				if recovered == http.ErrAbortHandler {
+					panic(recovered)
+				}
+
+				stack := debug.Stack()
+				route := r.URL.Path
+				if current := mux.CurrentRoute(r); current != nil {
+					if template, err := current.GetPathTemplate(); err == nil {
+						route = template
+					}
+				}
+
+				wentlog.ErrorContext(r.Context(), "Recovered from panic", map[string]interface{}{
+					"panic":  fmt.Sprint(recovered),
+					"stack":  string(stack),
+					"method": r.Method,
+					"path":   r.URL.Path,
+					"route":  route,
+				})
+				if config.Reporter != nil {
+					config.Reporter(r, recovered, stack)
+				}
+
+				// Nothing can be sent once the response has started
+				if rw.wroteHeader {
+					return
+				}
+
+				var appErr *handlers.AppError
+				if err, ok := recovered.(error); ok && errors.As(err, &appErr) {
+					// Respond without the cause, which is logged above already
+					appErr = handlers.NewError(appErr.Status, appErr.Code, appErr.Message)
+				} else {
+					appErr = handlers.NewError(http.StatusInternalServerError, handlers.CodeInternal, "Internal server error")
+				}
+				if config.ShowDetails {
+					appErr.Message = fmt.Sprintf("%s: panic: %v", appErr.Message, recovered)
+				}
+				handlers.RespondError(w, r, appErr)
+			}()
+
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// recoveryWriter records whether the response has started
+type recoveryWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (rw *recoveryWriter) WriteHeader(code int) {
+	rw.wroteHeader = true
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *recoveryWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	return rw.ResponseWriter.Write(b)
+}
+
+// Flush sends buffered data to the client, for streaming handlers
+func (rw *recoveryWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		rw.wroteHeader = true
+		flusher.Flush()
+	}
+}
+
+// Hijack lets handlers take over the connection, e.g. for WebSockets. Panics
+// after that are not answered, the connection belongs to the handler.
+func (rw *recoveryWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("the response writer does not support hijacking")
+	}
+	conn, brw, err := hijacker.Hijack()
+	if err == nil {
+		rw.wroteHeader = true
+	}
+	return conn, brw, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rw *recoveryWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
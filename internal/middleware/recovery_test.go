@@ -0,0 +1,149 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"went-framework/internal/handlers"
+)
+
+func TestRecovery(t *testing.T) {
+	tests := []struct {
+		name        string
+		showDetails bool
+		handler     http.HandlerFunc
+		status      int
+		code        string
+		message     string
+	}{
+		{
+			name:    "panic",
+			handler: func(w http.ResponseWriter, r *http.Request) { panic("boom") },
+			status:  http.StatusInternalServerError,
+			code:    handlers.CodeInternal,
+			message: "Internal server error",
+		},
+		{
+			name:        "panic with details",
+			showDetails: true,
+			handler:     func(w http.ResponseWriter, r *http.Request) { panic("boom") },
+			status:      http.StatusInternalServerError,
+			code:        handlers.CodeInternal,
+			message:     "Internal server error: panic: boom",
+		},
+		{
+			name: "application error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				panic(handlers.Wrap(errors.New("dial tcp: refused"), "Database unavailable"))
+			},
+			status:  http.StatusInternalServerError,
+			code:    handlers.CodeInternal,
+			message: "Database unavailable",
+		},
+		{
+			name: "wrapped application error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				err := handlers.NewError(http.StatusServiceUnavailable, handlers.CodeUnavailable, "Database unavailable")
+				panic(errors.Join(errors.New("connect"), err))
+			},
+			status:  http.StatusServiceUnavailable,
+			code:    handlers.CodeUnavailable,
+			message: "Database unavailable",
+		},
+		{
+			name: "started response",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+				io.WriteString(w, "partial")
+				panic("boom")
+			},
+			status: http.StatusAccepted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reported interface{}
+			handler := Recovery(RecoveryConfig{
+				ShowDetails: tt.showDetails,
+				Reporter: func(r *http.Request, recovered interface{}, stack []byte) {
+					reported = recovered
+				},
+			})(tt.handler)
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if reported == nil {
+				t.Error("the panic was not reported")
+			}
+			if tt.code == "" {
+				if w.Body.String() != "partial" {
+					t.Errorf("body of a started response = %q", w.Body)
+				}
+				return
+			}
+			var body struct {
+				Status  string `json:"status"`
+				Message string `json:"message"`
+				Code    string `json:"code"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body %q: %v", w.Body, err)
+			}
+			if body.Status != "error" || body.Code != tt.code || body.Message != tt.message {
+				t.Errorf("body = %+v, want code %q and message %q", body, tt.code, tt.message)
+			}
+		})
+	}
+}
+
+func TestRecoveryAbortHandler(t *testing.T) {
+	handler := Recovery(RecoveryConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if recovered := recover(); recovered != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler passed on", recovered)
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestRecoveryLogsPanicStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		panic  interface{}
+		status int
+	}{
+		{"panic", "boom", http.StatusInternalServerError},
+		{"application error", handlers.NewError(http.StatusServiceUnavailable, handlers.CodeUnavailable, "Database unavailable"), http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			// Recovery runs outside the logging, as in the global stack
+			handler := Recovery(RecoveryConfig{})(Logging(LoggingConfig{SampleRate: 1})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				panic(tt.panic)
+			})))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			entries := requestEntries(logs())
+			if w.Code != tt.status || len(entries) != 1 {
+				t.Fatalf("status = %d with %d request logs, want %d with 1", w.Code, len(entries), tt.status)
+			}
+			if got := field(entries[0].Context, "response.status_code"); got != float64(tt.status) {
+				t.Errorf("logged status = %v, want %d", got, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+// Factory builds a middleware from the parameters of its name, e.g. ["60", "1m"]
+// for throttle:60,1m
+type Factory func(params []string) (func(http.Handler) http.Handler, error)
+
+// Static returns the factory of a middleware without parameters
+func Static(middleware func(http.Handler) http.Handler) Factory {
+	return func(params []string) (func(http.Handler) http.Handler, error) {
+		if len(params) > 0 {
+			return nil, fmt.Errorf("takes no parameters")
+		}
+		return middleware, nil
+	}
+}
+
+// Registry holds named middleware, attached to route groups and routes by name
+// with parameters after a colon: "auth", "throttle:60,1m" or "role:admin". It
+// remembers what it attached, so tools can list the middleware stack of each
+// route, see Stacks.
+type Registry struct {
+	mu        sync.RWMutex
+	factories map[string]Factory
+	groups    map[*mux.Router][]string
+	routes    map[*mux.Route][]string
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		factories: make(map[string]Factory),
+		groups:    make(map[*mux.Router][]string),
+		routes:    make(map[*mux.Route][]string),
+	}
+}
+
+// Register names a middleware. Registering a name twice is a programming error
+// and panics.
+func (reg *Registry) Register(name string, factory Factory) *Registry {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if _, exists := reg.factories[name]; exists {
+		panic(fmt.Sprintf("middleware %q is already registered", name))
+	}
+	if name == "" || strings.ContainsAny(name, ":, ") {
+		panic(fmt.Sprintf("invalid middleware name %q", name))
+	}
+	reg.factories[name] = factory
+	return reg
+}
+
+// Names returns the registered names, sorted
+func (reg *Registry) Names() []string {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	names := make([]string, 0, len(reg.factories))
+	for name := range reg.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve builds the chain of the named middleware, the first one outermost
+func (reg *Registry) Resolve(specs ...string) (func(http.Handler) http.Handler, error) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	middlewares := make([]func(http.Handler) http.Handler, len(specs))
+	for i, spec := range specs {
+		name, params := parseSpec(spec)
+		factory, ok := reg.factories[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown middleware %q", name)
+		}
+		middleware, err := factory(params)
+		if err != nil {
+			return nil, fmt.Errorf("middleware %q: %w", spec, err)
+		}
+		middlewares[i] = middleware
+	}
+	return MiddlewareChain(middlewares...), nil
+}
+
+// Group applies the named middleware to the routes of a router or subrouter,
+// e.g. Group(api.PathPrefix("/admin").Subrouter(), "auth", "role:admin"). Like
+// all router middleware, it only runs for requests matching a route. Unknown
+// names and invalid parameters are programming errors and panic.
+func (reg *Registry) Group(router *mux.Router, specs ...string) *mux.Router {
+	router.Use(reg.MustResolve(specs...))
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.groups[router] = append(reg.groups[router], specs...)
+	return router
+}
+
+// Route wraps the handler of a single route with the named middleware, inside
+// the middleware of its groups, e.g.
+// Route(api.HandleFunc("/reports", reports).Methods("GET"), "role:admin").
+// The handler must be set first. Unknown names and invalid parameters are
+// programming errors and panic.
+func (reg *Registry) Route(route *mux.Route, specs ...string) *mux.Route {
+	handler := route.GetHandler()
+	if handler == nil {
+		panic("the route has no handler yet")
+	}
+	route.Handler(reg.MustResolve(specs...)(handler))
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.routes[route] = append(reg.routes[route], specs...)
+	return route
+}
+
+// MustResolve is Resolve for the setup of routes, where unknown names and
+// invalid parameters are programming errors and panic. It builds middleware
+// for handlers outside a router, such as a NotFoundHandler.
+func (reg *Registry) MustResolve(specs ...string) func(http.Handler) http.Handler {
+	middleware, err := reg.Resolve(specs...)
+	if err != nil {
+		panic(err.Error())
+	}
+	return middleware
+}
+
+// Stacks returns the middleware attached to each route of a router through the
+// registry, outermost first: the groups of the router and its subrouters, then
+// the route's own
+func (reg *Registry) Stacks(router *mux.Router) map[*mux.Route][]string {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	stacks := make(map[*mux.Route][]string)
+	// parents maps the routes walked so far to the router holding them, which
+	// gives the routers of the ancestors of a route
+	parents := make(map[*mux.Route]*mux.Router)
+	router.Walk(func(route *mux.Route, parent *mux.Router, ancestors []*mux.Route) error {
+		parents[route] = parent
+
+		var stack []string
+		for _, ancestor := range ancestors {
+			stack = append(stack, reg.groups[parents[ancestor]]...)
+		}
+		stack = append(stack, reg.groups[parent]...)
+		stack = append(stack, reg.routes[route]...)
+		stacks[route] = stack
+		return nil
+	})
+	return stacks
+}
+
+// parseSpec splits "throttle:60,1m" into its name and parameters
+func parseSpec(spec string) (string, []string) {
+	name, rest, found := strings.Cut(strings.TrimSpace(spec), ":")
+	if !found {
+		return name, nil
+	}
+	params := strings.Split(rest, ",")
+	for i, param := range params {
+		params[i] = strings.TrimSpace(param)
+	}
+	return name, params
+}
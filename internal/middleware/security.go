@@ -0,0 +1,178 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// NoncePlaceholder is replaced by the nonce of each request in a
+// Content-Security-Policy, e.g. "script-src 'self' 'nonce-{nonce}'"
+const NoncePlaceholder = "{nonce}"
+
+// SecurityConfig lists the security headers of responses. Empty fields leave
+// their header out.
+type SecurityConfig struct {
+	// HSTSMaxAge is how long browsers only use HTTPS for the host, 0 leaves
+	// Strict-Transport-Security out. It is only sent over HTTPS.
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+	// TrustForwardedProto counts requests with X-Forwarded-Proto: https as
+	// HTTPS, only behind a proxy terminating TLS that sets the header
+	TrustForwardedProto bool
+	// ContentSecurityPolicy may contain NoncePlaceholder, replaced by a new
+	// nonce on each request, see CSPNonce
+	ContentSecurityPolicy     string
+	ContentTypeOptions        string
+	FrameOptions              string
+	ReferrerPolicy            string
+	PermissionsPolicy         string
+	CrossOriginOpenerPolicy   string
+	CrossOriginResourcePolicy string
+	CrossOriginEmbedderPolicy string
+}
+
+// DefaultSecurityConfig is the strict policy of API responses, which are never
+// rendered as pages: nothing may be loaded, framed or sniffed
+func DefaultSecurityConfig() SecurityConfig {
+	return SecurityConfig{
+		HSTSMaxAge:                365 * 24 * time.Hour,
+		HSTSIncludeSubdomains:     true,
+		ContentSecurityPolicy:     "default-src 'none'; frame-ancestors 'none'; base-uri 'none'; form-action 'none'",
+		ContentTypeOptions:        "nosniff",
+		FrameOptions:              "DENY",
+		ReferrerPolicy:            "no-referrer",
+		PermissionsPolicy:         "camera=(), microphone=(), geolocation=(), payment=(), usb=()",
+		CrossOriginOpenerPolicy:   "same-origin",
+		CrossOriginResourcePolicy: "same-origin",
+	}
+}
+
+// SwaggerSecurityConfig loosens the API policy for the Swagger UI, whose page
+// runs inline scripts and styles and shows inline images. 'unsafe-inline'
+// cannot be combined with a nonce, which browsers would prefer over it.
+func SwaggerSecurityConfig() SecurityConfig {
+	config := DefaultSecurityConfig()
+	config.ContentSecurityPolicy = "default-src 'self'; script-src 'self' 'unsafe-inline'; " +
+		"style-src 'self' 'unsafe-inline'; img-src 'self' data:; connect-src 'self'; " +
+		"frame-ancestors 'self'; base-uri 'self'; form-action 'self'"
+	config.FrameOptions = "SAMEORIGIN"
+	config.ReferrerPolicy = "strict-origin-when-cross-origin"
+	return config
+}
+
+// SecurityConfigFromEnv returns the default policy overridden by
+// SECURITY_HSTS_MAX_AGE (e.g. 8760h, 0 to disable HSTS),
+// SECURITY_TRUST_FORWARDED_PROTO and SECURITY_CSP. HSTS is only on by
+// default when APP_ENV=production, a development host served over HTTPS once
+// would otherwise be pinned to it for a year.
+func SecurityConfigFromEnv() SecurityConfig {
+	config := securityConfigFromEnv(DefaultSecurityConfig())
+	if value := os.Getenv("SECURITY_CSP"); value != "" {
+		config.ContentSecurityPolicy = value
+	}
+	return config
+}
+
+// SwaggerSecurityConfigFromEnv returns the Swagger UI policy with the HSTS
+// settings of SecurityConfigFromEnv
+func SwaggerSecurityConfigFromEnv() SecurityConfig {
+	return securityConfigFromEnv(SwaggerSecurityConfig())
+}
+
+// securityConfigFromEnv overrides the HSTS settings of config from the environment
+func securityConfigFromEnv(config SecurityConfig) SecurityConfig {
+	if os.Getenv("APP_ENV") != "production" {
+		config.HSTSMaxAge = 0
+	}
+	if value, err := time.ParseDuration(os.Getenv("SECURITY_HSTS_MAX_AGE")); err == nil {
+		config.HSTSMaxAge = value
+	}
+	config.TrustForwardedProto = os.Getenv("SECURITY_TRUST_FORWARDED_PROTO") == "true"
+	return config
+}
+
+// nonceKey is the key of the CSP nonce in a request context
+type nonceKey struct{}
+
+// CSPNonce returns the Content-Security-Policy nonce of a request, for the
+// nonce attribute of the inline scripts and styles of views:
+// <script nonce="{{.Nonce}}">. It is "" when the policy has no NoncePlaceholder.
+func CSPNonce(r *http.Request) string {
+	nonce, _ := r.Context().Value(nonceKey{}).(string)
+	return nonce
+}
+
+// SecurityHeaders sets the security headers of config on responses. Applied
+// again around some routes, e.g. the Swagger UI, it replaces the headers set
+// by the global policy. Strict-Transport-Security is only set on HTTPS
+// requests, browsers ignore it over HTTP.
+func SecurityHeaders(config SecurityConfig) func(http.Handler) http.Handler {
+	headers := map[string]string{
+		"X-Content-Type-Options":       config.ContentTypeOptions,
+		"X-Frame-Options":              config.FrameOptions,
+		"Referrer-Policy":              config.ReferrerPolicy,
+		"Permissions-Policy":           config.PermissionsPolicy,
+		"Cross-Origin-Opener-Policy":   config.CrossOriginOpenerPolicy,
+		"Cross-Origin-Resource-Policy": config.CrossOriginResourcePolicy,
+		"Cross-Origin-Embedder-Policy": config.CrossOriginEmbedderPolicy,
+	}
+	hsts := ""
+	if config.HSTSMaxAge > 0 {
+		hsts = fmt.Sprintf("max-age=%d", int(config.HSTSMaxAge.Seconds()))
+		if config.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if config.HSTSPreload {
+			hsts += "; preload"
+		}
+	}
+	withNonce := strings.Contains(config.ContentSecurityPolicy, NoncePlaceholder)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for name, value := range headers {
+				if value == "" {
+					w.Header().Del(name)
+				} else {
+					w.Header().Set(name, value)
+				}
+			}
+			if hsts != "" && (r.TLS != nil || config.TrustForwardedProto && r.Header.Get("X-Forwarded-Proto") == "https") {
+				w.Header().Set("Strict-Transport-Security", hsts)
+			}
+
+			policy := config.ContentSecurityPolicy
+			if withNonce {
+				nonce := newNonce()
+				policy = strings.ReplaceAll(policy, NoncePlaceholder, nonce)
+				r = r.WithContext(context.WithValue(r.Context(), nonceKey{}, nonce))
+			} else if CSPNonce(r) != "" {
+				// The nonce of an outer policy is not part of this one
+				r = r.WithContext(context.WithValue(r.Context(), nonceKey{}, ""))
+			}
+			if policy == "" {
+				w.Header().Del("Content-Security-Policy")
+			} else {
+				w.Header().Set("Content-Security-Policy", policy)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// newNonce returns 128 random bits, base64 encoded
+func newNonce() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
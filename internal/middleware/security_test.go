@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSecurityHeadersHSTS(t *testing.T) {
+	tests := []struct {
+		name    string
+		trust   bool
+		tls     bool
+		proto   string
+		enabled bool
+	}{
+		{name: "plain http", enabled: false},
+		{name: "tls", tls: true, enabled: true},
+		{name: "untrusted forwarded proto", proto: "https", enabled: false},
+		{name: "trusted forwarded proto", trust: true, proto: "https", enabled: true},
+		{name: "trusted forwarded http", trust: true, proto: "http", enabled: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultSecurityConfig()
+			config.TrustForwardedProto = tt.trust
+			handler := SecurityHeaders(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			if tt.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			hsts := w.Header().Get("Strict-Transport-Security")
+			if (hsts != "") != tt.enabled {
+				t.Errorf("Strict-Transport-Security = %q, want it set %v", hsts, tt.enabled)
+			}
+			if tt.enabled && !strings.HasPrefix(hsts, "max-age=31536000") {
+				t.Errorf("Strict-Transport-Security = %q, want a year", hsts)
+			}
+		})
+	}
+}
+
+func TestSecurityConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name   string
+		env    string
+		maxAge string
+		trust  string
+		want   time.Duration
+	}{
+		{name: "development", env: "development", want: 0},
+		{name: "production", env: "production", want: 365 * 24 * time.Hour},
+		{name: "overridden in development", env: "development", maxAge: "1h", want: time.Hour},
+		{name: "disabled in production", env: "production", maxAge: "0", want: 0},
+		{name: "trusted proxy", env: "production", trust: "true", want: 365 * 24 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("APP_ENV", tt.env)
+			t.Setenv("SECURITY_HSTS_MAX_AGE", tt.maxAge)
+			t.Setenv("SECURITY_TRUST_FORWARDED_PROTO", tt.trust)
+
+			for _, config := range []SecurityConfig{SecurityConfigFromEnv(), SwaggerSecurityConfigFromEnv()} {
+				if config.HSTSMaxAge != tt.want {
+					t.Errorf("HSTSMaxAge = %v, want %v", config.HSTSMaxAge, tt.want)
+				}
+				if config.TrustForwardedProto != (tt.trust == "true") {
+					t.Errorf("TrustForwardedProto = %v with %q", config.TrustForwardedProto, tt.trust)
+				}
+			}
+		})
+	}
+}
+
+func TestSecurityHeadersNonce(t *testing.T) {
+	config := DefaultSecurityConfig()
+	config.ContentSecurityPolicy = "script-src 'self' 'nonce-" + NoncePlaceholder + "'"
+	var nonces []string
+	handler := SecurityHeaders(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonces = append(nonces, CSPNonce(r))
+	}))
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		nonce := nonces[len(nonces)-1]
+		if nonce == "" || w.Header().Get("Content-Security-Policy") != "script-src 'self' 'nonce-"+nonce+"'" {
+			t.Errorf("policy = %q with nonce %q", w.Header().Get("Content-Security-Policy"), nonce)
+		}
+	}
+	if nonces[0] == nonces[1] {
+		t.Error("two requests got the same nonce")
+	}
+
+	// An inner policy without a nonce hides the nonce of the outer one
+	inner := SecurityHeaders(DefaultSecurityConfig())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if CSPNonce(r) != "" {
+			t.Errorf("CSPNonce() = %q under a policy without a nonce", CSPNonce(r))
+		}
+	}))
+	SecurityHeaders(config)(inner).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
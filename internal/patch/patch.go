@@ -0,0 +1,175 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+	"went-framework/internal/handlers"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+)
+
+// Supported patch media types
+const (
+	MergePatch = "application/merge-patch+json" // RFC 7396
+	JSONPatch  = "application/json-patch+json"  // RFC 6902
+)
+
+// Patchable is implemented by models that accept PATCH requests.
+// Fields are named by their JSON name.
+type Patchable interface {
+	PatchableFields() []string
+}
+
+// Apply applies the patch in body, of the given Content-Type, to model (a pointer
+// to a struct). Only the model's patchable fields are written; JSON Patch "test"
+// operations may check any field, e.g. {"op": "test", "path": "/version", "value": 3}.
+func Apply(model interface{}, contentType string, body []byte) error {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || (mediaType != MergePatch && mediaType != JSONPatch) {
+		return handlers.NewError(http.StatusUnsupportedMediaType, handlers.CodeUnsupportedMediaType,
+			fmt.Sprintf("PATCH requires Content-Type %s or %s", MergePatch, JSONPatch))
+	}
+
+	allowed := map[string]bool{}
+	if p, ok := model.(Patchable); ok {
+		for _, field := range p.PatchableFields() {
+			allowed[field] = true
+		}
+	}
+
+	doc, err := json.Marshal(model)
+	if err != nil {
+		return err
+	}
+
+	var patched []byte
+	if mediaType == MergePatch {
+		patched, err = applyMergePatch(doc, body, allowed)
+	} else {
+		patched, err = applyJSONPatch(doc, body, allowed)
+	}
+	if err != nil {
+		return err
+	}
+
+	return copyFields(model, patched, allowed)
+}
+
+// applyMergePatch applies an RFC 7396 merge patch, which must be an object of patchable fields
+func applyMergePatch(doc, body []byte, allowed map[string]bool) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, handlers.BadRequest("Invalid merge patch, expected a JSON object")
+	}
+	for field := range fields {
+		if !allowed[field] {
+			return nil, handlers.BadRequest(fmt.Sprintf("Patching '%s' is not allowed", field))
+		}
+	}
+
+	patched, err := jsonpatch.MergePatch(doc, body)
+	if err != nil {
+		return nil, handlers.BadRequest("Invalid merge patch")
+	}
+	return patched, nil
+}
+
+// applyJSONPatch applies an RFC 6902 JSON patch whose write operations target patchable fields
+func applyJSONPatch(doc, body []byte, allowed map[string]bool) ([]byte, error) {
+	operations, err := jsonpatch.DecodePatch(body)
+	if err != nil {
+		return nil, handlers.BadRequest("Invalid JSON patch, expected an array of operations")
+	}
+
+	for _, operation := range operations {
+		path, err := operation.Path()
+		if err != nil {
+			return nil, handlers.BadRequest("Invalid JSON patch, every operation needs a path")
+		}
+		if operation.Kind() == "test" {
+			continue
+		}
+		if field := topLevelField(path); !allowed[field] {
+			return nil, handlers.BadRequest(fmt.Sprintf("Patching '%s' is not allowed", field))
+		}
+		// move removes its source, so it must be patchable as well
+		if operation.Kind() == "move" {
+			from, _ := operation.From()
+			if field := topLevelField(from); !allowed[field] {
+				return nil, handlers.BadRequest(fmt.Sprintf("Patching '%s' is not allowed", field))
+			}
+		}
+	}
+
+	patched, err := operations.Apply(doc)
+	if errors.Is(err, jsonpatch.ErrTestFailed) {
+		return nil, handlers.Conflict("JSON patch test operation failed")
+	}
+	if err != nil {
+		return nil, handlers.BadRequest(fmt.Sprintf("Invalid JSON patch: %v", err))
+	}
+	return patched, nil
+}
+
+// topLevelField returns the unescaped first segment of a JSON pointer
+func topLevelField(pointer string) string {
+	field := strings.SplitN(strings.TrimPrefix(pointer, "/"), "/", 2)[0]
+	return strings.ReplaceAll(strings.ReplaceAll(field, "~1", "/"), "~0", "~")
+}
+
+// copyFields sets the allowed fields of model from the patched document. Fields
+// that were removed or set to null are reset to their zero value.
+func copyFields(model interface{}, patched []byte, allowed map[string]bool) error {
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(patched, &values); err != nil {
+		return handlers.BadRequest("Invalid patch result, expected a JSON object")
+	}
+
+	v := reflect.ValueOf(model).Elem()
+	for field := range allowed {
+		target, ok := fieldByJSONName(v, field)
+		if !ok {
+			continue
+		}
+
+		target.Set(reflect.Zero(target.Type()))
+		if value, ok := values[field]; ok {
+			if err := json.Unmarshal(value, target.Addr().Interface()); err != nil {
+				return handlers.BadRequest(fmt.Sprintf("Invalid value for '%s'", field))
+			}
+		}
+	}
+
+	return nil
+}
+
+// fieldByJSONName finds the struct field encoded under the given JSON name,
+// looking into embedded structs like encoding/json does
+func fieldByJSONName(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		jsonTag := field.Tag.Get("json")
+
+		if field.Anonymous && jsonTag == "" && field.Type.Kind() == reflect.Struct {
+			if found, ok := fieldByJSONName(v.Field(i), name); ok {
+				return found, true
+			}
+			continue
+		}
+
+		jsonName := strings.Split(jsonTag, ",")[0]
+		if jsonName == "" {
+			jsonName = field.Name
+		}
+		if jsonName == name && field.IsExported() {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
@@ -0,0 +1,175 @@
+package patch
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"went-framework/internal/handlers"
+)
+
+// Base is embedded like gorm.Model
+type Base struct {
+	ID      uint `json:"id"`
+	Version int  `json:"version"`
+}
+
+type profile struct {
+	Base
+	Name  string   `json:"name"`
+	Email string   `json:"email"`
+	Tags  []string `json:"tags"`
+	Role  string   `json:"role"`
+	Admin bool     `json:"admin"`
+}
+
+func (profile) PatchableFields() []string { return []string{"name", "email", "tags"} }
+
+func newProfile() *profile {
+	return &profile{Base: Base{ID: 7, Version: 3}, Name: "Ada", Email: "ada@example.com", Tags: []string{"a"}, Role: "user"}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		want        func(p *profile) bool
+	}{
+		{
+			name:        "merge patch",
+			contentType: MergePatch,
+			body:        `{"name":"Grace","email":null}`,
+			want:        func(p *profile) bool { return p.Name == "Grace" && p.Email == "" && p.Role == "user" },
+		},
+		{
+			name:        "merge patch with charset",
+			contentType: MergePatch + "; charset=utf-8",
+			body:        `{"name":"Grace"}`,
+			want:        func(p *profile) bool { return p.Name == "Grace" },
+		},
+		{
+			name:        "merge patch of a field not patchable",
+			contentType: MergePatch,
+			body:        `{"role":"admin"}`,
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "merge patch of an embedded field",
+			contentType: MergePatch,
+			body:        `{"id":1}`,
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "merge patch not an object",
+			contentType: MergePatch,
+			body:        `["name"]`,
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "json patch",
+			contentType: JSONPatch,
+			body:        `[{"op":"replace","path":"/name","value":"Grace"},{"op":"add","path":"/tags/-","value":"b"}]`,
+			want:        func(p *profile) bool { return p.Name == "Grace" && len(p.Tags) == 2 && p.Tags[1] == "b" },
+		},
+		{
+			name:        "json patch of a field not patchable",
+			contentType: JSONPatch,
+			body:        `[{"op":"replace","path":"/admin","value":true}]`,
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "json patch of a nested path of a field not patchable",
+			contentType: JSONPatch,
+			body:        `[{"op":"replace","path":"/version/x","value":1}]`,
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "json patch copy into a field not patchable",
+			contentType: JSONPatch,
+			body:        `[{"op":"copy","from":"/name","path":"/role"}]`,
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "json patch move from a field not patchable",
+			contentType: JSONPatch,
+			body:        `[{"op":"move","from":"/role","path":"/name"}]`,
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "json patch move between patchable fields",
+			contentType: JSONPatch,
+			body:        `[{"op":"move","from":"/email","path":"/name"}]`,
+			want:        func(p *profile) bool { return p.Name == "ada@example.com" && p.Email == "" },
+		},
+		{
+			name:        "json patch test of any field",
+			contentType: JSONPatch,
+			body:        `[{"op":"test","path":"/version","value":3},{"op":"replace","path":"/name","value":"Grace"}]`,
+			want:        func(p *profile) bool { return p.Name == "Grace" },
+		},
+		{
+			name:        "json patch failed test",
+			contentType: JSONPatch,
+			body:        `[{"op":"test","path":"/version","value":2},{"op":"replace","path":"/name","value":"Grace"}]`,
+			status:      http.StatusConflict,
+		},
+		{
+			name:        "json patch escaped path",
+			contentType: JSONPatch,
+			body:        `[{"op":"add","path":"/na~1me","value":"x"}]`,
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "json patch not an array",
+			contentType: JSONPatch,
+			body:        `{"op":"replace"}`,
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "unsupported content type",
+			contentType: "application/json",
+			body:        `{"name":"Grace"}`,
+			status:      http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newProfile()
+			err := Apply(p, tt.contentType, []byte(tt.body))
+			if tt.status != 0 {
+				var appErr *handlers.AppError
+				if !errors.As(err, &appErr) || appErr.Status != tt.status {
+					t.Fatalf("error = %v, want status %d", err, tt.status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.want(p) {
+				t.Errorf("patched = %+v", p)
+			}
+			if p.ID != 7 || p.Version != 3 || p.Role != "user" || p.Admin {
+				t.Errorf("fields not patchable changed: %+v", p)
+			}
+		})
+	}
+}
+
+func TestTopLevelField(t *testing.T) {
+	tests := map[string]string{
+		"/name":        "name",
+		"/tags/0":      "tags",
+		"/a~1b/c":      "a/b",
+		"/a~0b":        "a~b",
+		"/":            "",
+		"/address/zip": "address",
+	}
+	for pointer, want := range tests {
+		if got := topLevelField(pointer); got != want {
+			t.Errorf("topLevelField(%q) = %q, want %q", pointer, got, want)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package query
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	signingKey     []byte
+	signingKeyOnce sync.Once
+)
+
+// Cursor is the decoded form of an opaque pagination cursor.
+// It points at a row through its sort key value and id.
+type Cursor struct {
+	Field    string          `json:"f"`
+	Desc     bool            `json:"d,omitempty"`
+	Value    json.RawMessage `json:"v"`
+	ID       json.RawMessage `json:"id"`
+	Backward bool            `json:"b,omitempty"`
+}
+
+// CursorPage holds the metadata returned with a cursor-paginated response
+type CursorPage struct {
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+	PerPage    int    `json:"per_page"`
+}
+
+// Keyset paginates over a stable sort column with id as tie-breaker
+type Keyset struct {
+	Field  string
+	Desc   bool
+	Limit  int
+	Cursor *Cursor
+}
+
+// MinSigningKeyLength is the shortest APP_KEY accepted, in bytes
+const MinSigningKeyLength = 32
+
+// placeholderSigningKey is the APP_KEY once shipped in .env.example
+const placeholderSigningKey = "change-this-app-key"
+
+// ValidateSigningKey rejects an APP_KEY that clients could guess and sign
+// their own cursors with: the placeholder of .env.example, or keys shorter
+// than MinSigningKeyLength.
+func ValidateSigningKey(key string) error {
+	if key == placeholderSigningKey {
+		return fmt.Errorf("APP_KEY is the example placeholder, generate one with `openssl rand -base64 32`")
+	}
+	if len(key) < MinSigningKeyLength {
+		return fmt.Errorf("APP_KEY must be at least %d bytes long, got %d", MinSigningKeyLength, len(key))
+	}
+	return nil
+}
+
+// getSigningKey returns the key used to sign cursors.
+// APP_KEY should be set in production so cursors are valid across replicas and restarts.
+func getSigningKey() []byte {
+	signingKeyOnce.Do(func() {
+		if key := os.Getenv("APP_KEY"); key != "" {
+			if err := ValidateSigningKey(key); err != nil {
+				panic(err.Error())
+			}
+			signingKey = []byte(key)
+			return
+		}
+
+		// A failed read would leave a zero key that anyone can sign cursors with
+		signingKey = make([]byte, 32)
+		if _, err := rand.Read(signingKey); err != nil {
+			panic(fmt.Sprintf("cannot generate the cursor signing key: %v", err))
+		}
+	})
+	return signingKey
+}
+
+// sign computes the HMAC of an encoded cursor payload
+func sign(payload string) string {
+	mac := hmac.New(sha256.New, getSigningKey())
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// EncodeCursor encodes and signs a cursor
+func EncodeCursor(c Cursor) string {
+	data, _ := json.Marshal(c)
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + sign(payload)
+}
+
+// DecodeCursor verifies and decodes a cursor produced by EncodeCursor
+func DecodeCursor(s string) (*Cursor, error) {
+	payload, signature, ok := strings.Cut(s, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(sign(payload))) {
+		return nil, &Error{Message: "Invalid cursor"}
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, &Error{Message: "Invalid cursor"}
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, &Error{Message: "Invalid cursor"}
+	}
+
+	return &c, nil
+}
+
+// NewKeyset creates a keyset for the given sort, decoding the cursor if present.
+// A cursor created for a different sort is rejected.
+func NewKeyset(field string, desc bool, limit int, cursor string) (*Keyset, error) {
+	k := &Keyset{Field: field, Desc: desc, Limit: limit}
+
+	if cursor != "" {
+		c, err := DecodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		if c.Field != field || c.Desc != desc {
+			return nil, &Error{Message: "Cursor does not match the requested sort"}
+		}
+		k.Cursor = c
+	}
+
+	return k, nil
+}
+
+// Paginate loads the page after (or before) the cursor into dest, which must be a pointer to a slice
+func (k *Keyset) Paginate(db *gorm.DB, dest interface{}) (*CursorPage, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(dest); err != nil {
+		return nil, err
+	}
+
+	field := stmt.Schema.LookUpField(k.Field)
+	idField := stmt.Schema.LookUpField("id")
+	if field == nil || idField == nil {
+		return nil, fmt.Errorf("cannot paginate %s by %s", stmt.Schema.Table, k.Field)
+	}
+
+	// Walking backwards flips the comparison and the order; rows are reversed afterwards
+	backward := k.Cursor != nil && k.Cursor.Backward
+	desc := k.Desc != backward
+
+	tx := db.Session(&gorm.Session{})
+	if k.Cursor != nil {
+		value, err := decodeValue(k.Cursor.Value, field.FieldType)
+		if err != nil {
+			return nil, err
+		}
+		id, err := decodeValue(k.Cursor.ID, idField.FieldType)
+		if err != nil {
+			return nil, err
+		}
+
+		op := ">"
+		if desc {
+			op = "<"
+		}
+		tx = tx.Where(fmt.Sprintf("(%s, %s) %s (?, ?)",
+			tx.Statement.Quote(field.DBName), tx.Statement.Quote(idField.DBName), op), value, id)
+	}
+
+	err := tx.
+		Order(clause.OrderByColumn{Column: clause.Column{Name: field.DBName}, Desc: desc}).
+		Order(clause.OrderByColumn{Column: clause.Column{Name: idField.DBName}, Desc: desc}).
+		Limit(k.Limit + 1).
+		Find(dest).Error
+	if err != nil {
+		return nil, err
+	}
+
+	rows := reflect.ValueOf(dest).Elem()
+	hasMore := rows.Len() > k.Limit
+	if hasMore {
+		rows.Set(rows.Slice(0, k.Limit))
+	}
+	if backward {
+		swap := reflect.Swapper(rows.Interface())
+		for i, j := 0, rows.Len()-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+	}
+
+	page := &CursorPage{PerPage: k.Limit}
+	if rows.Len() == 0 {
+		return page, nil
+	}
+
+	cursorAt := func(row reflect.Value, backward bool) string {
+		value, _ := field.ValueOf(db.Statement.Context, reflect.Indirect(row))
+		id, _ := idField.ValueOf(db.Statement.Context, reflect.Indirect(row))
+		rawValue, _ := json.Marshal(value)
+		rawID, _ := json.Marshal(id)
+		return EncodeCursor(Cursor{
+			Field:    k.Field,
+			Desc:     k.Desc,
+			Value:    rawValue,
+			ID:       rawID,
+			Backward: backward,
+		})
+	}
+
+	// Coming from a backward cursor there is always a next page, and vice versa
+	if hasMore || backward {
+		page.NextCursor = cursorAt(rows.Index(rows.Len()-1), false)
+	}
+	if (hasMore && backward) || (!backward && k.Cursor != nil) {
+		page.PrevCursor = cursorAt(rows.Index(0), true)
+	}
+
+	return page, nil
+}
+
+// decodeValue decodes a raw cursor value into the Go type of the column it belongs to
+func decodeValue(raw json.RawMessage, t reflect.Type) (interface{}, error) {
+	value := reflect.New(t)
+	if err := json.Unmarshal(raw, value.Interface()); err != nil {
+		return nil, &Error{Message: "Invalid cursor"}
+	}
+	return value.Elem().Interface(), nil
+}
+
+// LinkHeader builds an RFC 8288 Link header with next and prev relations for the page
+func LinkHeader(u *url.URL, page *CursorPage) string {
+	var links []string
+
+	link := func(cursor, rel string) string {
+		next := *u
+		values := next.Query()
+		values.Set("cursor", cursor)
+		values.Set("per_page", fmt.Sprintf("%d", page.PerPage))
+		next.RawQuery = values.Encode()
+		return fmt.Sprintf(`<%s>; rel="%s"`, next.String(), rel)
+	}
+
+	if page.NextCursor != "" {
+		links = append(links, link(page.NextCursor, "next"))
+	}
+	if page.PrevCursor != "" {
+		links = append(links, link(page.PrevCursor, "prev"))
+	}
+
+	return strings.Join(links, ", ")
+}
@@ -0,0 +1,129 @@
+package query
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// withSigningKey signs cursors with key, as APP_KEY, for the rest of the test
+func withSigningKey(t *testing.T, key string) {
+	t.Helper()
+	t.Setenv("APP_KEY", key)
+	signingKey, signingKeyOnce = nil, sync.Once{}
+	t.Cleanup(func() { signingKey, signingKeyOnce = nil, sync.Once{} })
+}
+
+func TestValidateSigningKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		valid bool
+	}{
+		{"placeholder", "change-this-app-key", false},
+		{"too short", strings.Repeat("k", MinSigningKeyLength-1), false},
+		{"long enough", strings.Repeat("k", MinSigningKeyLength), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateSigningKey(tt.key); (err == nil) != tt.valid {
+				t.Errorf("ValidateSigningKey() error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	withSigningKey(t, strings.Repeat("a", 32))
+	cursor := Cursor{Field: "created_at", Desc: true, Value: json.RawMessage(`"2025-01-01"`), ID: json.RawMessage(`42`)}
+	encoded := EncodeCursor(cursor)
+	payload, signature, _ := strings.Cut(encoded, ".")
+
+	forged, _ := json.Marshal(Cursor{Field: "created_at", Desc: true, Value: json.RawMessage(`"2025-01-01"`), ID: json.RawMessage(`1`)})
+	forgedPayload := base64.RawURLEncoding.EncodeToString(forged)
+
+	tests := []struct {
+		name   string
+		cursor string
+		valid  bool
+	}{
+		{"signed", encoded, true},
+		{"payload changed", forgedPayload + "." + signature, false},
+		{"signature changed", payload + "." + strings.Repeat("A", len(signature)), false},
+		{"no signature", payload, false},
+		{"empty signature", payload + ".", false},
+		{"garbage", "not-a-cursor", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded, err := DecodeCursor(tt.cursor)
+			if !tt.valid {
+				if _, ok := err.(*Error); !ok {
+					t.Fatalf("error = %v, want query error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if decoded.Field != cursor.Field || decoded.Desc != cursor.Desc || string(decoded.ID) != "42" {
+				t.Errorf("decoded = %+v, want %+v", decoded, cursor)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorOtherKey(t *testing.T) {
+	withSigningKey(t, strings.Repeat("a", 32))
+	encoded := EncodeCursor(Cursor{Field: "id", ID: json.RawMessage(`1`)})
+
+	withSigningKey(t, strings.Repeat("b", 32))
+	if _, err := DecodeCursor(encoded); err == nil {
+		t.Error("cursor signed with another key was accepted")
+	}
+}
+
+func TestNewKeyset(t *testing.T) {
+	withSigningKey(t, strings.Repeat("a", 32))
+	cursor := EncodeCursor(Cursor{Field: "name", ID: json.RawMessage(`1`), Value: json.RawMessage(`"b"`)})
+
+	tests := []struct {
+		name  string
+		field string
+		desc  bool
+		err   string
+	}{
+		{"same sort", "name", false, ""},
+		{"other field", "id", false, "Cursor does not match the requested sort"},
+		{"other direction", "name", true, "Cursor does not match the requested sort"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyset, err := NewKeyset(tt.field, tt.desc, 10, cursor)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil || keyset.Cursor == nil || keyset.Limit != 10 {
+				t.Fatalf("keyset = %+v, error = %v", keyset, err)
+			}
+		})
+	}
+}
+
+func TestSigningKeyRejectsPlaceholder(t *testing.T) {
+	withSigningKey(t, "change-this-app-key")
+	defer func() {
+		if recover() == nil {
+			t.Error("signing with the placeholder key did not panic")
+		}
+	}()
+	EncodeCursor(Cursor{Field: "id"})
+}
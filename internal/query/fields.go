@@ -0,0 +1,366 @@
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Selectable is implemented by models that allow sparse fieldsets with
+// ?fields=id,name, or fields[type]=... for included relations of that type
+type Selectable interface {
+	SelectableFields() []string
+}
+
+// Fieldset holds the sparse fieldset of a resource and of its included relations.
+// It limits both the selected columns and the serialized fields.
+type Fieldset struct {
+	schema *schema.Schema
+	// path is the GORM preload path of an included relation, empty for the resource
+	path string
+	// fields holds the requested JSON field names, nil to return every field
+	fields map[string]bool
+	// keys holds the JSON names of fields that are selected but not returned,
+	// such as primary and foreign keys needed to load relations
+	keys map[string]bool
+	// relations holds the fieldsets of the included relations by JSON name
+	relations map[string]*Fieldset
+}
+
+// fieldsetType returns the resource type named by a fields parameter:
+// "" for ?fields= and the type for fields[type]
+func fieldsetType(key string) (string, bool) {
+	if key == "fields" {
+		return "", true
+	}
+	if name, ok := strings.CutPrefix(key, "fields["); ok && strings.HasSuffix(name, "]") {
+		return strings.TrimSuffix(name, "]"), true
+	}
+	return "", false
+}
+
+// ParseFields parses the sparse fieldsets of a request: ?fields= for the model
+// and fields[type]= for the model or included relations by type (table name),
+// e.g. ?fields=id,name&include=posts&fields[posts]=id,title. Fields are
+// whitelisted by each model through Selectable. It returns nil when no fieldset
+// is requested.
+func ParseFields(values url.Values, model interface{}) (*Fieldset, error) {
+	requested := map[string][]string{}
+	for key, vals := range values {
+		if typ, ok := fieldsetType(key); ok && len(vals) > 0 {
+			var fields []string
+			for _, field := range strings.Split(vals[0], ",") {
+				if field = strings.TrimSpace(field); field != "" {
+					fields = append(fields, field)
+				}
+			}
+			requested[typ] = fields
+		}
+	}
+	if len(requested) == 0 {
+		return nil, nil
+	}
+
+	s, err := schema.Parse(model, &schemaCache, schema.NamingStrategy{})
+	if err != nil {
+		return nil, err
+	}
+
+	// ?fields= is the fieldset of the resource itself and takes precedence over
+	// fields[type], which then only applies to included relations of the type
+	used := map[string]bool{}
+	rootType := s.Table
+	if _, ok := requested[""]; ok {
+		rootType = ""
+	}
+	root, err := newFieldset(s, rootType, "", requested, used)
+	if err != nil {
+		return nil, err
+	}
+
+	// Included relations get the fieldset of their type, ParseIncludes has
+	// validated the names already
+	for _, name := range strings.Split(values.Get("include"), ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		node := root
+		for _, part := range strings.Split(name, ".") {
+			relationship := findRelationship(node.schema, part)
+			if relationship == nil {
+				return nil, fmt.Errorf("%s has no relation %q", node.schema.Name, part)
+			}
+
+			child, ok := node.relations[part]
+			if !ok {
+				path := relationship.Name
+				if node.path != "" {
+					path = node.path + "." + path
+				}
+				if child, err = newFieldset(relationship.FieldSchema, relationship.FieldSchema.Table, path, requested, used); err != nil {
+					return nil, err
+				}
+				node.relations[part] = child
+			}
+			addRelationKeys(node, child, relationship)
+			node = child
+		}
+	}
+
+	types := make([]string, 0, len(requested))
+	for typ := range requested {
+		if !used[typ] {
+			types = append(types, typ)
+		}
+	}
+	if len(types) > 0 {
+		sort.Strings(types)
+		return nil, &Error{Message: fmt.Sprintf("fields[%s] does not match the resource or an included relation", types[0])}
+	}
+
+	return root, nil
+}
+
+// newFieldset creates the fieldset of a model from the fields requested for typ
+func newFieldset(s *schema.Schema, typ, path string, requested map[string][]string, used map[string]bool) (*Fieldset, error) {
+	f := &Fieldset{schema: s, path: path, keys: map[string]bool{}, relations: map[string]*Fieldset{}}
+
+	fields, ok := requested[typ]
+	if !ok {
+		return f, nil
+	}
+	used[typ] = true
+
+	allowed := map[string]bool{}
+	model := reflect.New(s.ModelType)
+	if selectable, ok := model.Elem().Interface().(Selectable); ok {
+		for _, field := range selectable.SelectableFields() {
+			allowed[field] = true
+		}
+	}
+
+	f.fields = map[string]bool{}
+	for _, field := range fields {
+		if !allowed[field] {
+			return nil, &Error{Message: fmt.Sprintf("Selecting '%s' of %s is not allowed", field, s.Table)}
+		}
+		f.fields[field] = true
+	}
+
+	// The primary key identifies rows
+	for _, field := range s.PrimaryFields {
+		f.keys[jsonName(field)] = true
+	}
+
+	return f, nil
+}
+
+// addRelationKeys marks the key columns that join a parent to an included
+// relation, so they are selected on both sides
+func addRelationKeys(parent, child *Fieldset, relationship *schema.Relationship) {
+	for _, ref := range relationship.References {
+		for _, field := range []*schema.Field{ref.PrimaryKey, ref.ForeignKey} {
+			if field == nil {
+				continue
+			}
+			switch field.Schema {
+			case parent.schema:
+				parent.keys[jsonName(field)] = true
+			case child.schema:
+				child.keys[jsonName(field)] = true
+			}
+		}
+	}
+}
+
+// jsonName returns the JSON name of a schema field
+func jsonName(field *schema.Field) string {
+	if name := strings.Split(field.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+		return name
+	}
+	return field.Name
+}
+
+// Require selects fields of the resource in SQL without returning them, e.g. sort keys
+func (f *Fieldset) Require(fields ...string) {
+	if f == nil {
+		return
+	}
+	for _, field := range fields {
+		f.keys[field] = true
+	}
+}
+
+// columns returns the database columns to select, nil to select all
+func (f *Fieldset) columns() []string {
+	if f == nil || f.fields == nil {
+		return nil
+	}
+
+	var columns []string
+	for _, field := range f.schema.Fields {
+		name := jsonName(field)
+		if field.DBName != "" && (f.fields[name] || f.keys[name] || f.keys[field.DBName]) {
+			columns = append(columns, field.DBName)
+		}
+	}
+	return columns
+}
+
+// SelectScope selects only the columns of the requested fields of the resource
+func (f *Fieldset) SelectScope(db *gorm.DB) *gorm.DB {
+	if columns := f.columns(); columns != nil {
+		qualified := make([]string, len(columns))
+		for i, column := range columns {
+			qualified[i] = f.schema.Table + "." + column
+		}
+		return db.Select(qualified)
+	}
+	return db
+}
+
+// PreloadScope eager loads the given preload paths, selecting only the requested
+// fields of the included relations
+func (f *Fieldset) PreloadScope(paths []string) func(*gorm.DB) *gorm.DB {
+	if f == nil {
+		return PreloadScope(paths)
+	}
+
+	return func(db *gorm.DB) *gorm.DB {
+		var preload func(node *Fieldset)
+		preload = func(node *Fieldset) {
+			names := make([]string, 0, len(node.relations))
+			for name := range node.relations {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			for _, name := range names {
+				child := node.relations[name]
+				if columns := child.columns(); columns != nil {
+					db = db.Preload(child.path, func(tx *gorm.DB) *gorm.DB {
+						return tx.Select(columns)
+					})
+				} else {
+					db = db.Preload(child.path)
+				}
+				preload(child)
+			}
+		}
+		preload(f)
+		return db
+	}
+}
+
+// Shape returns the JSON encoding of v, a resource representation, limited to
+// the requested fields. Included relations are always kept.
+func (f *Fieldset) Shape(v interface{}) (interface{}, error) {
+	if f == nil {
+		return v, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	shaped, err := f.shape(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(shaped), nil
+}
+
+// shape limits the fields of a JSON object or of the objects of a JSON list
+func (f *Fieldset) shape(data []byte) ([]byte, error) {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		var items []json.RawMessage
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, err
+		}
+		for i := range items {
+			shaped, err := f.shape(items[i])
+			if err != nil {
+				return nil, err
+			}
+			items[i] = shaped
+		}
+		return json.Marshal(items)
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		return f.shapeObject(trimmed)
+	default:
+		return data, nil
+	}
+}
+
+// shapeObject copies the requested fields and included relations of a JSON
+// object, keeping their order
+func (f *Fieldset) shapeObject(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	first := true
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key := token.(string)
+
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+
+		if relation, ok := f.relations[key]; ok {
+			if value, err = relation.shape(value); err != nil {
+				return nil, err
+			}
+		} else if f.fields != nil && !f.fields[key] {
+			continue
+		}
+
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		encodedKey, _ := json.Marshal(key)
+		buf.Write(encodedKey)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// IncludedModel returns a zero value of the model of a relation, named by its
+// dotted JSON name, and its type as used in fields[type]
+func IncludedModel(model interface{}, name string) (interface{}, string, error) {
+	s, err := schema.Parse(model, &schemaCache, schema.NamingStrategy{})
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, part := range strings.Split(name, ".") {
+		relationship := findRelationship(s, part)
+		if relationship == nil {
+			return nil, "", fmt.Errorf("%s has no relation %q", s.Name, part)
+		}
+		s = relationship.FieldSchema
+	}
+
+	return reflect.New(s.ModelType).Elem().Interface(), s.Table, nil
+}
@@ -0,0 +1,152 @@
+package query
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// schemaCache caches parsed model schemas used to resolve relations
+var schemaCache sync.Map
+
+// Includable is implemented by models that allow ?include=relation eager loading.
+// Relations are named by their JSON field, nested ones with dots (e.g. "posts.user").
+type Includable interface {
+	IncludableRelations() []string
+}
+
+// ParseIncludes validates ?include= against the model's whitelist and returns
+// the GORM preload paths for the requested relations
+func ParseIncludes(values url.Values, model interface{}) ([]string, error) {
+	param := values.Get("include")
+	if param == "" {
+		return nil, nil
+	}
+
+	allowed := map[string]bool{}
+	if i, ok := model.(Includable); ok {
+		for _, relation := range i.IncludableRelations() {
+			allowed[relation] = true
+		}
+	}
+
+	var paths []string
+	for _, name := range strings.Split(param, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !allowed[name] {
+			return nil, &Error{Message: fmt.Sprintf("Including '%s' is not allowed", name)}
+		}
+
+		path, err := resolveRelationPath(model, name)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
+// resolveRelationPath maps a dotted JSON relation name to the GORM field path
+func resolveRelationPath(model interface{}, name string) (string, error) {
+	s, err := schema.Parse(model, &schemaCache, schema.NamingStrategy{})
+	if err != nil {
+		return "", err
+	}
+
+	var fields []string
+	for _, part := range strings.Split(name, ".") {
+		relationship := findRelationship(s, part)
+		if relationship == nil {
+			return "", fmt.Errorf("%s has no relation %q", s.Name, part)
+		}
+		fields = append(fields, relationship.Name)
+		s = relationship.FieldSchema
+	}
+
+	return strings.Join(fields, "."), nil
+}
+
+// findRelationship finds a relationship by the JSON name of its field
+func findRelationship(s *schema.Schema, name string) *schema.Relationship {
+	for _, relationship := range s.Relationships.Relations {
+		jsonName := strings.Split(relationship.Field.Tag.Get("json"), ",")[0]
+		if jsonName == name || (jsonName == "" && strings.EqualFold(relationship.Name, name)) {
+			return relationship
+		}
+	}
+	return nil
+}
+
+// PreloadScope returns a scope that eager loads the given preload paths
+func PreloadScope(paths []string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		for _, path := range paths {
+			db = db.Preload(path)
+		}
+		return db
+	}
+}
+
+// RelationScope restricts a query on the related model of parent's relation
+// (by JSON name) to the rows associated with parentID. It supports has-one,
+// has-many and many-to-many relations.
+func RelationScope(parent interface{}, relation string, parentID interface{}) (func(*gorm.DB) *gorm.DB, error) {
+	s, err := schema.Parse(parent, &schemaCache, schema.NamingStrategy{})
+	if err != nil {
+		return nil, err
+	}
+
+	relationship := findRelationship(s, relation)
+	if relationship == nil {
+		return nil, fmt.Errorf("%s has no relation %q", s.Name, relation)
+	}
+
+	switch relationship.Type {
+	case schema.HasOne, schema.HasMany:
+		return func(db *gorm.DB) *gorm.DB {
+			for _, ref := range relationship.References {
+				if ref.OwnPrimaryKey {
+					db = db.Where(fmt.Sprintf("%s.%s = ?",
+						db.Statement.Quote(relationship.FieldSchema.Table), db.Statement.Quote(ref.ForeignKey.DBName)), parentID)
+				} else {
+					db = db.Where(fmt.Sprintf("%s.%s = ?",
+						db.Statement.Quote(relationship.FieldSchema.Table), db.Statement.Quote(ref.ForeignKey.DBName)), ref.PrimaryValue)
+				}
+			}
+			return db
+		}, nil
+
+	case schema.Many2Many:
+		return func(db *gorm.DB) *gorm.DB {
+			joinTable := db.Statement.Quote(relationship.JoinTable.Table)
+
+			var selectColumn, relatedColumn string
+			var conditions []string
+			var vars []interface{}
+			for _, ref := range relationship.References {
+				if ref.OwnPrimaryKey {
+					conditions = append(conditions, fmt.Sprintf("%s = ?", db.Statement.Quote(ref.ForeignKey.DBName)))
+					vars = append(vars, parentID)
+				} else {
+					selectColumn = db.Statement.Quote(ref.ForeignKey.DBName)
+					relatedColumn = fmt.Sprintf("%s.%s",
+						db.Statement.Quote(relationship.FieldSchema.Table), db.Statement.Quote(ref.PrimaryKey.DBName))
+				}
+			}
+
+			return db.Where(fmt.Sprintf("%s IN (SELECT %s FROM %s WHERE %s)",
+				relatedColumn, selectColumn, joinTable, strings.Join(conditions, " AND ")), vars...)
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("relation %q of %s cannot be listed as a nested resource", relation, s.Name)
+	}
+}
@@ -0,0 +1,389 @@
+package query
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// DefaultPerPage is used when the request does not specify per_page
+	DefaultPerPage = 15
+	// MaxPerPage caps per_page so a client cannot fetch a whole table at once
+	MaxPerPage = 100
+	// MaxPage caps page so the offset cannot overflow, deeper pages need a cursor
+	MaxPage = 1000000
+)
+
+// Filterable is implemented by models that allow ?filter[field]=value on list endpoints
+type Filterable interface {
+	FilterableFields() []string
+}
+
+// Sortable is implemented by models that allow ?sort=field on list endpoints
+type Sortable interface {
+	SortableFields() []string
+}
+
+// Operators lists the supported filter operators, e.g. filter[created_at][gte]=2025-01-01
+var Operators = []string{"eq", "ne", "gt", "gte", "lt", "lte", "like", "in", "null"}
+
+// likeEscaper escapes the wildcards and the escape character of LIKE patterns
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// Filter represents a single filter[field][op]=value condition
+type Filter struct {
+	Field    string
+	Operator string
+	Value    string
+}
+
+// Sort represents a single sort field
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// Params holds the parsed filtering, sorting and pagination parameters of a request
+type Params struct {
+	Filters []Filter
+	Sorts   []Sort
+	Page    int
+	PerPage int
+
+	// Includes holds the GORM preload paths requested with ?include=
+	Includes []string
+
+	// Keyset is set when the request asks for cursor pagination with ?cursor=
+	Keyset *Keyset
+
+	// Fields is set when the request asks for sparse fieldsets with ?fields=
+	Fields *Fieldset
+
+	// search is set when the request has a ?q= full-text search term
+	search *search
+}
+
+// Pagination holds the metadata returned with a paginated response
+type Pagination struct {
+	Total    int64 `json:"total"`
+	Page     int   `json:"page"`
+	PerPage  int   `json:"per_page"`
+	LastPage int   `json:"last_page"`
+}
+
+// Error is returned when the query string is invalid and should result in a 400
+type Error struct {
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Parse parses filter, sort, page and per_page from the query string.
+// Only fields whitelisted by the model through Filterable and Sortable are accepted.
+func Parse(values url.Values, model interface{}) (*Params, error) {
+	params := &Params{
+		Page:    1,
+		PerPage: DefaultPerPage,
+	}
+
+	filterable := map[string]bool{}
+	if f, ok := model.(Filterable); ok {
+		for _, field := range f.FilterableFields() {
+			filterable[field] = true
+		}
+	}
+
+	sortable := map[string]bool{}
+	if s, ok := model.(Sortable); ok {
+		for _, field := range s.SortableFields() {
+			sortable[field] = true
+		}
+	}
+
+	// Iterate keys in order so the generated SQL is stable between requests
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		vals := values[key]
+		if !strings.HasPrefix(key, "filter[") || len(vals) == 0 {
+			continue
+		}
+
+		field, operator, err := parseFilterKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if !filterable[field] {
+			return nil, &Error{Message: fmt.Sprintf("Filtering by '%s' is not allowed", field)}
+		}
+		if !isOperator(operator) {
+			return nil, &Error{Message: fmt.Sprintf("Unknown filter operator '%s'", operator)}
+		}
+
+		params.Filters = append(params.Filters, Filter{
+			Field:    field,
+			Operator: operator,
+			Value:    vals[0],
+		})
+	}
+
+	if term := strings.TrimSpace(values.Get("q")); term != "" {
+		s, ok := model.(Searchable)
+		if !ok {
+			return nil, &Error{Message: "Search is not supported for this resource"}
+		}
+		params.search = &search{
+			term:   term,
+			table:  s.TableName(),
+			fields: s.SearchableFields(),
+		}
+	}
+
+	if sortParam := values.Get("sort"); sortParam != "" {
+		for _, field := range strings.Split(sortParam, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+
+			desc := strings.HasPrefix(field, "-")
+			field = strings.TrimPrefix(field, "-")
+
+			if !sortable[field] {
+				return nil, &Error{Message: fmt.Sprintf("Sorting by '%s' is not allowed", field)}
+			}
+
+			params.Sorts = append(params.Sorts, Sort{Field: field, Desc: desc})
+		}
+	}
+
+	if page := values.Get("page"); page != "" {
+		n, err := strconv.Atoi(page)
+		if err != nil || n < 1 {
+			return nil, &Error{Message: "Invalid page parameter"}
+		}
+		if n > MaxPage {
+			return nil, &Error{Message: fmt.Sprintf("Page cannot exceed %d, use cursor pagination", MaxPage)}
+		}
+		params.Page = n
+	}
+
+	if perPage := values.Get("per_page"); perPage != "" {
+		n, err := strconv.Atoi(perPage)
+		if err != nil || n < 1 {
+			return nil, &Error{Message: "Invalid per_page parameter"}
+		}
+		if n > MaxPerPage {
+			n = MaxPerPage
+		}
+		params.PerPage = n
+	}
+
+	includes, err := ParseIncludes(values, model)
+	if err != nil {
+		return nil, err
+	}
+	params.Includes = includes
+
+	// An empty ?cursor= requests the first page in cursor mode
+	if values.Has("cursor") {
+		keyset, err := params.newKeyset(values.Get("cursor"))
+		if err != nil {
+			return nil, err
+		}
+		params.Keyset = keyset
+	}
+
+	fields, err := ParseFields(values, model)
+	if err != nil {
+		return nil, err
+	}
+	// Sort keys must be selected to order and paginate by them
+	for _, s := range params.Sorts {
+		fields.Require(s.Field)
+	}
+	params.Fields = fields
+
+	return params, nil
+}
+
+// newKeyset builds the keyset for cursor pagination from the parsed sort.
+// Cursors need a single stable sort key; id is used when none is given.
+func (p *Params) newKeyset(cursor string) (*Keyset, error) {
+	sorts := p.Sorts
+	if len(sorts) > 1 && sorts[len(sorts)-1].Field == "id" {
+		sorts = sorts[:len(sorts)-1]
+	}
+	if len(sorts) > 1 {
+		return nil, &Error{Message: "Cursor pagination supports a single sort field"}
+	}
+
+	field, desc := "id", false
+	if len(sorts) == 1 {
+		field, desc = sorts[0].Field, sorts[0].Desc
+	}
+
+	return NewKeyset(field, desc, p.PerPage, cursor)
+}
+
+// parseFilterKey splits "filter[field]" or "filter[field][op]" into field and operator
+func parseFilterKey(key string) (string, string, error) {
+	rest := strings.TrimPrefix(key, "filter")
+
+	var parts []string
+	for rest != "" {
+		if !strings.HasPrefix(rest, "[") {
+			return "", "", &Error{Message: fmt.Sprintf("Malformed filter parameter '%s'", key)}
+		}
+		end := strings.Index(rest, "]")
+		if end == -1 {
+			return "", "", &Error{Message: fmt.Sprintf("Malformed filter parameter '%s'", key)}
+		}
+		parts = append(parts, rest[1:end])
+		rest = rest[end+1:]
+	}
+
+	switch len(parts) {
+	case 1:
+		return parts[0], "eq", nil
+	case 2:
+		return parts[0], parts[1], nil
+	default:
+		return "", "", &Error{Message: fmt.Sprintf("Malformed filter parameter '%s'", key)}
+	}
+}
+
+// isOperator checks if op is a supported filter operator
+func isOperator(op string) bool {
+	for _, o := range Operators {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// Searching reports whether the request has a ?q= search term
+func (p *Params) Searching() bool {
+	return p.search != nil
+}
+
+// FilterScope applies the parsed filters and search term as a GORM scope
+func (p *Params) FilterScope(db *gorm.DB) *gorm.DB {
+	if p.search != nil {
+		db = db.Where(p.search.where(db))
+	}
+
+	for _, f := range p.Filters {
+		column := clause.Column{Name: f.Field}
+
+		switch f.Operator {
+		case "ne":
+			db = db.Where(clause.Neq{Column: column, Value: f.Value})
+		case "gt":
+			db = db.Where(clause.Gt{Column: column, Value: f.Value})
+		case "gte":
+			db = db.Where(clause.Gte{Column: column, Value: f.Value})
+		case "lt":
+			db = db.Where(clause.Lt{Column: column, Value: f.Value})
+		case "lte":
+			db = db.Where(clause.Lte{Column: column, Value: f.Value})
+		case "like":
+			// Wildcards in the value match themselves, like means contains
+			db = db.Where(clause.Expr{SQL: "? LIKE ? ESCAPE '\\'",
+				Vars: []interface{}{column, "%" + likeEscaper.Replace(f.Value) + "%"}})
+		case "in":
+			var values []interface{}
+			for _, v := range strings.Split(f.Value, ",") {
+				values = append(values, strings.TrimSpace(v))
+			}
+			db = db.Where(clause.IN{Column: column, Values: values})
+		case "null":
+			if f.Value == "false" || f.Value == "0" {
+				db = db.Where(clause.Neq{Column: column, Value: nil})
+			} else {
+				db = db.Where(clause.Eq{Column: column, Value: nil})
+			}
+		default: // eq
+			db = db.Where(clause.Eq{Column: column, Value: f.Value})
+		}
+	}
+	return db
+}
+
+// SortScope applies the parsed sort fields as a GORM scope.
+// Searches without an explicit sort are ordered by rank.
+// id is always appended as a tie-breaker so pages don't overlap.
+func (p *Params) SortScope(db *gorm.DB) *gorm.DB {
+	if p.search != nil && len(p.Sorts) == 0 {
+		// An expression replaces any column ordering, so the tie-breaker is part of it
+		rank := p.search.rank(db)
+		return db.Order(clause.OrderBy{Expression: clause.Expr{
+			SQL:  fmt.Sprintf("%s DESC, %s", rank.SQL, db.Statement.Quote("id")),
+			Vars: rank.Vars,
+		}})
+	}
+
+	hasID := false
+	for _, s := range p.Sorts {
+		db = db.Order(clause.OrderByColumn{Column: clause.Column{Name: s.Field}, Desc: s.Desc})
+		if s.Field == "id" {
+			hasID = true
+		}
+	}
+
+	if !hasID {
+		db = db.Order(clause.OrderByColumn{Column: clause.Column{Name: "id"}})
+	}
+	return db
+}
+
+// PageScope applies offset and limit for the requested page
+func (p *Params) PageScope(db *gorm.DB) *gorm.DB {
+	return db.Offset((p.Page - 1) * p.PerPage).Limit(p.PerPage)
+}
+
+// Paginate counts the filtered rows and loads the requested page into dest
+func (p *Params) Paginate(db *gorm.DB, dest interface{}) (*Pagination, error) {
+	// Start a new session so the count and the select don't share conditions
+	db = db.Session(&gorm.Session{})
+
+	var total int64
+	if err := db.Model(dest).Scopes(p.FilterScope).Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	if err := db.Scopes(p.FilterScope, p.Fields.SelectScope, p.Fields.PreloadScope(p.Includes), p.SortScope, p.PageScope).Find(dest).Error; err != nil {
+		return nil, err
+	}
+
+	lastPage := int(math.Ceil(float64(total) / float64(p.PerPage)))
+	if lastPage < 1 {
+		lastPage = 1
+	}
+
+	return &Pagination{
+		Total:    total,
+		Page:     p.Page,
+		PerPage:  p.PerPage,
+		LastPage: lastPage,
+	}, nil
+}
+
+// CursorPaginate loads the filtered page addressed by the request cursor into dest
+func (p *Params) CursorPaginate(db *gorm.DB, dest interface{}) (*CursorPage, error) {
+	return p.Keyset.Paginate(db.Scopes(p.FilterScope, p.Fields.SelectScope, p.Fields.PreloadScope(p.Includes)), dest)
+}
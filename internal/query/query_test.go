@@ -0,0 +1,241 @@
+package query
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// article is a model whitelisting some of its fields
+type article struct {
+	ID     uint
+	Title  string
+	Status string
+	Views  int
+	Secret string
+}
+
+func (article) FilterableFields() []string { return []string{"title", "status", "views"} }
+func (article) SortableFields() []string   { return []string{"id", "title", "views"} }
+
+// dryRun returns a Postgres session that builds SQL without connecting
+func dryRun(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	return db
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		filters []Filter
+		sorts   []Sort
+		page    int
+		perPage int
+		err     string
+	}{
+		{
+			name:    "defaults",
+			query:   "",
+			page:    1,
+			perPage: DefaultPerPage,
+		},
+		{
+			name:    "filter defaults to eq",
+			query:   "filter[status]=draft",
+			filters: []Filter{{Field: "status", Operator: "eq", Value: "draft"}},
+			page:    1,
+			perPage: DefaultPerPage,
+		},
+		{
+			name:  "filters in key order",
+			query: "filter[views][gte]=10&filter[title][like]=go",
+			filters: []Filter{
+				{Field: "title", Operator: "like", Value: "go"},
+				{Field: "views", Operator: "gte", Value: "10"},
+			},
+			page:    1,
+			perPage: DefaultPerPage,
+		},
+		{
+			name:  "filter not whitelisted",
+			query: "filter[secret]=x",
+			err:   "Filtering by 'secret' is not allowed",
+		},
+		{
+			name:  "unknown operator",
+			query: "filter[views][regex]=1",
+			err:   "Unknown filter operator 'regex'",
+		},
+		{
+			name:  "malformed filter",
+			query: "filter[views]x=1",
+			err:   "Malformed filter parameter 'filter[views]x'",
+		},
+		{
+			name:  "too many filter parts",
+			query: "filter[views][gte][x]=1",
+			err:   "Malformed filter parameter 'filter[views][gte][x]'",
+		},
+		{
+			name:    "sort",
+			query:   "sort=-views,title",
+			sorts:   []Sort{{Field: "views", Desc: true}, {Field: "title"}},
+			page:    1,
+			perPage: DefaultPerPage,
+		},
+		{
+			name:  "sort not whitelisted",
+			query: "sort=status",
+			err:   "Sorting by 'status' is not allowed",
+		},
+		{
+			name:    "page and per_page",
+			query:   "page=3&per_page=25",
+			page:    3,
+			perPage: 25,
+		},
+		{
+			name:    "per_page capped",
+			query:   "per_page=1000",
+			page:    1,
+			perPage: MaxPerPage,
+		},
+		{
+			name:  "page zero",
+			query: "page=0",
+			err:   "Invalid page parameter",
+		},
+		{
+			name:  "page not a number",
+			query: "page=two",
+			err:   "Invalid page parameter",
+		},
+		{
+			name:  "page beyond the cap",
+			query: "page=9223372036854775807",
+			err:   "Page cannot exceed 1000000, use cursor pagination",
+		},
+		{
+			name:  "per_page zero",
+			query: "per_page=0",
+			err:   "Invalid per_page parameter",
+		},
+		{
+			name:  "search not supported",
+			query: "q=go",
+			err:   "Search is not supported for this resource",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			params, err := Parse(values, article{})
+			if tt.err != "" {
+				if _, ok := err.(*Error); !ok || err.Error() != tt.err {
+					t.Fatalf("error = %v, want query error %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(params.Filters, tt.filters) {
+				t.Errorf("filters = %+v, want %+v", params.Filters, tt.filters)
+			}
+			if !reflect.DeepEqual(params.Sorts, tt.sorts) {
+				t.Errorf("sorts = %+v, want %+v", params.Sorts, tt.sorts)
+			}
+			if params.Page != tt.page || params.PerPage != tt.perPage {
+				t.Errorf("page = %d/%d, want %d/%d", params.Page, params.PerPage, tt.page, tt.perPage)
+			}
+		})
+	}
+}
+
+func TestFilterScope(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		sql   string
+		vars  []interface{}
+	}{
+		{
+			name:  "eq",
+			query: "filter[status]=draft",
+			sql:   `WHERE "status" = $1`,
+			vars:  []interface{}{"draft"},
+		},
+		{
+			name:  "like escapes wildcards",
+			query: "filter[title][like]=" + url.QueryEscape(`50%_off\`),
+			sql:   `WHERE "title" LIKE $1 ESCAPE '\'`,
+			vars:  []interface{}{`%50\%\_off\\%`},
+		},
+		{
+			name:  "in",
+			query: "filter[status][in]=draft,+published",
+			sql:   `WHERE "status" IN ($1,$2)`,
+			vars:  []interface{}{"draft", "published"},
+		},
+		{
+			name:  "null",
+			query: "filter[title][null]=true",
+			sql:   `WHERE "title" IS NULL`,
+		},
+		{
+			name:  "not null",
+			query: "filter[title][null]=false",
+			sql:   `WHERE "title" IS NOT NULL`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, _ := url.ParseQuery(tt.query)
+			params, err := Parse(values, article{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			stmt := dryRun(t).Model(&article{}).Scopes(params.FilterScope).Find(&[]article{}).Statement
+			if sql := stmt.SQL.String(); !strings.Contains(sql, tt.sql) {
+				t.Errorf("sql = %s, want %s", sql, tt.sql)
+			}
+			if len(stmt.Vars) != len(tt.vars) || len(tt.vars) > 0 && !reflect.DeepEqual(stmt.Vars, tt.vars) {
+				t.Errorf("vars = %v, want %v", stmt.Vars, tt.vars)
+			}
+		})
+	}
+}
+
+func TestSortAndPageScope(t *testing.T) {
+	values, _ := url.ParseQuery("sort=-views&page=3&per_page=20")
+	params, err := Parse(values, article{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stmt := dryRun(t).Model(&article{}).Scopes(params.SortScope, params.PageScope).Find(&[]article{}).Statement
+	want := `ORDER BY "views" DESC,"id" LIMIT $1 OFFSET $2`
+	if sql := stmt.SQL.String(); !strings.HasSuffix(sql, want) {
+		t.Errorf("sql = %s, want suffix %s", sql, want)
+	}
+	if !reflect.DeepEqual(stmt.Vars, []interface{}{20, 40}) {
+		t.Errorf("vars = %v, want [20 40]", stmt.Vars)
+	}
+}
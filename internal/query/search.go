@@ -0,0 +1,167 @@
+package query
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// SearchColumn is the generated tsvector column added by CreateSearchIndex
+	SearchColumn = "search_vector"
+	// SearchConfig is the Postgres text search configuration used for vectors and queries
+	SearchConfig = "simple"
+)
+
+// searchColumns caches whether a table has the generated search column
+var searchColumns sync.Map
+
+// Searchable is implemented by models that support ?q= full-text search
+type Searchable interface {
+	TableName() string
+	SearchableFields() []string
+}
+
+// SearchHit wraps a search result with its rank and highlighted snippets
+type SearchHit struct {
+	Item       interface{}       `json:"item"`
+	Rank       float64           `json:"rank"`
+	Highlights map[string]string `json:"highlights,omitempty"`
+}
+
+// search holds what is needed to build the search expressions for a model
+type search struct {
+	term   string
+	table  string
+	fields []string
+}
+
+// vectorSQL builds the tsvector expression over the searchable fields
+func vectorSQL(db *gorm.DB, fields []string) string {
+	parts := make([]string, len(fields))
+	for i, field := range fields {
+		parts[i] = fmt.Sprintf("coalesce(%s, '')", db.Statement.Quote(field))
+	}
+	return fmt.Sprintf("to_tsvector('%s', %s)", SearchConfig, strings.Join(parts, " || ' ' || "))
+}
+
+// vector returns the generated column when it exists, and the inline expression otherwise
+func (s *search) vector(db *gorm.DB) string {
+	hasColumn, ok := searchColumns.Load(s.table)
+	if !ok {
+		hasColumn = db.Session(&gorm.Session{NewDB: true}).Migrator().HasColumn(s.table, SearchColumn)
+		searchColumns.Store(s.table, hasColumn)
+	}
+
+	if hasColumn.(bool) {
+		return db.Statement.Quote(SearchColumn)
+	}
+	return vectorSQL(db, s.fields)
+}
+
+// tsquery returns the tsquery expression for the search term
+func (s *search) tsquery() string {
+	return fmt.Sprintf("websearch_to_tsquery('%s', ?)", SearchConfig)
+}
+
+// where returns the full-text match condition
+func (s *search) where(db *gorm.DB) clause.Expr {
+	return clause.Expr{SQL: fmt.Sprintf("%s @@ %s", s.vector(db), s.tsquery()), Vars: []interface{}{s.term}}
+}
+
+// rank returns the ranking expression used for ordering
+func (s *search) rank(db *gorm.DB) clause.Expr {
+	return clause.Expr{SQL: fmt.Sprintf("ts_rank(%s, %s)", s.vector(db), s.tsquery()), Vars: []interface{}{s.term}}
+}
+
+// SearchHits ranks and highlights the rows in items, which must be a slice of models
+// loaded with the same Params. Snippets mark matches with <b></b>.
+func (p *Params) SearchHits(db *gorm.DB, items interface{}) ([]SearchHit, error) {
+	rows := reflect.ValueOf(items)
+	if p.search == nil || rows.Len() == 0 {
+		return []SearchHit{}, nil
+	}
+
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(items); err != nil {
+		return nil, err
+	}
+	idField := stmt.Schema.LookUpField("id")
+	if idField == nil {
+		return nil, fmt.Errorf("cannot search %s without an id", stmt.Schema.Table)
+	}
+
+	ids := make([]interface{}, rows.Len())
+	for i := range ids {
+		ids[i], _ = idField.ValueOf(db.Statement.Context, reflect.Indirect(rows.Index(i)))
+	}
+
+	tx := db.Session(&gorm.Session{NewDB: true})
+	selects := []string{tx.Statement.Quote("id"), "ts_rank(@vector, @query) AS search_rank"}
+	for _, field := range p.search.fields {
+		selects = append(selects, fmt.Sprintf("ts_headline('%s', coalesce(%s, ''), @query, 'StartSel=<b>, StopSel=</b>') AS %s",
+			SearchConfig, tx.Statement.Quote(field), tx.Statement.Quote("highlight_"+field)))
+	}
+
+	var results []map[string]interface{}
+	err := tx.Table(p.search.table).
+		Select(strings.Join(selects, ", "), map[string]interface{}{
+			"vector": gorm.Expr(p.search.vector(tx)),
+			"query":  gorm.Expr(p.search.tsquery(), p.search.term),
+		}).
+		Where(clause.IN{Column: clause.Column{Name: "id"}, Values: ids}).
+		Find(&results).Error
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]map[string]interface{}, len(results))
+	for _, result := range results {
+		byID[fmt.Sprint(result["id"])] = result
+	}
+
+	hits := make([]SearchHit, rows.Len())
+	for i := range hits {
+		hit := SearchHit{Item: rows.Index(i).Interface(), Highlights: map[string]string{}}
+		if result, ok := byID[fmt.Sprint(ids[i])]; ok {
+			if rank, ok := result["search_rank"].(float32); ok {
+				hit.Rank = float64(rank)
+			} else if rank, ok := result["search_rank"].(float64); ok {
+				hit.Rank = rank
+			}
+			for _, field := range p.search.fields {
+				if snippet, ok := result["highlight_"+field].(string); ok && strings.Contains(snippet, "<b>") {
+					hit.Highlights[field] = snippet
+				}
+			}
+		}
+		hits[i] = hit
+	}
+
+	return hits, nil
+}
+
+// CreateSearchIndex adds a generated tsvector column over the model's searchable
+// fields together with a GIN index. It is safe to run on every migration.
+func CreateSearchIndex(db *gorm.DB, model Searchable) error {
+	table := model.TableName()
+
+	err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s tsvector GENERATED ALWAYS AS (%s) STORED",
+		db.Statement.Quote(table), db.Statement.Quote(SearchColumn), vectorSQL(db, model.SearchableFields()))).Error
+	if err != nil {
+		return fmt.Errorf("failed to add search column to %s: %v", table, err)
+	}
+
+	err = db.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s USING GIN (%s)",
+		db.Statement.Quote("idx_"+table+"_"+SearchColumn), db.Statement.Quote(table), db.Statement.Quote(SearchColumn))).Error
+	if err != nil {
+		return fmt.Errorf("failed to create search index on %s: %v", table, err)
+	}
+
+	searchColumns.Delete(table)
+	return nil
+}
@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// State is the counter of a client, as saved by a store. Each algorithm uses
+// its own fields; a zero State is a client without previous requests.
+type State struct {
+	// Tokens is the content of the bucket, refilled up to Refilled
+	Tokens   float64
+	Refilled time.Time
+	// Count is the number of requests in the window starting at Window, and
+	// Previous the number in the window before it
+	Count    int
+	Previous int
+	Window   time.Time
+}
+
+// Result is the outcome of a request against a limit
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// Reset is the time until the limit is fully available again
+	Reset time.Duration
+	// RetryAfter is the time until a denied request would be allowed
+	RetryAfter time.Duration
+}
+
+// Algorithm counts a request in the state of its client
+type Algorithm interface {
+	Take(state *State, limit Limit, now time.Time) Result
+}
+
+var (
+	// TokenBucket allows bursts of up to Requests, refilled evenly over Period
+	TokenBucket Algorithm = tokenBucket{}
+	// SlidingWindow allows Requests in any Period, estimated from the counts
+	// of the current and previous fixed windows
+	SlidingWindow Algorithm = slidingWindow{}
+)
+
+// ParseAlgorithm returns the algorithm with the given name: token_bucket or sliding_window
+func ParseAlgorithm(name string) (Algorithm, error) {
+	switch name {
+	case "", "token_bucket":
+		return TokenBucket, nil
+	case "sliding_window":
+		return SlidingWindow, nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit algorithm %q, use token_bucket or sliding_window", name)
+	}
+}
+
+type tokenBucket struct{}
+
+func (tokenBucket) Take(state *State, limit Limit, now time.Time) Result {
+	capacity := float64(limit.Requests)
+	rate := capacity / limit.Period.Seconds()
+
+	if state.Refilled.IsZero() {
+		state.Tokens = capacity
+	} else if elapsed := now.Sub(state.Refilled).Seconds(); elapsed > 0 {
+		state.Tokens = math.Min(capacity, state.Tokens+elapsed*rate)
+	}
+	state.Refilled = now
+
+	result := Result{Allowed: state.Tokens >= 1}
+	if result.Allowed {
+		state.Tokens--
+	} else {
+		result.RetryAfter = seconds64((1 - state.Tokens) / rate)
+	}
+	result.Remaining = int(state.Tokens)
+	result.Reset = seconds64((capacity - state.Tokens) / rate)
+	return result
+}
+
+type slidingWindow struct{}
+
+func (slidingWindow) Take(state *State, limit Limit, now time.Time) Result {
+	start := now.Truncate(limit.Period)
+	if !state.Window.Equal(start) {
+		if state.Window.Equal(start.Add(-limit.Period)) {
+			state.Previous = state.Count
+		} else {
+			state.Previous = 0
+		}
+		state.Count = 0
+		state.Window = start
+	}
+
+	elapsed := now.Sub(start)
+	weight := 1 - float64(elapsed)/float64(limit.Period)
+	estimate := float64(state.Previous)*weight + float64(state.Count)
+
+	result := Result{Allowed: estimate+1 <= float64(limit.Requests)}
+	if result.Allowed {
+		state.Count++
+		estimate++
+	} else if state.Count+1 > limit.Requests || state.Previous == 0 {
+		// Only the next window has room
+		result.RetryAfter = limit.Period - elapsed
+	} else {
+		// Wait until the previous window weighs little enough:
+		// Previous * (1 - t/Period) + Count + 1 <= Requests
+		t := (1 - float64(limit.Requests-state.Count-1)/float64(state.Previous)) * float64(limit.Period)
+		result.RetryAfter = time.Duration(t) - elapsed
+	}
+	// The requests of the current window weigh until the end of the next one
+	switch {
+	case state.Count > 0:
+		result.Reset = 2*limit.Period - elapsed
+	case state.Previous > 0:
+		result.Reset = limit.Period - elapsed
+	}
+	result.Remaining = max(0, limit.Requests-int(math.Ceil(estimate)))
+	return result
+}
+
+// seconds64 converts seconds to a duration
+func seconds64(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
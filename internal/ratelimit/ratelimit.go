@@ -0,0 +1,174 @@
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"went-framework/internal/handlers"
+
+	wentlog "went-framework/internal/logger"
+)
+
+// Limit allows Requests per Period to each client
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// ParseLimit parses a limit written as requests/period, e.g. "100/1m" or "10/s"
+func ParseLimit(value string) (Limit, error) {
+	requests, period, ok := strings.Cut(strings.TrimSpace(value), "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, use requests/period such as 100/1m", value)
+	}
+
+	n, err := strconv.Atoi(requests)
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("invalid request count in rate limit %q", value)
+	}
+
+	// A bare unit means one of it: 10/s is 10/1s
+	if period != "" && (period[0] < '0' || period[0] > '9') {
+		period = "1" + period
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("invalid period in rate limit %q", value)
+	}
+
+	return Limit{Requests: n, Period: d}, nil
+}
+
+// String formats the limit as requests/period
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Requests, l.Period)
+}
+
+// KeyFunc returns the client a request is counted for
+type KeyFunc func(r *http.Request) string
+
+// ByIP counts requests per remote address. Use ByForwardedIP behind a proxy.
+func ByIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return "ip:" + host
+	}
+	return "ip:" + r.RemoteAddr
+}
+
+// ByForwardedIP counts requests per client address as reported by a reverse proxy
+// in X-Forwarded-For or X-Real-IP. Only use it behind a proxy that sets these
+// headers, since clients can send them to pose as other clients.
+func ByForwardedIP(r *http.Request) string {
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		return "ip:" + strings.TrimSpace(strings.Split(xff, ",")[0])
+	}
+	if xri := r.Header.Get("X-Real-IP"); xri != "" {
+		return "ip:" + xri
+	}
+	return ByIP(r)
+}
+
+// ByAPIKey counts requests per API key sent in the given header, and per IP
+// for requests without one. Keys are hashed, so stores never hold API keys.
+func ByAPIKey(header string) KeyFunc {
+	return func(r *http.Request) string {
+		if key := r.Header.Get(header); key != "" {
+			sum := sha256.Sum256([]byte(key))
+			return "key:" + hex.EncodeToString(sum[:])
+		}
+		return ByIP(r)
+	}
+}
+
+// ByUser counts requests per authenticated user as returned by user, and per IP
+// for anonymous requests
+func ByUser(user func(r *http.Request) string) KeyFunc {
+	return func(r *http.Request) string {
+		if id := user(r); id != "" {
+			return "user:" + id
+		}
+		return ByIP(r)
+	}
+}
+
+// Config configures a rate limit middleware
+type Config struct {
+	// Name scopes the counters, so route groups sharing a store have their own limits
+	Name      string
+	Limit     Limit
+	Algorithm Algorithm
+	Store     Store
+	// Key returns the client of a request, ByIP when nil
+	Key KeyFunc
+}
+
+// Middleware limits the requests of each client. Every response carries the
+// X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset (seconds)
+// headers, and requests over the limit get 429 Too Many Requests with
+// Retry-After. When the store fails, requests are let through.
+func Middleware(config Config) func(http.Handler) http.Handler {
+	if config.Algorithm == nil {
+		config.Algorithm = TokenBucket
+	}
+	if config.Key == nil {
+		config.Key = ByIP
+	}
+	if config.Store == nil {
+		config.Store = NewMemoryStore()
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			now := time.Now()
+			key := config.Name + ":" + config.Key(r)
+
+			var result Result
+			err := config.Store.Update(r.Context(), key, 2*config.Limit.Period, func(state *State) {
+				result = config.Algorithm.Take(state, config.Limit, now)
+			})
+			if err != nil {
+				wentlog.ErrorContext(r.Context(), "Failed to check the rate limit", map[string]interface{}{
+					"cause":  err.Error(),
+					"limit":  config.Name,
+					"method": r.Method,
+					"path":   r.URL.Path,
+				})
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(config.Limit.Requests))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("X-RateLimit-Reset", strconv.Itoa(seconds(result.Reset)))
+
+			if !result.Allowed {
+				retryAfter := seconds(result.RetryAfter)
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				handlers.RespondError(w, r, handlers.NewError(http.StatusTooManyRequests, handlers.CodeTooManyRequests,
+					fmt.Sprintf("Too many requests, retry in %d seconds", retryAfter)))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// seconds rounds a duration up to whole seconds
+func seconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Seconds()))
+}
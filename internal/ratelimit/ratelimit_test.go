@@ -0,0 +1,181 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// step is a request at offset from the start of a test, and its expected result
+type step struct {
+	offset     time.Duration
+	allowed    bool
+	remaining  int
+	retryAfter time.Duration
+}
+
+// run takes each step against one state and checks its result
+func run(t *testing.T, algorithm Algorithm, limit Limit, start time.Time, steps []step) {
+	t.Helper()
+	var state State
+	for i, s := range steps {
+		result := algorithm.Take(&state, limit, start.Add(s.offset))
+		if result.Allowed != s.allowed || result.Remaining != s.remaining {
+			t.Errorf("step %d at %s: allowed %v remaining %d, want %v %d",
+				i, s.offset, result.Allowed, result.Remaining, s.allowed, s.remaining)
+		}
+		if diff := result.RetryAfter - s.retryAfter; diff < -time.Millisecond || diff > time.Millisecond {
+			t.Errorf("step %d at %s: retry after %s, want %s", i, s.offset, result.RetryAfter, s.retryAfter)
+		}
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Limit
+		err   bool
+	}{
+		{value: "100/1m", want: Limit{Requests: 100, Period: time.Minute}},
+		{value: "10/s", want: Limit{Requests: 10, Period: time.Second}},
+		{value: " 5/2h ", want: Limit{Requests: 5, Period: 2 * time.Hour}},
+		{value: "100", err: true},
+		{value: "0/1m", err: true},
+		{value: "x/1m", err: true},
+		{value: "10/", err: true},
+		{value: "10/-1m", err: true},
+		{value: "10/fortnight", err: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.value)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("ParseLimit(%q) = %v, %v, want %v, error %v", tt.value, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	run(t, TokenBucket, Limit{Requests: 3, Period: 3 * time.Second}, start, []step{
+		// A full bucket allows a burst
+		{offset: 0, allowed: true, remaining: 2},
+		{offset: 0, allowed: true, remaining: 1},
+		{offset: 0, allowed: true, remaining: 0},
+		{offset: 0, allowed: false, remaining: 0, retryAfter: time.Second},
+		// One token is refilled each second
+		{offset: 500 * time.Millisecond, allowed: false, remaining: 0, retryAfter: 500 * time.Millisecond},
+		{offset: time.Second, allowed: true, remaining: 0},
+		// The bucket never holds more than its capacity
+		{offset: time.Hour, allowed: true, remaining: 2},
+	})
+}
+
+func TestSlidingWindow(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	run(t, SlidingWindow, Limit{Requests: 4, Period: time.Minute}, start, []step{
+		{offset: 0, allowed: true, remaining: 3},
+		{offset: 10 * time.Second, allowed: true, remaining: 2},
+		{offset: 20 * time.Second, allowed: true, remaining: 1},
+		{offset: 30 * time.Second, allowed: true, remaining: 0},
+		// The window is full, only the next one has room
+		{offset: 40 * time.Second, allowed: false, remaining: 0, retryAfter: 20 * time.Second},
+		// Halfway through the next window the previous one weighs 2 requests
+		{offset: 90 * time.Second, allowed: true, remaining: 1},
+		{offset: 90 * time.Second, allowed: true, remaining: 0},
+		// 4*(1-t/60s) + 2 + 1 <= 4 once t reaches 45s
+		{offset: 90 * time.Second, allowed: false, remaining: 0, retryAfter: 15 * time.Second},
+		{offset: 105 * time.Second, allowed: true, remaining: 0},
+		// A window without requests clears the previous one
+		{offset: 5 * time.Minute, allowed: true, remaining: 3},
+	})
+}
+
+func TestParseAlgorithm(t *testing.T) {
+	tests := []struct {
+		name string
+		want Algorithm
+		err  bool
+	}{
+		{name: "", want: TokenBucket},
+		{name: "token_bucket", want: TokenBucket},
+		{name: "sliding_window", want: SlidingWindow},
+		{name: "leaky_bucket", err: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseAlgorithm(tt.name)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("ParseAlgorithm(%q) = %v, %v", tt.name, got, err)
+		}
+	}
+}
+
+func TestKeyFuncs(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	forwarded := r.Clone(r.Context())
+	forwarded.Header.Set("X-Forwarded-For", "203.0.113.9, 10.0.0.1")
+	withKey := r.Clone(r.Context())
+	withKey.Header.Set("X-API-Key", "secret")
+
+	tests := []struct {
+		name string
+		key  KeyFunc
+		r    *http.Request
+		want string
+	}{
+		{"ip", ByIP, r, "ip:192.0.2.1"},
+		{"ip ignores forwarded headers", ByIP, forwarded, "ip:192.0.2.1"},
+		{"forwarded ip", ByForwardedIP, forwarded, "ip:203.0.113.9"},
+		{"forwarded ip without header", ByForwardedIP, r, "ip:192.0.2.1"},
+		{"api key hashed", ByAPIKey("X-API-Key"), withKey, "key:2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b"},
+		{"api key missing", ByAPIKey("X-API-Key"), r, "ip:192.0.2.1"},
+		{"user", ByUser(func(*http.Request) string { return "42" }), r, "user:42"},
+		{"anonymous user", ByUser(func(*http.Request) string { return "" }), r, "ip:192.0.2.1"},
+	}
+	for _, tt := range tests {
+		if got := tt.key(tt.r); got != tt.want {
+			t.Errorf("%s: key = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	handler := Middleware(Config{
+		Name:  "test",
+		Limit: Limit{Requests: 2, Period: time.Minute},
+		Store: NewMemoryStore(),
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		method     string
+		remoteAddr string
+		status     int
+		remaining  string
+	}{
+		{http.MethodGet, "192.0.2.1:1", http.StatusNoContent, "1"},
+		{http.MethodGet, "192.0.2.1:2", http.StatusNoContent, "0"},
+		{http.MethodGet, "192.0.2.1:3", http.StatusTooManyRequests, "0"},
+		// Preflights are not counted
+		{http.MethodOptions, "192.0.2.1:4", http.StatusNoContent, ""},
+		// Each client has its own limit
+		{http.MethodGet, "192.0.2.2:1", http.StatusNoContent, "1"},
+	}
+	for i, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != tt.status || w.Header().Get("X-RateLimit-Remaining") != tt.remaining {
+			t.Errorf("request %d: status %d remaining %q, want %d %q",
+				i, w.Code, w.Header().Get("X-RateLimit-Remaining"), tt.status, tt.remaining)
+		}
+		if tt.status == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "30" {
+			t.Errorf("request %d: Retry-After = %q, want 30", i, w.Header().Get("Retry-After"))
+		}
+	}
+}
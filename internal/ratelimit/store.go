@@ -0,0 +1,163 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+	"went-framework/app/database"
+	wentlog "went-framework/internal/logger"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Store keeps the state of each client
+type Store interface {
+	// Update calls fn with the state of key and saves the changes, atomically
+	// with respect to other updates of key. The state may be dropped after ttl
+	// without updates.
+	Update(ctx context.Context, key string, ttl time.Duration, fn func(state *State)) error
+}
+
+// sweepInterval is the minimum time between two removals of expired states
+const sweepInterval = time.Minute
+
+// MemoryStore keeps states in memory, so each replica counts on its own
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryEntry
+	lastSweep time.Time
+}
+
+type memoryEntry struct {
+	state   State
+	expires time.Time
+}
+
+// NewMemoryStore returns an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*memoryEntry), lastSweep: time.Now()}
+}
+
+// Update implements Store
+func (s *MemoryStore) Update(ctx context.Context, key string, ttl time.Duration, fn func(state *State)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > sweepInterval {
+		for k, entry := range s.entries {
+			if now.After(entry.expires) {
+				delete(s.entries, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	entry, ok := s.entries[key]
+	if !ok || now.After(entry.expires) {
+		entry = &memoryEntry{}
+		s.entries[key] = entry
+	}
+	fn(&entry.state)
+	entry.expires = now.Add(ttl)
+	return nil
+}
+
+// Entry is the state of a client saved by PostgresStore
+type Entry struct {
+	Key       string    `gorm:"column:limit_key;primaryKey;size:255"`
+	State     State     `gorm:"embedded"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+}
+
+// TableName returns the table of rate limit states
+func (Entry) TableName() string {
+	return "rate_limits"
+}
+
+// PostgresStore keeps states in the rate_limits table, so every replica shares
+// the same counters. Each update locks the row of its client. While the
+// database fails, states are kept in memory so clients are still limited.
+type PostgresStore struct {
+	db          *gorm.DB
+	fallback    *MemoryStore
+	mu          sync.Mutex
+	lastSweep   time.Time
+	lastWarning time.Time
+}
+
+// NewPostgresStore returns a store saving states with db, or with the
+// connection of the application when db is nil
+func NewPostgresStore(db *gorm.DB) *PostgresStore {
+	return &PostgresStore{db: db, fallback: NewMemoryStore(), lastSweep: time.Now()}
+}
+
+// conn returns the database connection of the store, connecting on first use
+func (s *PostgresStore) conn() (*gorm.DB, error) {
+	if s.db != nil {
+		return s.db, nil
+	}
+	return database.Get()
+}
+
+// Update implements Store
+func (s *PostgresStore) Update(ctx context.Context, key string, ttl time.Duration, fn func(state *State)) error {
+	db, err := s.conn()
+	if err == nil {
+		err = s.update(ctx, db, key, ttl, fn)
+	}
+	if err != nil && ctx.Err() == nil {
+		s.warn(ctx, err)
+		return s.fallback.Update(ctx, key, ttl, fn)
+	}
+	return err
+}
+
+// warn logs that the in-memory fallback is used, at most once per sweepInterval
+func (s *PostgresStore) warn(ctx context.Context, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now := time.Now(); now.Sub(s.lastWarning) >= sweepInterval {
+		s.lastWarning = now
+		wentlog.WarnContext(ctx, "Rate limits are counted in memory while the database fails", map[string]interface{}{
+			"cause": err.Error(),
+		})
+	}
+}
+
+// update updates the state of key in the rate_limits table
+func (s *PostgresStore) update(ctx context.Context, db *gorm.DB, key string, ttl time.Duration, fn func(state *State)) error {
+	now := time.Now()
+	s.sweep(db, now)
+
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		entry := Entry{Key: key}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&entry).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("limit_key = ?", key).First(&entry).Error; err != nil {
+			return err
+		}
+
+		// New and expired entries start over
+		if now.After(entry.ExpiresAt) {
+			entry.State = State{}
+		}
+		fn(&entry.State)
+		entry.ExpiresAt = now.Add(ttl)
+		return tx.Save(&entry).Error
+	})
+}
+
+// sweep deletes expired states in the background, at most once per sweepInterval
+func (s *PostgresStore) sweep(db *gorm.DB, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	go db.Where("expires_at < ?", now).Delete(&Entry{})
+}
@@ -0,0 +1,551 @@
+package render
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// The non-JSON formats are produced from the JSON encoding of a value, so field
+// names, omitempty and custom marshalers behave the same in every format.
+
+// object is a JSON object that keeps the order of its keys
+type object struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// toTree encodes v as JSON and decodes it into objects, slices and scalars
+func toTree(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return readTree(dec)
+}
+
+// readTree reads the next JSON value from dec
+func readTree(dec *json.Decoder) (interface{}, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		obj := &object{values: make(map[string]interface{})}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := readTree(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj.keys = append(obj.keys, key.(string))
+			obj.values[key.(string)] = value
+		}
+		_, err := dec.Token()
+		return obj, err
+
+	case json.Delim('['):
+		items := []interface{}{}
+		for dec.More() {
+			item, err := readTree(dec)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		_, err := dec.Token()
+		return items, err
+
+	default:
+		return token, nil
+	}
+}
+
+// plain converts a tree to maps, slices and native numbers
+func plain(node interface{}) interface{} {
+	switch value := node.(type) {
+	case *object:
+		m := make(map[string]interface{}, len(value.keys))
+		for _, key := range value.keys {
+			m[key] = plain(value.values[key])
+		}
+		return m
+	case []interface{}:
+		items := make([]interface{}, len(value))
+		for i, item := range value {
+			items[i] = plain(item)
+		}
+		return items
+	case json.Number:
+		if n, err := value.Int64(); err == nil {
+			return n
+		}
+		n, _ := value.Float64()
+		return n
+	default:
+		return value
+	}
+}
+
+// fromPlain decodes a plain value into v through JSON, converting strings to the
+// numbers and booleans v expects since text formats carry no types
+func fromPlain(value interface{}, v interface{}) error {
+	value = coerce(value, reflect.TypeOf(v))
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// coerce converts the strings of a decoded text value to the kinds of t
+func coerce(value interface{}, t reflect.Type) interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := value.(map[string]interface{})
+		if !ok || t == reflect.TypeOf(time.Time{}) {
+			return value
+		}
+		fields := jsonFields(t)
+		for key, item := range m {
+			if fieldType, ok := fields[key]; ok {
+				m[key] = coerce(item, fieldType)
+			}
+		}
+		return m
+
+	case reflect.Map:
+		if m, ok := value.(map[string]interface{}); ok {
+			for key, item := range m {
+				m[key] = coerce(item, t.Elem())
+			}
+		}
+		return value
+
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return value
+		}
+		items, ok := value.([]interface{})
+		if !ok {
+			if value == nil || value == "" {
+				return []interface{}{}
+			}
+			// A single XML child element is a one item list
+			items = []interface{}{value}
+		}
+		for i, item := range items {
+			items[i] = coerce(item, t.Elem())
+		}
+		return items
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return value
+	}
+	s = strings.TrimSpace(s)
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if s == "" {
+			return nil
+		}
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if s == "" {
+			return nil
+		}
+		if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+			return n
+		}
+	case reflect.Float32, reflect.Float64:
+		if s == "" {
+			return nil
+		}
+		if n, err := strconv.ParseFloat(s, 64); err == nil {
+			return n
+		}
+	case reflect.Bool:
+		if s == "" {
+			return nil
+		}
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	}
+	return value
+}
+
+// jsonFields maps the JSON names of the fields of t, including embedded ones, to their types
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	eachJSONField(t, func(name string, fieldType reflect.Type) {
+		fields[name] = fieldType
+	})
+	return fields
+}
+
+// eachJSONField calls fn with the JSON name and type of the fields of t in
+// declaration order, including the fields of embedded structs
+func eachJSONField(t reflect.Type, fn func(name string, fieldType reflect.Type)) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		jsonTag := field.Tag.Get("json")
+
+		if field.Anonymous && jsonTag == "" && field.Type.Kind() == reflect.Struct {
+			eachJSONField(field.Type, fn)
+			continue
+		}
+
+		name := strings.Split(jsonTag, ",")[0]
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fn(name, field.Type)
+	}
+}
+
+// FieldNames returns the JSON names of the fields of v, a struct, in declaration order
+func FieldNames(v interface{}) []string {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var names []string
+	eachJSONField(t, func(name string, _ reflect.Type) {
+		names = append(names, name)
+	})
+	return names
+}
+
+// Row flattens v, an object, into cells keyed by field name like CSV responses
+// do: nested objects and lists are written as JSON. columns lists the fields in order.
+func Row(v interface{}) (columns []string, cells map[string]string, err error) {
+	tree, err := toTree(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	obj, ok := tree.(*object)
+	if !ok {
+		return nil, nil, ErrNotTabular
+	}
+
+	cells = make(map[string]string, len(obj.keys))
+	for _, key := range obj.keys {
+		cells[key] = cellString(obj.values[key])
+	}
+	return obj.keys, cells, nil
+}
+
+// encodeXML writes v as XML with a <response> root. Objects become elements
+// named by their keys and list items become <item> elements.
+func encodeXML(w io.Writer, v interface{}) error {
+	tree, err := toTree(v)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	if err := writeXML(enc, "response", tree); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+// writeXML writes one node of a tree as an element
+func writeXML(enc *xml.Encoder, name string, node interface{}) error {
+	start := xml.StartElement{Name: xml.Name{Local: xmlName(name)}}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch value := node.(type) {
+	case *object:
+		for _, key := range value.keys {
+			if err := writeXML(enc, key, value.values[key]); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range value {
+			if err := writeXML(enc, "item", item); err != nil {
+				return err
+			}
+		}
+	case nil:
+	default:
+		if err := enc.EncodeToken(xml.CharData(scalarString(value))); err != nil {
+			return err
+		}
+	}
+
+	return enc.EncodeToken(start.End())
+}
+
+// xmlName turns a JSON key into a valid XML element name
+func xmlName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '.' {
+			return r
+		}
+		return '_'
+	}, key)
+	if name == "" || !(unicode.IsLetter(rune(name[0])) || name[0] == '_') {
+		name = "_" + name
+	}
+	return name
+}
+
+// decodeXML reads an XML document into v. The root element name is ignored,
+// elements whose children are all <item> elements are lists.
+func decodeXML(r io.Reader, v interface{}) error {
+	dec := xml.NewDecoder(r)
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if _, ok := token.(xml.StartElement); ok {
+			value, err := readXML(dec)
+			if err != nil {
+				return err
+			}
+			return fromPlain(value, v)
+		}
+	}
+}
+
+// readXML reads the content of the current element up to its end tag
+func readXML(dec *xml.Decoder) (interface{}, error) {
+	var text strings.Builder
+	var keys []string
+	children := make(map[string]interface{})
+	repeated := make(map[string]bool)
+
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			value, err := readXML(dec)
+			if err != nil {
+				return nil, err
+			}
+			name := t.Name.Local
+			existing, ok := children[name]
+			switch {
+			case !ok:
+				children[name] = value
+				keys = append(keys, name)
+			case repeated[name]:
+				children[name] = append(existing.([]interface{}), value)
+			default:
+				children[name] = []interface{}{existing, value}
+				repeated[name] = true
+			}
+
+		case xml.CharData:
+			text.Write(t)
+
+		case xml.EndElement:
+			if len(keys) == 0 {
+				return text.String(), nil
+			}
+			if len(keys) == 1 && keys[0] == "item" {
+				if repeated["item"] {
+					return children["item"], nil
+				}
+				return []interface{}{children["item"]}, nil
+			}
+			return children, nil
+		}
+	}
+}
+
+// tabularRows returns the rows of a list response: the items of a top-level
+// list or of the "data" list of a response envelope
+func tabularRows(tree interface{}) ([]interface{}, error) {
+	if items, ok := tree.([]interface{}); ok {
+		return items, nil
+	}
+	if obj, ok := tree.(*object); ok {
+		if items, ok := obj.values["data"].([]interface{}); ok {
+			return items, nil
+		}
+	}
+	return nil, ErrNotTabular
+}
+
+// encodeCSV writes a list as CSV with a header row of the item fields. Nested
+// objects and lists are written as JSON.
+func encodeCSV(w io.Writer, v interface{}) error {
+	tree, err := toTree(v)
+	if err != nil {
+		return err
+	}
+	rows, err := tabularRows(tree)
+	if err != nil {
+		return err
+	}
+
+	// Columns in field order, adding fields that only appear in later rows
+	var columns []string
+	seen := map[string]bool{}
+	for _, row := range rows {
+		obj, ok := row.(*object)
+		if !ok {
+			columns, seen = []string{"value"}, map[string]bool{"value": true}
+			break
+		}
+		for _, key := range obj.keys {
+			if !seen[key] {
+				seen[key] = true
+				columns = append(columns, key)
+			}
+		}
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(columns); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		record := make([]string, len(columns))
+		if obj, ok := row.(*object); ok {
+			for i, column := range columns {
+				record[i] = cellString(obj.values[column])
+			}
+		} else {
+			record[0] = cellString(row)
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// cellString formats a tree node as a CSV cell
+func cellString(node interface{}) string {
+	switch node.(type) {
+	case *object, []interface{}:
+		data, _ := json.Marshal(plain(node))
+		return string(data)
+	default:
+		return scalarString(node)
+	}
+}
+
+// scalarString formats a JSON scalar as text
+func scalarString(node interface{}) string {
+	switch value := node.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	case bool:
+		return strconv.FormatBool(value)
+	default:
+		data, _ := json.Marshal(value)
+		return string(data)
+	}
+}
+
+// decodeCSV reads CSV with a header row into v, a slice for any number of rows
+// or a struct for exactly one
+func decodeCSV(r io.Reader, v interface{}) error {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return errors.New("missing header row")
+	}
+
+	header := records[0]
+	rows := make([]interface{}, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := make(map[string]interface{}, len(header))
+		for i, column := range header {
+			if i < len(record) {
+				row[strings.TrimSpace(column)] = record[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		return fromPlain(rows, v)
+	}
+	if len(rows) != 1 {
+		return errors.New("expected exactly one row")
+	}
+	return fromPlain(rows[0], v)
+}
+
+// encodeMsgpack writes v as MessagePack
+func encodeMsgpack(w io.Writer, v interface{}) error {
+	tree, err := toTree(v)
+	if err != nil {
+		return err
+	}
+	return msgpack.NewEncoder(w).Encode(plain(tree))
+}
+
+// decodeMsgpack reads MessagePack into v
+func decodeMsgpack(r io.Reader, v interface{}) error {
+	var value interface{}
+	if err := msgpack.NewDecoder(r).Decode(&value); err != nil {
+		return err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
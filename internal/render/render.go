@@ -0,0 +1,272 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrNotAcceptable is returned when no supported format matches the Accept header
+	ErrNotAcceptable = errors.New("none of the accepted media types is supported")
+	// ErrUnsupportedMediaType is returned when the request body has an unsupported Content-Type
+	ErrUnsupportedMediaType = errors.New("unsupported request media type")
+	// ErrNotTabular is returned when CSV is requested for a response that is not a list
+	ErrNotTabular = errors.New("only lists can be represented as CSV")
+)
+
+// Format is a media type the API can respond with and accept request bodies in
+type Format struct {
+	// Name is the human-readable name used in messages, e.g. "JSON"
+	Name string
+	// MediaType is the canonical media type, sent as Content-Type
+	MediaType string
+	// Aliases are other media types selecting the format
+	Aliases []string
+	// Tabular formats can only represent lists
+	Tabular bool
+	Encode  func(w io.Writer, v interface{}) error
+	Decode  func(r io.Reader, v interface{}) error
+}
+
+// DecodeError is returned when a request body cannot be decoded
+type DecodeError struct {
+	Format string
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("Invalid %s data", e.Format)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// errorBody is the error envelope of the responses written by this package
+type errorBody struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Code    string `json:"code,omitempty"`
+}
+
+// formats lists the supported formats, the first one is the default
+var formats = []*Format{
+	{Name: "JSON", MediaType: "application/json", Encode: encodeJSON, Decode: decodeJSON},
+	{Name: "XML", MediaType: "application/xml", Aliases: []string{"text/xml"}, Encode: encodeXML, Decode: decodeXML},
+	{Name: "CSV", MediaType: "text/csv", Tabular: true, Encode: encodeCSV, Decode: decodeCSV},
+	{Name: "MessagePack", MediaType: "application/msgpack", Aliases: []string{"application/x-msgpack", "application/vnd.msgpack"},
+		Encode: encodeMsgpack, Decode: decodeMsgpack},
+}
+
+// Formats returns the supported formats, JSON first
+func Formats() []*Format {
+	return formats
+}
+
+// JSON returns the default JSON format
+func JSON() *Format {
+	return formats[0]
+}
+
+// matches reports whether the format is selected by the media type (without parameters)
+func (f *Format) matches(mediaType string) bool {
+	if mediaType == f.MediaType {
+		return true
+	}
+	for _, alias := range f.Aliases {
+		if mediaType == alias {
+			return true
+		}
+	}
+	// Structured syntax suffixes such as application/problem+json select the base format
+	if i := strings.LastIndex(mediaType, "+"); i != -1 {
+		return strings.HasSuffix(f.MediaType, "/"+mediaType[i+1:])
+	}
+	return false
+}
+
+// acceptEntry is one media range of an Accept header
+type acceptEntry struct {
+	mediaType string
+	q         float64
+}
+
+// parseAccept parses an Accept header into media ranges ordered by preference
+func parseAccept(header string) []acceptEntry {
+	var entries []acceptEntry
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q > 0 {
+			entries = append(entries, acceptEntry{mediaType: mediaType, q: q})
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].q > entries[j].q
+	})
+	return entries
+}
+
+// acceptable returns the supported formats acceptable per the Accept header,
+// most preferred first. Without an Accept header, JSON is used.
+func acceptable(r *http.Request) []*Format {
+	header := r.Header.Get("Accept")
+	if strings.TrimSpace(header) == "" {
+		return []*Format{JSON()}
+	}
+
+	var result []*Format
+	added := map[*Format]bool{}
+	for _, entry := range parseAccept(header) {
+		for _, format := range formats {
+			var ok bool
+			switch prefix, wildcard := strings.CutSuffix(entry.mediaType, "/*"); {
+			case entry.mediaType == "*/*":
+				ok = true
+			case wildcard:
+				ok = strings.HasPrefix(format.MediaType, prefix+"/")
+			default:
+				ok = format.matches(entry.mediaType)
+			}
+			if ok && !added[format] {
+				added[format] = true
+				result = append(result, format)
+			}
+		}
+	}
+	return result
+}
+
+// Negotiate picks the response format from the Accept header. Without one, JSON is used.
+func Negotiate(r *http.Request) (*Format, error) {
+	formats := acceptable(r)
+	if len(formats) == 0 {
+		return nil, ErrNotAcceptable
+	}
+	return formats[0], nil
+}
+
+// Render writes v with the status code in the most preferred format of the
+// Accept header that can represent it. When there is none, e.g. only CSV is
+// accepted for something that is not a list, it responds with 406 Not Acceptable.
+func Render(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	w.Header().Add("Vary", "Accept")
+
+	var buf bytes.Buffer
+	for _, format := range acceptable(r) {
+		buf.Reset()
+		err := format.Encode(&buf, v)
+		if errors.Is(err, ErrNotTabular) {
+			continue
+		}
+		if err != nil {
+			write(w, JSON(), http.StatusInternalServerError, errorBody{
+				Status:  "error",
+				Message: fmt.Sprintf("Failed to encode the response as %s", format.Name),
+			})
+			return
+		}
+
+		w.Header().Set("Content-Type", format.MediaType)
+		w.WriteHeader(status)
+		w.Write(buf.Bytes())
+		return
+	}
+
+	notAcceptable(w)
+}
+
+// RenderError writes an error response like Render, but falls back to JSON
+// instead of failing when the negotiated format cannot represent v
+func RenderError(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	w.Header().Add("Vary", "Accept")
+
+	format, err := Negotiate(r)
+	if err != nil || format.Tabular {
+		format = JSON()
+	}
+	write(w, format, status, v)
+}
+
+// write encodes v in the format, falling back to JSON if that fails
+func write(w http.ResponseWriter, format *Format, status int, v interface{}) {
+	var buf bytes.Buffer
+	if err := format.Encode(&buf, v); err != nil {
+		format = JSON()
+		buf.Reset()
+		format.Encode(&buf, v)
+	}
+
+	w.Header().Set("Content-Type", format.MediaType)
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// notAcceptable writes a 406 response listing the supported media types
+func notAcceptable(w http.ResponseWriter) {
+	mediaTypes := make([]string, len(formats))
+	for i, format := range formats {
+		mediaTypes[i] = format.MediaType
+	}
+
+	write(w, JSON(), http.StatusNotAcceptable, errorBody{
+		Status:  "error",
+		Message: fmt.Sprintf("Not acceptable, supported media types are: %s", strings.Join(mediaTypes, ", ")),
+		Code:    "not_acceptable",
+	})
+}
+
+// Decode decodes the request body into v according to its Content-Type.
+// Without a Content-Type the body is decoded as JSON.
+func Decode(r *http.Request, v interface{}) error {
+	format := JSON()
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			return ErrUnsupportedMediaType
+		}
+
+		format = nil
+		for _, candidate := range formats {
+			if candidate.matches(mediaType) {
+				format = candidate
+				break
+			}
+		}
+		if format == nil {
+			return ErrUnsupportedMediaType
+		}
+	}
+
+	if err := format.Decode(r.Body, v); err != nil {
+		return &DecodeError{Format: format.Name, Err: err}
+	}
+	return nil
+}
+
+// encodeJSON writes v as JSON
+func encodeJSON(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// decodeJSON reads JSON into v
+func decodeJSON(r io.Reader, v interface{}) error {
+	return json.NewDecoder(r).Decode(v)
+}
@@ -0,0 +1,81 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"net/http"
+	"time"
+)
+
+// Header is the request and response header carrying the request ID
+const Header = "X-Request-ID"
+
+// MaxLength is the maximum length of an incoming request ID
+const MaxLength = 128
+
+// contextKey is the key of the request ID in a context
+type contextKey struct{}
+
+// crockford is the base32 alphabet of ULIDs
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// New returns a new ULID: 26 characters encoding a millisecond timestamp and
+// 80 random bits, so IDs sort by creation time and do not collide under load
+func New() string {
+	var id [16]byte
+	binary.BigEndian.PutUint64(id[:8], uint64(time.Now().UnixMilli())<<16)
+	if _, err := rand.Read(id[6:]); err != nil {
+		panic(err)
+	}
+
+	// Encode the 128 bits 5 at a time, from the most significant, after 2 padding bits
+	var out [26]byte
+	hi := binary.BigEndian.Uint64(id[:8])
+	lo := binary.BigEndian.Uint64(id[8:])
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// Valid reports whether an incoming request ID can be used: 1 to MaxLength
+// letters, digits, dots, dashes, underscores or colons, which covers UUIDs,
+// ULIDs and the IDs of common proxies
+func Valid(id string) bool {
+	if id == "" || len(id) > MaxLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '.', c == '-', c == '_', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// NewContext returns a copy of ctx carrying the request ID
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID of ctx, if any
+func FromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	id, ok := ctx.Value(contextKey{}).(string)
+	return id, ok && id != ""
+}
+
+// FromRequest returns the request ID of r, or "" when the request ID
+// middleware did not run
+func FromRequest(r *http.Request) string {
+	id, _ := FromContext(r.Context())
+	return id
+}
@@ -0,0 +1,101 @@
+package requestid
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// timestamp decodes the millisecond timestamp of the first 10 characters of a ULID
+func timestamp(t *testing.T, id string) int64 {
+	t.Helper()
+	var ms int64
+	for _, c := range id[:10] {
+		ms = ms<<5 | int64(strings.IndexRune(crockford, c))
+	}
+	return ms
+}
+
+func TestNew(t *testing.T) {
+	before := time.Now().UnixMilli()
+	id := New()
+	after := time.Now().UnixMilli()
+
+	if len(id) != 26 {
+		t.Fatalf("New() = %q, want 26 characters", id)
+	}
+	for _, c := range id {
+		if !strings.ContainsRune(crockford, c) {
+			t.Fatalf("New() = %q, %q is not in the Crockford alphabet", id, c)
+		}
+	}
+	// The first character holds the top 3 bits of 130 encoded bits
+	if id[0] > '7' {
+		t.Errorf("New() = %q overflows 128 bits", id)
+	}
+	if ms := timestamp(t, id); ms < before || ms > after {
+		t.Errorf("timestamp of %q = %d, want between %d and %d", id, ms, before, after)
+	}
+	if !Valid(id) {
+		t.Errorf("Valid(%q) = false", id)
+	}
+}
+
+func TestNewSortsAndIsUnique(t *testing.T) {
+	seen := make(map[string]bool)
+	previous := New()
+	time.Sleep(2 * time.Millisecond)
+	for i := 0; i < 1000; i++ {
+		id := New()
+		if seen[id] {
+			t.Fatalf("New() returned %q twice", id)
+		}
+		seen[id] = true
+		if i == 0 && id <= previous {
+			t.Errorf("%q of a later millisecond sorts before %q", id, previous)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"01ARZ3NDEKTSV4RRFFQ69G5FAV", true},
+		{"f47ac10b-58cc-4372-a567-0e02b2c3d479", true},
+		{"Root=1-5759e988-bd862e3fe1be46a994272793", false},
+		{"req_1.2:3", true},
+		{"", false},
+		{strings.Repeat("a", MaxLength), true},
+		{strings.Repeat("a", MaxLength+1), false},
+		{"id with spaces", false},
+		{"id\r\nSet-Cookie: x", false},
+		{"<script>", false},
+	}
+	for _, tt := range tests {
+		if got := Valid(tt.id); got != tt.want {
+			t.Errorf("Valid(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestContext(t *testing.T) {
+	if _, ok := FromContext(context.Background()); ok {
+		t.Error("FromContext() found an ID in an empty context")
+	}
+	if _, ok := FromContext(NewContext(context.Background(), "")); ok {
+		t.Error("FromContext() found an empty ID")
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	if got := FromRequest(r); got != "" {
+		t.Errorf("FromRequest() = %q without the middleware", got)
+	}
+	r = r.WithContext(NewContext(r.Context(), "abc"))
+	if got := FromRequest(r); got != "abc" {
+		t.Errorf("FromRequest() = %q, want abc", got)
+	}
+}
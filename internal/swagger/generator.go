@@ -13,8 +13,15 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"regexp"
 	"strings"
 	"went-framework/app/models"
+	"went-framework/internal/idempotency"
+	"went-framework/internal/locking"
+	"went-framework/internal/patch"
+	"went-framework/internal/query"
+	"went-framework/internal/render"
+	"went-framework/internal/tabular"
 
 	"github.com/gorilla/mux"
 )
@@ -48,6 +55,7 @@ type PathItem struct {
 	Get    *Operation `json:"get,omitempty"`
 	Post   *Operation `json:"post,omitempty"`
 	Put    *Operation `json:"put,omitempty"`
+	Patch  *Operation `json:"patch,omitempty"`
 	Delete *Operation `json:"delete,omitempty"`
 }
 
@@ -59,6 +67,9 @@ type Operation struct {
 	Parameters  []Parameter         `json:"parameters,omitempty"`
 	RequestBody *RequestBody        `json:"requestBody,omitempty"`
 	Responses   map[string]Response `json:"responses"`
+	Deprecated  bool                `json:"deprecated,omitempty"`
+	// Middleware is the middleware stack of the route, outermost first
+	Middleware []string `json:"x-middleware,omitempty"`
 }
 
 // Parameter represents an operation parameter
@@ -97,12 +108,18 @@ type Components struct {
 type Schema struct {
 	Type                 string            `json:"type,omitempty"`
 	Format               string            `json:"format,omitempty"`
+	Description          string            `json:"description,omitempty"`
 	Properties           map[string]Schema `json:"properties,omitempty"`
 	Required             []string          `json:"required,omitempty"`
 	Items                *Schema           `json:"items,omitempty"`
 	Ref                  string            `json:"$ref,omitempty"`
 	AdditionalProperties interface{}       `json:"additionalProperties,omitempty"`
 	Example              interface{}       `json:"example,omitempty"`
+	Enum                 []string          `json:"enum,omitempty"`
+	MinLength            *int              `json:"minLength,omitempty"`
+	MaxLength            *int              `json:"maxLength,omitempty"`
+	Minimum              *float64          `json:"minimum,omitempty"`
+	Maximum              *float64          `json:"maximum,omitempty"`
 }
 
 // RouteInfo holds information about a route
@@ -113,6 +130,24 @@ type RouteInfo struct {
 	Tags        []string
 }
 
+// resourceModels maps collection path templates to the model they list
+var resourceModels = make(map[string]interface{})
+
+// requestBodies maps "METHOD path" to the request body type of the route
+var requestBodies = make(map[string]interface{})
+
+// RegisterModel associates a collection path (e.g. /api/users) with its model,
+// so the list operation documents the model's filter and sort parameters
+func RegisterModel(path string, model interface{}) {
+	resourceModels[path] = model
+}
+
+// RegisterRequestBody documents the request body of a route with the given type,
+// including the constraints of its validate tags
+func RegisterRequestBody(method, path string, body interface{}) {
+	requestBodies[method+" "+path] = body
+}
+
 // GenerateSwagger generates OpenAPI/Swagger documentation
 func GenerateSwagger(router *mux.Router, info SwaggerInfo) (*SwaggerSpec, error) {
 	spec := &SwaggerSpec{
@@ -146,6 +181,61 @@ func GenerateSwagger(router *mux.Router, info SwaggerInfo) (*SwaggerSpec, error)
 	return spec, nil
 }
 
+// Only removes the paths for which keep returns false, e.g. those of other API versions
+func (s *SwaggerSpec) Only(keep func(path string) bool) {
+	for path := range s.Paths {
+		if !keep(path) {
+			delete(s.Paths, path)
+		}
+	}
+}
+
+// Deprecate marks the operations of the given paths as deprecated
+func (s *SwaggerSpec) Deprecate(deprecated func(path string) bool) {
+	for path, item := range s.Paths {
+		if !deprecated(path) {
+			continue
+		}
+		for _, operation := range []*Operation{item.Get, item.Post, item.Put, item.Patch, item.Delete} {
+			if operation != nil {
+				operation.Deprecated = true
+			}
+		}
+	}
+}
+
+// SetMiddleware documents the middleware stack of the operation of a route,
+// given with its mux path template, in the x-middleware extension and the
+// description of the operation
+func (s *SwaggerSpec) SetMiddleware(method, path string, middleware []string) {
+	item, ok := s.Paths[pathPattern.ReplaceAllString(path, "{$1}")]
+	if !ok || len(middleware) == 0 {
+		return
+	}
+	operation := map[string]*Operation{
+		"GET":    item.Get,
+		"POST":   item.Post,
+		"PUT":    item.Put,
+		"PATCH":  item.Patch,
+		"DELETE": item.Delete,
+	}[method]
+	if operation == nil {
+		return
+	}
+
+	operation.Middleware = middleware
+	if operation.Description != "" {
+		operation.Description += "\n\n"
+	}
+	operation.Description += "Middleware: `" + strings.Join(middleware, "` → `") + "`"
+}
+
+// pathPattern matches a path variable with a pattern, e.g. {version:v[0-9]+}
+var pathPattern = regexp.MustCompile(`\{(\w+):[^}]+\}`)
+
+// pathVariable matches a path variable, e.g. {id}
+var pathVariable = regexp.MustCompile(`\{(\w+)\}`)
+
 // extractRoutes extracts route information from the mux router
 func extractRoutes(router *mux.Router) []RouteInfo {
 	var routes []RouteInfo
@@ -161,6 +251,9 @@ func extractRoutes(router *mux.Router) []RouteInfo {
 			return nil
 		}
 
+		// OpenAPI path templates have no patterns: /swagger/{version:v[0-9]+}.json => /swagger/{version}.json
+		pathTemplate = pathPattern.ReplaceAllString(pathTemplate, "{$1}")
+
 		for _, method := range methods {
 			// Extract handler name and tags
 			handlerName := extractHandlerName(pathTemplate, method)
@@ -182,9 +275,11 @@ func extractRoutes(router *mux.Router) []RouteInfo {
 
 // generateSchemas generates schema definitions from models
 func generateSchemas(spec *SwaggerSpec) error {
-	// Generate User schema
-	userSchema := generateModelSchema(reflect.TypeOf(models.User{}))
-	spec.Components.Schemas["User"] = userSchema
+	// Generate User schema along with the schemas of its related models
+	addModelSchema(spec, reflect.TypeOf(models.User{}))
+	for _, model := range resourceModels {
+		addModelSchema(spec, reflect.TypeOf(model))
+	}
 
 	// Generate common response schemas
 	spec.Components.Schemas["Response"] = Schema{
@@ -201,10 +296,16 @@ func generateSchemas(spec *SwaggerSpec) error {
 			"data": {
 				AdditionalProperties: true,
 			},
+			"meta": {
+				Ref: "#/components/schemas/Pagination",
+			},
 		},
 		Required: []string{"status", "message"},
 	}
 
+	spec.Components.Schemas["Pagination"] = generateModelSchema(reflect.TypeOf(query.Pagination{}))
+	spec.Components.Schemas["CursorPage"] = generateModelSchema(reflect.TypeOf(query.CursorPage{}))
+
 	spec.Components.Schemas["ErrorResponse"] = Schema{
 		Type: "object",
 		Properties: map[string]Schema{
@@ -216,13 +317,154 @@ func generateSchemas(spec *SwaggerSpec) error {
 				Type:    "string",
 				Example: "Error description",
 			},
+			"code": {
+				Type:    "string",
+				Example: "not_found",
+			},
 		},
 		Required: []string{"status", "message"},
 	}
 
+	spec.Components.Schemas["BulkResponse"] = Schema{
+		Type: "object",
+		Properties: map[string]Schema{
+			"status": {
+				Type:    "string",
+				Enum:    []string{"success", "partial", "error"},
+				Example: "partial",
+			},
+			"message": {
+				Type:    "string",
+				Example: "1 of 2 users created, see the result of each item",
+			},
+			"data": {
+				Type: "array",
+				Items: &Schema{
+					Type: "object",
+					Properties: map[string]Schema{
+						"index":   {Type: "integer", Example: 0},
+						"id":      {Type: "integer", Format: "int64", Example: 1},
+						"status":  {Type: "integer", Example: 201},
+						"message": {Type: "string"},
+						"errors":  {Type: "object", AdditionalProperties: Schema{Type: "string"}},
+					},
+					Required: []string{"index", "status"},
+				},
+			},
+			"meta": {
+				Type: "object",
+				Properties: map[string]Schema{
+					"mode":      {Type: "string", Enum: []string{"atomic", "best_effort"}},
+					"total":     {Type: "integer", Example: 2},
+					"succeeded": {Type: "integer", Example: 1},
+					"failed":    {Type: "integer", Example: 1},
+				},
+			},
+		},
+		Required: []string{"status", "message", "data", "meta"},
+	}
+
+	spec.Components.Schemas["ImportResponse"] = Schema{
+		Type: "object",
+		Properties: map[string]Schema{
+			"status": {
+				Type:    "string",
+				Enum:    []string{"success", "partial", "error"},
+				Example: "partial",
+			},
+			"message": {
+				Type:    "string",
+				Example: "1 of 2 users imported, see the errors of the other rows",
+			},
+			"data": {
+				Type:        "array",
+				Description: "The rows that were not imported",
+				Items: &Schema{
+					Type: "object",
+					Properties: map[string]Schema{
+						"row":     {Type: "integer", Description: "Line in the file, the header is line 1", Example: 3},
+						"status":  {Type: "integer", Example: 422},
+						"message": {Type: "string", Example: "The given data was invalid"},
+						"errors":  {Type: "object", AdditionalProperties: Schema{Type: "string"}},
+					},
+					Required: []string{"row", "status", "message"},
+				},
+			},
+			"meta": {
+				Type: "object",
+				Properties: map[string]Schema{
+					"dry_run":         {Type: "boolean", Example: false},
+					"total":           {Type: "integer", Example: 2},
+					"imported":        {Type: "integer", Example: 1},
+					"failed":          {Type: "integer", Example: 1},
+					"columns":         {Type: "object", Description: "Field of each imported column", AdditionalProperties: Schema{Type: "string"}},
+					"ignored_columns": {Type: "array", Items: &Schema{Type: "string"}},
+				},
+			},
+		},
+		Required: []string{"status", "message", "meta"},
+	}
+
+	spec.Components.Schemas["ValidationErrorResponse"] = Schema{
+		Type: "object",
+		Properties: map[string]Schema{
+			"status": {
+				Type:    "string",
+				Example: "error",
+			},
+			"message": {
+				Type:    "string",
+				Example: "The given data was invalid",
+			},
+			"code": {
+				Type:    "string",
+				Example: "validation_failed",
+			},
+			"errors": {
+				Type:                 "object",
+				AdditionalProperties: Schema{Type: "string"},
+				Example:              map[string]string{"email": "The email has already been taken"},
+			},
+		},
+		Required: []string{"status", "message", "errors"},
+	}
+
 	return nil
 }
 
+// addModelSchema adds the component schema of a model and, recursively, of the models it relates to
+func addModelSchema(spec *SwaggerSpec, t reflect.Type) {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+
+	if _, exists := spec.Components.Schemas[t.Name()]; exists {
+		return
+	}
+
+	// Reserve the name first so cyclic relations (User -> Post -> User) terminate
+	spec.Components.Schemas[t.Name()] = Schema{}
+	spec.Components.Schemas[t.Name()] = generateModelSchema(t)
+
+	for i := 0; i < t.NumField(); i++ {
+		if isModel(t.Field(i).Type) {
+			addModelSchema(spec, t.Field(i).Type)
+		}
+	}
+}
+
+// isModel reports whether t (or its element type) is a GORM model with its own component schema
+func isModel(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	_, ok := reflect.New(t).Interface().(interface{ TableName() string })
+	return ok
+}
+
 // generateModelSchema generates a schema from a Go struct type
 func generateModelSchema(t reflect.Type) Schema {
 	if t.Kind() == reflect.Ptr {
@@ -239,6 +481,16 @@ func generateModelSchema(t reflect.Type) Schema {
 		field := t.Field(i)
 		jsonTag := field.Tag.Get("json")
 
+		// Embedded structs (e.g. locking.Versioning) are flattened like encoding/json does
+		if field.Anonymous && jsonTag == "" && field.Type.Kind() == reflect.Struct {
+			embedded := generateModelSchema(field.Type)
+			for name, property := range embedded.Properties {
+				schema.Properties[name] = property
+			}
+			schema.Required = append(schema.Required, embedded.Required...)
+			continue
+		}
+
 		if jsonTag == "" || jsonTag == "-" {
 			continue
 		}
@@ -251,16 +503,24 @@ func generateModelSchema(t reflect.Type) Schema {
 
 		// Generate field schema
 		fieldSchema := generateFieldSchema(field.Type)
+		validateTag, validated := field.Tag.Lookup("validate")
+		if validated {
+			applyValidateRules(&fieldSchema, validateTag)
+		}
 
 		// Add example based on field name
-		if example := generateExample(jsonName, field.Type); example != nil {
+		if example := generateExample(jsonName, field.Type); example != nil && !isModel(field.Type) {
 			fieldSchema.Example = example
 		}
 
 		schema.Properties[jsonName] = fieldSchema
 
-		// Check if field is required (not omitempty)
-		if !strings.Contains(jsonTag, "omitempty") {
+		// Check if field is required: by its validate rules if it has any, else not omitempty
+		if validated {
+			if hasRule(validateTag, "required") {
+				schema.Required = append(schema.Required, jsonName)
+			}
+		} else if !strings.Contains(jsonTag, "omitempty") {
 			schema.Required = append(schema.Required, jsonName)
 		}
 	}
@@ -268,6 +528,60 @@ func generateModelSchema(t reflect.Type) Schema {
 	return schema
 }
 
+// hasRule reports whether a validate tag contains the given rule
+func hasRule(tag, rule string) bool {
+	for _, part := range strings.Split(tag, ",") {
+		if name, _, _ := strings.Cut(part, "="); name == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// applyValidateRules documents the constraints of a validate tag on a field schema
+func applyValidateRules(schema *Schema, tag string) {
+	var notes []string
+	for _, part := range strings.Split(tag, ",") {
+		rule, param, _ := strings.Cut(part, "=")
+		switch rule {
+		case "email":
+			schema.Format = "email"
+		case "url":
+			schema.Format = "uri"
+		case "uuid":
+			schema.Format = "uuid"
+		case "oneof":
+			schema.Enum = strings.Fields(param)
+		case "min", "max", "len":
+			var n float64
+			if _, err := fmt.Sscan(param, &n); err != nil {
+				continue
+			}
+			if schema.Type == "string" {
+				length := int(n)
+				if rule != "max" {
+					schema.MinLength = &length
+				}
+				if rule != "min" {
+					schema.MaxLength = &length
+				}
+			} else if schema.Type == "integer" || schema.Type == "number" {
+				if rule != "max" {
+					schema.Minimum = &n
+				}
+				if rule != "min" {
+					schema.Maximum = &n
+				}
+			}
+		case "unique":
+			notes = append(notes, fmt.Sprintf("Must be unique (%s)", param))
+		case "exists":
+			notes = append(notes, fmt.Sprintf("Must exist in %s", param))
+		}
+	}
+	schema.Description = strings.Join(notes, ". ")
+}
+
 // generateFieldSchema generates schema for a struct field
 func generateFieldSchema(t reflect.Type) Schema {
 	switch t.Kind() {
@@ -281,16 +595,23 @@ func generateFieldSchema(t reflect.Type) Schema {
 		return Schema{Type: "number"}
 	case reflect.Bool:
 		return Schema{Type: "boolean"}
+	case reflect.Ptr:
+		return generateFieldSchema(t.Elem())
 	case reflect.Slice:
+		items := generateFieldSchema(t.Elem())
 		return Schema{
 			Type:  "array",
-			Items: &Schema{Type: "string"}, // Default to string, can be improved
+			Items: &items,
 		}
 	case reflect.Struct:
 		// Handle time.Time specifically
 		if t.String() == "time.Time" {
 			return Schema{Type: "string", Format: "date-time"}
 		}
+		// Related models reference their own component schema
+		if isModel(t) {
+			return Schema{Ref: "#/components/schemas/" + t.Name()}
+		}
 		return generateModelSchema(t)
 	default:
 		return Schema{Type: "string"}
@@ -338,6 +659,8 @@ func generatePaths(spec *SwaggerSpec, routes []RouteInfo) error {
 			pathItem.Post = operation
 		case "PUT":
 			pathItem.Put = operation
+		case "PATCH":
+			pathItem.Patch = operation
 		case "DELETE":
 			pathItem.Delete = operation
 		}
@@ -357,33 +680,386 @@ func generateOperation(route RouteInfo) *Operation {
 	}
 
 	// Add path parameters
-	if strings.Contains(route.Path, "{id}") {
-		operation.Parameters = []Parameter{
-			{
-				Name:        "id",
-				In:          "path",
-				Description: "Resource ID",
-				Required:    true,
-				Schema:      Schema{Type: "integer"},
-			},
+	for _, match := range pathVariable.FindAllStringSubmatch(route.Path, -1) {
+		parameter := Parameter{Name: match[1], In: "path", Required: true, Schema: Schema{Type: "string"}}
+		if match[1] == "id" {
+			parameter.Description = "Resource ID"
+			parameter.Schema = Schema{Type: "integer"}
+		}
+		operation.Parameters = append(operation.Parameters, parameter)
+	}
+
+	// Add filter, sort and pagination parameters for list endpoints
+	if model, ok := resourceModels[route.Path]; ok && route.Method == "GET" {
+		operation.Parameters = append(operation.Parameters, generateListParameters(model)...)
+	}
+
+	// Document eager loading and optimistic locking for single resources
+	if model, ok := resourceModels[strings.TrimSuffix(route.Path, "/{id}")]; ok && strings.HasSuffix(route.Path, "/{id}") {
+		if include := generateIncludeParameter(model); include != nil && route.Method == "GET" {
+			operation.Parameters = append(operation.Parameters, *include)
+		}
+		if route.Method == "GET" {
+			operation.Parameters = append(operation.Parameters, generateFieldsParameters(model)...)
+		}
+		if _, versioned := reflect.New(reflect.TypeOf(model)).Interface().(locking.Versioned); versioned {
+			addPreconditions(operation, route.Method)
 		}
 	}
 
 	// Add request body for POST and PUT
 	if route.Method == "POST" || route.Method == "PUT" {
-		operation.RequestBody = generateRequestBody(route.Path)
+		operation.RequestBody = generateRequestBody(route.Method, route.Path)
+	}
+
+	// Add merge patch and JSON patch bodies for PATCH
+	if model, ok := resourceModels[strings.TrimSuffix(route.Path, "/{id}")]; ok && route.Method == "PATCH" {
+		operation.RequestBody = generatePatchRequestBody(model)
+	}
+
+	// Document the bulk routes of resources
+	if model, ok := resourceModels[strings.TrimSuffix(route.Path, "/bulk")]; ok && strings.HasSuffix(route.Path, "/bulk") {
+		operation.Parameters = append(operation.Parameters, Parameter{
+			Name:        "mode",
+			In:          "query",
+			Description: "atomic (default) writes all items or none, best_effort writes every valid item",
+			Schema:      Schema{Type: "string", Enum: []string{"atomic", "best_effort"}},
+		})
+		switch route.Method {
+		case "PATCH":
+			operation.RequestBody = generateBulkPatchRequestBody(model)
+		case "DELETE":
+			operation.RequestBody = &RequestBody{
+				Description: "IDs of the records to delete",
+				Required:    true,
+				Content: map[string]MediaType{
+					"application/json": {
+						Schema: Schema{Type: "array", Items: &Schema{Type: "integer", Format: "int64"}},
+					},
+				},
+			}
+		}
+	}
+
+	// Unsafe requests can be retried with an Idempotency-Key
+	if route.Method == "POST" || route.Method == "PATCH" {
+		addIdempotencyKey(operation)
+	}
+	// GET responses are tagged by the cache middleware
+	if route.Method == "GET" {
+		addConditionalGet(operation)
+	}
+
+	// Document the export and import routes of resources
+	if model, ok := resourceModels[strings.TrimSuffix(route.Path, "/export")]; ok && strings.HasSuffix(route.Path, "/export") {
+		operation.Parameters = append(operation.Parameters, generateExportParameters(model)...)
+		return operation
+	}
+	if model, ok := resourceModels[strings.TrimSuffix(route.Path, "/import")]; ok && strings.HasSuffix(route.Path, "/import") {
+		operation.Parameters = append(operation.Parameters, generateImportParameters()...)
+		operation.RequestBody = generateImportRequestBody(route.Path, model)
+		return operation
+	}
+
+	// Document the formats negotiated with Accept and Content-Type
+	if route.Path != "/api/health" {
+		_, list := resourceModels[route.Path]
+		addMediaTypes(operation, list && route.Method == "GET")
 	}
 
 	return operation
 }
 
+// generateListParameters documents the query parameters accepted by query.Parse
+func generateListParameters(model interface{}) []Parameter {
+	var parameters []Parameter
+
+	if f, ok := model.(query.Filterable); ok {
+		for _, field := range f.FilterableFields() {
+			parameters = append(parameters, Parameter{
+				Name: fmt.Sprintf("filter[%s]", field),
+				In:   "query",
+				Description: fmt.Sprintf("Filter by %s. Use filter[%s][op] for other operators (%s)",
+					field, field, strings.Join(query.Operators, ", ")),
+				Schema: Schema{Type: "string"},
+			})
+		}
+	}
+
+	if include := generateIncludeParameter(model); include != nil {
+		parameters = append(parameters, *include)
+	}
+	parameters = append(parameters, generateFieldsParameters(model)...)
+
+	if s, ok := model.(query.Searchable); ok {
+		parameters = append(parameters, Parameter{
+			Name: "q",
+			In:   "query",
+			Description: fmt.Sprintf("Full-text search over %s. Results are ranked and returned with highlighted snippets",
+				strings.Join(s.SearchableFields(), ", ")),
+			Schema: Schema{Type: "string", Example: "john"},
+		})
+	}
+
+	if s, ok := model.(query.Sortable); ok {
+		parameters = append(parameters, Parameter{
+			Name: "sort",
+			In:   "query",
+			Description: fmt.Sprintf("Comma-separated sort fields, prefix with - for descending. Allowed: %s",
+				strings.Join(s.SortableFields(), ", ")),
+			Schema: Schema{Type: "string", Example: "-created_at,name"},
+		})
+	}
+
+	parameters = append(parameters,
+		Parameter{
+			Name:        "page",
+			In:          "query",
+			Description: "Page number",
+			Schema:      Schema{Type: "integer", Example: 1},
+		},
+		Parameter{
+			Name:        "cursor",
+			In:          "query",
+			Description: "Use cursor pagination instead of pages. Pass an empty value for the first page, then next_cursor/prev_cursor from meta or the Link header",
+			Schema:      Schema{Type: "string"},
+		},
+		Parameter{
+			Name:        "per_page",
+			In:          "query",
+			Description: fmt.Sprintf("Items per page (default %d, max %d)", query.DefaultPerPage, query.MaxPerPage),
+			Schema:      Schema{Type: "integer", Example: query.DefaultPerPage},
+		},
+	)
+
+	return parameters
+}
+
+// generateExportParameters documents the format of an export and the list
+// parameters it takes; exports are not paginated
+func generateExportParameters(model interface{}) []Parameter {
+	parameters := []Parameter{{
+		Name:        "format",
+		In:          "query",
+		Description: "File format (default csv)",
+		Schema:      Schema{Type: "string", Enum: tabular.Names()},
+	}}
+
+	for _, parameter := range generateListParameters(model) {
+		if parameter.Name == "include" || parameter.Name == "page" || parameter.Name == "cursor" ||
+			parameter.Name == "per_page" || strings.HasPrefix(parameter.Name, "fields") {
+			continue
+		}
+		parameters = append(parameters, parameter)
+	}
+	return parameters
+}
+
+// generateImportParameters documents the options of an import
+func generateImportParameters() []Parameter {
+	return []Parameter{
+		{
+			Name:        "dry_run",
+			In:          "query",
+			Description: "Validate the file and report the errors without importing anything",
+			Schema:      Schema{Type: "boolean", Example: true},
+		},
+		{
+			Name:        "report",
+			In:          "query",
+			Description: "Set to csv to get the failed rows as a CSV file with their line number and errors",
+			Schema:      Schema{Type: "string", Enum: []string{"csv"}},
+		},
+		{
+			Name:        "columns[{column}]",
+			In:          "query",
+			Description: "Maps a column of the file to a field. Other columns are matched to fields by name, ignoring case and punctuation",
+			Schema:      Schema{Type: "string", Example: "email"},
+		},
+	}
+}
+
+// generateImportRequestBody documents the CSV file of an import, whose columns
+// are the fields of the store request body
+func generateImportRequestBody(path string, model interface{}) *RequestBody {
+	body, ok := requestBodies["POST "+strings.TrimSuffix(path, "/import")]
+	if !ok {
+		body = model
+	}
+	description := fmt.Sprintf("CSV file with a header row. Columns: %s", strings.Join(render.FieldNames(body), ", "))
+
+	return &RequestBody{
+		Description: description,
+		Required:    true,
+		Content: map[string]MediaType{
+			"multipart/form-data": {
+				Schema: Schema{
+					Type: "object",
+					Properties: map[string]Schema{
+						"file": {Type: "string", Format: "binary", Description: "The CSV file"},
+					},
+					Required: []string{"file"},
+				},
+			},
+			"text/csv": {
+				Schema: Schema{Type: "string", Example: "name,email\nJohn Doe,john@example.com"},
+			},
+		},
+	}
+}
+
+// generateFieldsParameters documents the sparse fieldsets of a model and of the
+// types of its includable relations
+func generateFieldsParameters(model interface{}) []Parameter {
+	var parameters []Parameter
+	if s, ok := model.(query.Selectable); ok {
+		fields := s.SelectableFields()
+		parameters = append(parameters, Parameter{
+			Name:        "fields",
+			In:          "query",
+			Description: fmt.Sprintf("Comma-separated fields to return, all by default. Allowed: %s", strings.Join(fields, ", ")),
+			Schema:      Schema{Type: "string", Example: strings.Join(fields[:min(2, len(fields))], ",")},
+		})
+	}
+
+	i, ok := model.(query.Includable)
+	if !ok {
+		return parameters
+	}
+	documented := map[string]bool{}
+	for _, relation := range i.IncludableRelations() {
+		related, typ, err := query.IncludedModel(model, relation)
+		if err != nil || documented[typ] {
+			continue
+		}
+		documented[typ] = true
+		if s, ok := related.(query.Selectable); ok {
+			parameters = append(parameters, Parameter{
+				Name:        fmt.Sprintf("fields[%s]", typ),
+				In:          "query",
+				Description: fmt.Sprintf("Comma-separated fields to return for included %s. Allowed: %s", typ, strings.Join(s.SelectableFields(), ", ")),
+				Schema:      Schema{Type: "string"},
+			})
+		}
+	}
+	return parameters
+}
+
+// generateIncludeParameter documents the ?include= relations of a model
+func generateIncludeParameter(model interface{}) *Parameter {
+	i, ok := model.(query.Includable)
+	if !ok {
+		return nil
+	}
+
+	return &Parameter{
+		Name:        "include",
+		In:          "query",
+		Description: fmt.Sprintf("Comma-separated relations to eager load. Allowed: %s", strings.Join(i.IncludableRelations(), ", ")),
+		Schema:      Schema{Type: "string", Example: strings.Join(i.IncludableRelations(), ",")},
+	}
+}
+
+// addPreconditions documents ETag, If-Match and the related error responses
+func addPreconditions(operation *Operation, method string) {
+	errorContent := map[string]MediaType{
+		"application/json": {
+			Schema: Schema{Ref: "#/components/schemas/ErrorResponse"},
+		},
+	}
+
+	switch method {
+	case "GET":
+		if response, ok := operation.Responses["200"]; ok {
+			response.Description += ". The ETag header carries the resource version"
+			operation.Responses["200"] = response
+		}
+	case "PUT", "PATCH", "DELETE":
+		operation.Parameters = append(operation.Parameters, Parameter{
+			Name:        "If-Match",
+			In:          "header",
+			Description: "ETag from a previous GET; the request fails with 412 if the resource changed since",
+			Schema:      Schema{Type: "string", Example: `"1"`},
+		})
+		operation.Responses["409"] = Response{Description: "Resource was modified concurrently", Content: errorContent}
+		operation.Responses["412"] = Response{Description: "If-Match does not match the current version", Content: errorContent}
+		operation.Responses["428"] = Response{Description: "If-Match header is missing on a route that requires it", Content: errorContent}
+	}
+}
+
+// addConditionalGet documents the If-None-Match and If-Modified-Since headers
+// answered with 304 by the cache middleware
+func addConditionalGet(operation *Operation) {
+	operation.Parameters = append(operation.Parameters,
+		Parameter{
+			Name:        "If-None-Match",
+			In:          "header",
+			Description: "ETag of a previous response; the request returns 304 if it is still current",
+			Schema:      Schema{Type: "string", Example: `"5yptiuGjxrN8ydVAm-5UmGsy"`},
+		},
+		Parameter{
+			Name:        "If-Modified-Since",
+			In:          "header",
+			Description: "Last-Modified date of a previous response; without If-None-Match, the request returns 304 if the resource is unchanged since",
+			Schema:      Schema{Type: "string", Example: "Sun, 18 Oct 2026 13:41:03 GMT"},
+		},
+	)
+	operation.Responses["304"] = Response{Description: "Not modified, the cached response is still current"}
+}
+
+// apiPrefix matches the /api prefix of paths along with their version, e.g. /api/v1
+var apiPrefix = regexp.MustCompile(`^/api(/v[0-9]+)?`)
+
+// addIdempotencyKey documents the Idempotency-Key header honoured by the
+// idempotency middleware on POST and PATCH requests
+func addIdempotencyKey(operation *Operation) {
+	errorContent := map[string]MediaType{
+		"application/json": {
+			Schema: Schema{Ref: "#/components/schemas/ErrorResponse"},
+		},
+	}
+
+	operation.Parameters = append(operation.Parameters, Parameter{
+		Name:        idempotency.Header,
+		In:          "header",
+		Description: "Unique key of the request; retries with the same key replay the first response instead of repeating the request",
+		Schema:      Schema{Type: "string", Example: "6f1c2a4e-9b7d-4e35-8a0f-2d4c5b6a7e8f"},
+	})
+
+	conflict := "A request with the same Idempotency-Key is still being processed"
+	if response, ok := operation.Responses["409"]; ok {
+		response.Description += ", or " + strings.ToLower(conflict[:1]) + conflict[1:]
+		operation.Responses["409"] = response
+	} else {
+		operation.Responses["409"] = Response{Description: conflict, Content: errorContent}
+	}
+
+	reused := "The Idempotency-Key was used for a different request"
+	if response, ok := operation.Responses["422"]; ok {
+		response.Description += ", or " + strings.ToLower(reused[:1]) + reused[1:]
+		operation.Responses["422"] = response
+	} else {
+		operation.Responses["422"] = Response{Description: reused, Content: errorContent}
+	}
+}
+
 // generateSummary generates operation summary
 func generateSummary(method, path string) string {
-	cleanPath := strings.TrimPrefix(path, "/api")
+	cleanPath := apiPrefix.ReplaceAllString(path, "")
 
 	switch {
 	case path == "/api/health":
 		return "Health check"
+	case method == "GET" && strings.Contains(cleanPath, "/{id}/"):
+		// Nested relation routes such as /users/{id}/posts
+		pathParts := strings.Split(strings.Trim(cleanPath, "/"), "/")
+		return fmt.Sprintf("Get %s of %s", pathParts[len(pathParts)-1], strings.TrimSuffix(pathParts[0], "s"))
+	case strings.HasSuffix(cleanPath, "/bulk"):
+		return bulkSummary(method, cleanPath)
+	case strings.HasSuffix(cleanPath, "/export"):
+		return fmt.Sprintf("Export %s", strings.Split(strings.Trim(cleanPath, "/"), "/")[0])
+	case strings.HasSuffix(cleanPath, "/import"):
+		return fmt.Sprintf("Import %s", strings.Split(strings.Trim(cleanPath, "/"), "/")[0])
 	case method == "GET" && cleanPath == "/users":
 		return "Get all users"
 	case method == "GET" && strings.Contains(cleanPath, "/users/{id}"):
@@ -392,6 +1068,8 @@ func generateSummary(method, path string) string {
 		return "Create new user"
 	case method == "PUT" && strings.Contains(cleanPath, "/users/{id}"):
 		return "Update user"
+	case method == "PATCH" && strings.Contains(cleanPath, "/users/{id}"):
+		return "Patch user"
 	case method == "DELETE" && strings.Contains(cleanPath, "/users/{id}"):
 		return "Delete user"
 	default:
@@ -399,10 +1077,110 @@ func generateSummary(method, path string) string {
 	}
 }
 
+// bulkSummary summarizes a bulk route such as /users/bulk
+func bulkSummary(method, cleanPath string) string {
+	resource := strings.Split(strings.Trim(cleanPath, "/"), "/")[0]
+	switch method {
+	case "POST":
+		return fmt.Sprintf("Create %s in bulk", resource)
+	case "PATCH":
+		return fmt.Sprintf("Patch %s in bulk", resource)
+	case "DELETE":
+		return fmt.Sprintf("Delete %s in bulk", resource)
+	default:
+		return fmt.Sprintf("%s %s", method, cleanPath)
+	}
+}
+
+// generateBulkResponses documents the per-item result responses of bulk routes
+func generateBulkResponses(method string) map[string]Response {
+	bulkContent := map[string]MediaType{
+		"application/json": {
+			Schema: Schema{Ref: "#/components/schemas/BulkResponse"},
+		},
+	}
+	errorContent := map[string]MediaType{
+		"application/json": {
+			Schema: Schema{Ref: "#/components/schemas/ErrorResponse"},
+		},
+	}
+
+	success := "200"
+	if method == "POST" {
+		success = "201"
+	}
+
+	return map[string]Response{
+		success: {Description: "All items were written", Content: bulkContent},
+		"207":   {Description: "Some items were written, see the status of each item", Content: bulkContent},
+		"400":   {Description: "Bad request", Content: errorContent},
+		"413":   {Description: "Too many items in one request", Content: errorContent},
+		"422":   {Description: "No item was written, see the status of each item", Content: bulkContent},
+		"500":   {Description: "Internal server error", Content: errorContent},
+	}
+}
+
+// generateExportResponses documents the file responses of export routes
+func generateExportResponses() map[string]Response {
+	files := map[string]MediaType{}
+	for _, format := range tabular.Formats() {
+		files[format.MediaType] = MediaType{Schema: Schema{Type: "string", Format: "binary"}}
+	}
+	errorContent := map[string]MediaType{
+		"application/json": {
+			Schema: Schema{Ref: "#/components/schemas/ErrorResponse"},
+		},
+	}
+
+	return map[string]Response{
+		"200": {Description: "The file, sent as an attachment", Content: files},
+		"400": {Description: "Invalid format, filter or sort", Content: errorContent},
+		"500": {Description: "Internal server error", Content: errorContent},
+	}
+}
+
+// generateImportResponses documents the responses of import routes: the import
+// summary with the failed rows, or the CSV error report
+func generateImportResponses() map[string]Response {
+	importContent := map[string]MediaType{
+		"application/json": {
+			Schema: Schema{Ref: "#/components/schemas/ImportResponse"},
+		},
+		"text/csv": {
+			Schema: Schema{Type: "string", Description: "The failed rows with their line number and errors, with ?report=csv"},
+		},
+	}
+	errorContent := map[string]MediaType{
+		"application/json": {
+			Schema: Schema{Ref: "#/components/schemas/ErrorResponse"},
+		},
+	}
+
+	return map[string]Response{
+		"200": {Description: "Dry run, all rows are valid", Content: importContent},
+		"201": {Description: "All rows were imported", Content: importContent},
+		"207": {Description: "Some rows were imported, see the errors of the others", Content: importContent},
+		"400": {Description: "The file is missing, invalid or its columns match no field", Content: errorContent},
+		"413": {Description: "Too many rows in one file", Content: errorContent},
+		"415": {Description: "The request is not a multipart upload or CSV", Content: errorContent},
+		"422": {Description: "No row was imported, see the errors of each row", Content: importContent},
+		"500": {Description: "Internal server error", Content: errorContent},
+	}
+}
+
 // generateResponses generates response documentation
 func generateResponses(method, path string) map[string]Response {
 	responses := make(map[string]Response)
 
+	switch {
+	case strings.HasSuffix(path, "/bulk"):
+		return generateBulkResponses(method)
+	case strings.HasSuffix(path, "/export"):
+		return generateExportResponses()
+	case strings.HasSuffix(path, "/import"):
+		return generateImportResponses()
+	}
+
 	if path == "/api/health" {
 		responses["200"] = Response{
 			Description: "Health check successful",
@@ -460,6 +1238,15 @@ func generateResponses(method, path string) map[string]Response {
 				},
 			},
 		}
+		responses["409"] = Response{
+			Description: "A record with the same unique value already exists",
+			Content: map[string]MediaType{
+				"application/json": {
+					Schema: Schema{Ref: "#/components/schemas/ErrorResponse"},
+				},
+			},
+		}
+		responses["422"] = validationErrorResponse()
 	case "PUT":
 		responses["200"] = Response{
 			Description: "Resource updated successfully",
@@ -469,6 +1256,33 @@ func generateResponses(method, path string) map[string]Response {
 				},
 			},
 		}
+		responses["422"] = validationErrorResponse()
+	case "PATCH":
+		responses["200"] = Response{
+			Description: "Resource patched successfully",
+			Content: map[string]MediaType{
+				"application/json": {
+					Schema: Schema{Ref: "#/components/schemas/Response"},
+				},
+			},
+		}
+		responses["409"] = Response{
+			Description: "A JSON patch test operation failed",
+			Content: map[string]MediaType{
+				"application/json": {
+					Schema: Schema{Ref: "#/components/schemas/ErrorResponse"},
+				},
+			},
+		}
+		responses["415"] = Response{
+			Description: "The patch media type is not supported",
+			Content: map[string]MediaType{
+				"application/json": {
+					Schema: Schema{Ref: "#/components/schemas/ErrorResponse"},
+				},
+			},
+		}
+		responses["422"] = validationErrorResponse()
 	case "DELETE":
 		responses["200"] = Response{
 			Description: "Resource deleted successfully",
@@ -502,8 +1316,145 @@ func generateResponses(method, path string) map[string]Response {
 	return responses
 }
 
+// addMediaTypes documents the formats of render next to application/json.
+// CSV is only offered for list responses and list request bodies.
+func addMediaTypes(operation *Operation, list bool) {
+	for code, response := range operation.Responses {
+		content, ok := response.Content["application/json"]
+		if !ok {
+			continue
+		}
+		for _, format := range render.Formats() {
+			if format.Tabular && !(list && code == "200") {
+				continue
+			}
+			response.Content[format.MediaType] = content
+		}
+	}
+
+	if operation.RequestBody != nil {
+		if content, ok := operation.RequestBody.Content["application/json"]; ok {
+			for _, format := range render.Formats() {
+				// CSV rows can only carry lists of objects
+				if format.Tabular && (content.Schema.Items == nil || content.Schema.Items.Type == "integer") {
+					continue
+				}
+				operation.RequestBody.Content[format.MediaType] = content
+			}
+		}
+		if _, ok := operation.Responses["415"]; !ok {
+			operation.Responses["415"] = Response{
+				Description: "The request body media type is not supported",
+				Content: map[string]MediaType{
+					"application/json": {
+						Schema: Schema{Ref: "#/components/schemas/ErrorResponse"},
+					},
+				},
+			}
+		}
+	}
+
+	operation.Responses["406"] = Response{
+		Description: "None of the accepted media types is supported",
+		Content: map[string]MediaType{
+			"application/json": {
+				Schema: Schema{Ref: "#/components/schemas/ErrorResponse"},
+			},
+		},
+	}
+}
+
+// generateMergePatchSchema documents a merge patch of the patchable fields of a
+// model, returning the schema and the field names
+func generateMergePatchSchema(model interface{}) (Schema, []string) {
+	modelSchema := generateModelSchema(reflect.TypeOf(model))
+	mergePatch := Schema{Type: "object", Properties: map[string]Schema{}}
+	var fields []string
+	if p, ok := model.(patch.Patchable); ok {
+		for _, field := range p.PatchableFields() {
+			if property, ok := modelSchema.Properties[field]; ok {
+				mergePatch.Properties[field] = property
+				fields = append(fields, field)
+			}
+		}
+	}
+	return mergePatch, fields
+}
+
+// generateBulkPatchRequestBody documents the list of merge patches of a bulk patch
+func generateBulkPatchRequestBody(model interface{}) *RequestBody {
+	item, fields := generateMergePatchSchema(model)
+	item.Properties["id"] = Schema{Type: "integer", Format: "int64", Example: 1}
+	item.Properties["version"] = Schema{Type: "integer", Format: "int64", Description: "Fails the item with 409 if the record has another version"}
+	item.Required = []string{"id"}
+
+	schema := Schema{Type: "array", Items: &item}
+	return &RequestBody{
+		Description: fmt.Sprintf("Merge patches of the patchable fields (%s), each with the id of its record", strings.Join(fields, ", ")),
+		Required:    true,
+		Content: map[string]MediaType{
+			"application/json": {Schema: schema},
+			patch.MergePatch:   {Schema: schema},
+		},
+	}
+}
+
+// generatePatchRequestBody documents the merge patch and JSON patch bodies
+// accepted for the patchable fields of a model
+func generatePatchRequestBody(model interface{}) *RequestBody {
+	mergePatch, fields := generateMergePatchSchema(model)
+
+	return &RequestBody{
+		Description: fmt.Sprintf("Changes to the patchable fields: %s", strings.Join(fields, ", ")),
+		Required:    true,
+		Content: map[string]MediaType{
+			patch.MergePatch: {
+				Schema: mergePatch,
+			},
+			patch.JSONPatch: {
+				Schema: Schema{
+					Type: "array",
+					Items: &Schema{
+						Type: "object",
+						Properties: map[string]Schema{
+							"op":    {Type: "string", Enum: []string{"add", "remove", "replace", "move", "copy", "test"}},
+							"path":  {Type: "string", Example: "/name"},
+							"from":  {Type: "string"},
+							"value": {},
+						},
+						Required: []string{"op", "path"},
+					},
+				},
+			},
+		},
+	}
+}
+
+// validationErrorResponse documents a 422 response with per-field errors
+func validationErrorResponse() Response {
+	return Response{
+		Description: "The given data was invalid",
+		Content: map[string]MediaType{
+			"application/json": {
+				Schema: Schema{Ref: "#/components/schemas/ValidationErrorResponse"},
+			},
+		},
+	}
+}
+
 // generateRequestBody generates request body documentation
-func generateRequestBody(path string) *RequestBody {
+func generateRequestBody(method, path string) *RequestBody {
+	if body, ok := requestBodies[method+" "+path]; ok {
+		return &RequestBody{
+			Required: true,
+			Content: map[string]MediaType{
+				"application/json": {
+					Schema: generateFieldSchema(reflect.TypeOf(body)),
+				},
+			},
+		}
+	}
+
 	if strings.Contains(path, "/users") {
 		return &RequestBody{
 			Description: "User data",
@@ -0,0 +1,179 @@
+package tabular
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+	"went-framework/internal/handlers"
+)
+
+// Writer writes the rows of a spreadsheet one by one, so large exports can be
+// streamed. Close must be called to complete the file.
+type Writer interface {
+	Write(record []string) error
+	Close() error
+}
+
+// Format is a spreadsheet file format rows can be exported to
+type Format struct {
+	// Name selects the format with ?format=, e.g. "csv"
+	Name string
+	// MediaType is sent as Content-Type
+	MediaType string
+	// Extension is the file name extension, without the dot
+	Extension string
+	New       func(w io.Writer) Writer
+}
+
+// formats lists the export formats, the first one is the default
+var formats = []*Format{
+	{Name: "csv", MediaType: "text/csv", Extension: "csv", New: NewCSVWriter},
+	{Name: "xlsx", MediaType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", Extension: "xlsx", New: NewXLSXWriter},
+}
+
+// Formats returns the export formats, CSV first
+func Formats() []*Format {
+	return formats
+}
+
+// Lookup returns the format with the given name, or the default CSV format for an empty name
+func Lookup(name string) (*Format, bool) {
+	if name == "" {
+		return formats[0], true
+	}
+	for _, format := range formats {
+		if strings.EqualFold(format.Name, name) {
+			return format, true
+		}
+	}
+	return nil, false
+}
+
+// Names returns the names of the export formats
+func Names() []string {
+	names := make([]string, len(formats))
+	for i, format := range formats {
+		names[i] = format.Name
+	}
+	return names
+}
+
+// csvWriter writes rows as CSV
+type csvWriter struct {
+	writer *csv.Writer
+}
+
+// NewCSVWriter returns a Writer producing CSV
+func NewCSVWriter(w io.Writer) Writer {
+	return &csvWriter{writer: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) Write(record []string) error {
+	return c.writer.Write(record)
+}
+
+func (c *csvWriter) Close() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+// Mapping maps the columns of an imported file to fields
+type Mapping struct {
+	// Fields holds the field of each column, empty for ignored columns
+	Fields []string
+	// Ignored lists the columns that match no field
+	Ignored []string
+}
+
+// Columns returns the field of each mapped column, keyed by column name
+func (m *Mapping) Columns(header []string) map[string]string {
+	columns := make(map[string]string)
+	for i, field := range m.Fields {
+		if field != "" {
+			columns[header[i]] = field
+		}
+	}
+	return columns
+}
+
+// Record returns the fields and values of the mapped columns of a record
+func (m *Mapping) Record(record []string) (fields, values []string) {
+	for i, field := range m.Fields {
+		if field == "" {
+			continue
+		}
+		fields = append(fields, field)
+		if i < len(record) {
+			values = append(values, record[i])
+		} else {
+			values = append(values, "")
+		}
+	}
+	return fields, values
+}
+
+// MapColumns maps the header of an imported file to fields. Columns named in
+// explicit (column => field) are mapped as given, the others map to the field
+// with the same name, ignoring case, spaces and punctuation ("E-Mail" => "email").
+func MapColumns(header []string, fields []string, explicit map[string]string) (*Mapping, error) {
+	known := make(map[string]string, len(fields))
+	for _, field := range fields {
+		known[normalize(field)] = field
+	}
+
+	// Explicit mappings must name existing columns and fields
+	present := make(map[string]bool, len(header))
+	for _, column := range header {
+		present[column] = true
+	}
+	columns := make([]string, 0, len(explicit))
+	for column := range explicit {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	for _, column := range columns {
+		if !present[column] {
+			return nil, handlers.BadRequest(fmt.Sprintf("Column '%s' is not in the file", column))
+		}
+		if _, ok := known[normalize(explicit[column])]; !ok {
+			return nil, handlers.BadRequest(fmt.Sprintf("Cannot map column '%s' to unknown field '%s', fields are: %s",
+				column, explicit[column], strings.Join(fields, ", ")))
+		}
+	}
+
+	mapping := &Mapping{Fields: make([]string, len(header))}
+	mappedBy := make(map[string]string)
+	for i, column := range header {
+		field, ok := explicit[column]
+		if ok {
+			field = known[normalize(field)]
+		} else if field, ok = known[normalize(column)]; !ok {
+			mapping.Ignored = append(mapping.Ignored, column)
+			continue
+		}
+
+		if other, ok := mappedBy[field]; ok {
+			return nil, handlers.BadRequest(fmt.Sprintf("Columns '%s' and '%s' both map to '%s'", other, column, field))
+		}
+		mappedBy[field] = column
+		mapping.Fields[i] = field
+	}
+
+	if len(mappedBy) == 0 {
+		return nil, handlers.BadRequest(fmt.Sprintf("No column matches a field, expected some of: %s", strings.Join(fields, ", ")))
+	}
+	return mapping, nil
+}
+
+// normalize lowercases a name and strips everything but letters and digits
+func normalize(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
@@ -0,0 +1,190 @@
+package tabular
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMapColumns(t *testing.T) {
+	fields := []string{"name", "email", "birth_date"}
+
+	tests := []struct {
+		name     string
+		header   []string
+		explicit map[string]string
+		fields   []string
+		ignored  []string
+		err      string
+	}{
+		{
+			name:   "same names",
+			header: []string{"name", "email"},
+			fields: []string{"name", "email"},
+		},
+		{
+			name:   "case, spaces and punctuation ignored",
+			header: []string{"Name", "E-Mail", "Birth Date"},
+			fields: []string{"name", "email", "birth_date"},
+		},
+		{
+			name:    "unknown columns ignored",
+			header:  []string{"name", "notes", "email"},
+			fields:  []string{"name", "", "email"},
+			ignored: []string{"notes"},
+		},
+		{
+			name:     "explicit mapping",
+			header:   []string{"Full name", "Mail"},
+			explicit: map[string]string{"Full name": "name", "Mail": "Email"},
+			fields:   []string{"name", "email"},
+		},
+		{
+			name:     "explicit mapping overrides the name",
+			header:   []string{"name", "contact"},
+			explicit: map[string]string{"contact": "name", "name": "email"},
+			fields:   []string{"email", "name"},
+		},
+		{
+			name:     "explicit column missing",
+			header:   []string{"name"},
+			explicit: map[string]string{"mail": "email"},
+			err:      "Column 'mail' is not in the file",
+		},
+		{
+			name:     "explicit unknown field",
+			header:   []string{"name", "mail"},
+			explicit: map[string]string{"mail": "phone"},
+			err:      "Cannot map column 'mail' to unknown field 'phone', fields are: name, email, birth_date",
+		},
+		{
+			name:   "two columns for one field",
+			header: []string{"email", "E-mail"},
+			err:    "Columns 'email' and 'E-mail' both map to 'email'",
+		},
+		{
+			name:   "no column matches",
+			header: []string{"a", "b"},
+			err:    "No column matches a field, expected some of: name, email, birth_date",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapping, err := MapColumns(tt.header, fields, tt.explicit)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(mapping.Fields, tt.fields) {
+				t.Errorf("fields = %q, want %q", mapping.Fields, tt.fields)
+			}
+			if !reflect.DeepEqual(mapping.Ignored, tt.ignored) {
+				t.Errorf("ignored = %q, want %q", mapping.Ignored, tt.ignored)
+			}
+		})
+	}
+}
+
+func TestMappingRecord(t *testing.T) {
+	mapping, err := MapColumns([]string{"Name", "notes", "Email"}, []string{"name", "email"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		record []string
+		values []string
+	}{
+		{[]string{"Ada", "x", "ada@example.com"}, []string{"Ada", "ada@example.com"}},
+		{[]string{"Ada"}, []string{"Ada", ""}},
+	}
+	for _, tt := range tests {
+		fields, values := mapping.Record(tt.record)
+		if !reflect.DeepEqual(fields, []string{"name", "email"}) || !reflect.DeepEqual(values, tt.values) {
+			t.Errorf("Record(%q) = %q, %q, want [name email], %q", tt.record, fields, values, tt.values)
+		}
+	}
+
+	columns := mapping.Columns([]string{"Name", "notes", "Email"})
+	if want := map[string]string{"Name": "name", "Email": "email"}; !reflect.DeepEqual(columns, want) {
+		t.Errorf("Columns() = %v, want %v", columns, want)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		ok   bool
+	}{
+		{"", "csv", true},
+		{"CSV", "csv", true},
+		{"xlsx", "xlsx", true},
+		{"pdf", "", false},
+	}
+	for _, tt := range tests {
+		format, ok := Lookup(tt.name)
+		if ok != tt.ok || ok && format.Name != tt.want {
+			t.Errorf("Lookup(%q) = %v, %v, want %q, %v", tt.name, format, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCSVWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewCSVWriter(&buf)
+	w.Write([]string{"name", "notes"})
+	w.Write([]string{"Ada", "likes, commas"})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "name,notes\nAda,\"likes, commas\"\n"; buf.String() != want {
+		t.Errorf("csv = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestXLSXWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewXLSXWriter(&buf)
+	w.Write([]string{"name", "age", "zip"})
+	w.Write([]string{"<Ada>", "36", "007"})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("not a zip archive: %v", err)
+	}
+	var sheet string
+	for _, file := range archive.File {
+		if strings.HasPrefix(file.Name, "xl/worksheets/") {
+			r, _ := file.Open()
+			data, _ := io.ReadAll(r)
+			sheet = string(data)
+		}
+	}
+	for _, want := range []string{"&lt;Ada&gt;", `<v>36</v>`, "007"} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("sheet does not contain %q: %s", want, sheet)
+		}
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	tests := map[int]string{0: "A", 25: "Z", 26: "AA", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA"}
+	for index, want := range tests {
+		if got := columnName(index); got != want {
+			t.Errorf("columnName(%d) = %q, want %q", index, got, want)
+		}
+	}
+}
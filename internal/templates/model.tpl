@@ -6,29 +6,46 @@
 package models
 
 import (
+	"context"
 	"time"
+	"went-framework/internal/validation"
 
 	"gorm.io/gorm"
-	"github.com/go-playground/validator/v10"
 )
 
-var validate = validator.New()
-
 type {{.ModelName}} struct {
 	ID        uint      `json:"id" gorm:"primaryKey,autoIncrement"`
-    // ... Add your model fields here.
+	// ... Add your model fields here, with validate tags for their rules, e.g.
+	// Title string `json:"title" validate:"required,max=255"`
 	// For further information: https://wentframework.com/docs/models
 	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+
+	// Relationships, for example:
+	// UserID uint  `json:"user_id"`                                  // belongs to
+	// User   *User `json:"user,omitempty"`
+	// Comments []Comment `json:"comments,omitempty"`                  // has many
+	// Tags     []Tag     `json:"tags,omitempty" gorm:"many2many:{{.TableName}}_tags"` // many to many
 }
 
-func (m *{{.ModelName}}) Validate() error {
-	return validate.Struct(m)
+// PatchableFields lists the fields that can be changed with PATCH
+func ({{.ModelName}}) PatchableFields() []string {
+	return []string{}
 }
 
-// TableName specifies the table name for GORM
-func ({{.ModelName}}) TableName() string {
-	return "{{.TableName}}"
+// IncludableRelations lists the relations that can be loaded with ?include=
+func ({{.ModelName}}) IncludableRelations() []string {
+	return []string{}
+}
+
+// SelectableFields lists the fields that can be requested with ?fields=
+func ({{.ModelName}}) SelectableFields() []string {
+	return []string{"id", "created_at", "updated_at"}
+}
+
+// Validate checks the validate tags of the {{.ModelName}}
+func (m *{{.ModelName}}) Validate(ctx context.Context) error {
+	return validation.Validate(ctx, m)
 }
 
 // TableName specifies the table name for GORM
@@ -0,0 +1,206 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"went-framework/app/database"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var (
+	validate *validator.Validate
+	once     sync.Once
+
+	// messages holds the error message format of each rule, "%s" is the field name
+	messages = map[string]string{
+		"required": "The %s field is required",
+		"email":    "The %s field must be a valid email address",
+		"url":      "The %s field must be a valid URL",
+		"uuid":     "The %s field must be a valid UUID",
+		"min":      "The %s field must be at least %s",
+		"max":      "The %s field must be at most %s",
+		"len":      "The %s field must be exactly %s",
+		"oneof":    "The %s field must be one of: %s",
+		"unique":   "The %s has already been taken",
+		"exists":   "The selected %s does not exist",
+	}
+	messagesMu sync.RWMutex
+)
+
+// ignoreIDKey is the context key of the record excluded from unique checks
+type ignoreIDKey struct{}
+
+// Errors maps JSON field names to validation messages
+type Errors map[string]string
+
+func (e Errors) Error() string {
+	fields := make([]string, 0, len(e))
+	for field := range e {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	parts := make([]string, len(fields))
+	for i, field := range fields {
+		parts[i] = e[field]
+	}
+	return strings.Join(parts, "; ")
+}
+
+// getValidator returns the shared validator with the built-in rules registered
+func getValidator() *validator.Validate {
+	once.Do(func() {
+		validate = validator.New(validator.WithRequiredStructEnabled())
+
+		// Report fields by their JSON name
+		validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return field.Name
+			}
+			return name
+		})
+
+		validate.RegisterValidationCtx("unique", validateUnique)
+		validate.RegisterValidationCtx("exists", validateExists)
+	})
+	return validate
+}
+
+// RegisterRule registers a custom rule usable in validate tags, together with its
+// error message ("%s" is replaced by the field name and then the rule parameter)
+func RegisterRule(tag string, fn validator.FuncCtx, message string) error {
+	if err := getValidator().RegisterValidationCtx(tag, fn); err != nil {
+		return err
+	}
+
+	messagesMu.Lock()
+	messages[tag] = message
+	messagesMu.Unlock()
+	return nil
+}
+
+// IgnoreID returns a context whose unique checks skip the record with the given id,
+// so updating a record does not conflict with itself
+func IgnoreID(ctx context.Context, id interface{}) context.Context {
+	return context.WithValue(ctx, ignoreIDKey{}, id)
+}
+
+// Validate validates v using its validate tags. Rule failures are returned as Errors.
+func Validate(ctx context.Context, v interface{}) error {
+	var ruleErr error
+	err := getValidator().StructCtx(context.WithValue(ctx, ruleErrorKey{}, &ruleErr), v)
+	if ruleErr != nil {
+		// The value was not checked, it is not invalid
+		return ruleErr
+	}
+	if err == nil {
+		return nil
+	}
+
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return err
+	}
+
+	result := make(Errors, len(validationErrors))
+	for _, fieldErr := range validationErrors {
+		field := fieldErr.Namespace()
+		// Drop the struct name prefix, keeping nested paths like "profile.bio"
+		if i := strings.Index(field, "."); i != -1 {
+			field = field[i+1:]
+		}
+		result[field] = message(fieldErr)
+	}
+	return result
+}
+
+// message formats the error message of a failed rule
+func message(fieldErr validator.FieldError) string {
+	messagesMu.RLock()
+	format, ok := messages[fieldErr.Tag()]
+	messagesMu.RUnlock()
+
+	field := strings.ReplaceAll(fieldErr.Field(), "_", " ")
+	if !ok {
+		return fmt.Sprintf("The %s field is invalid (%s)", field, fieldErr.Tag())
+	}
+
+	param := strings.ReplaceAll(fieldErr.Param(), " ", ", ")
+	if fieldErr.Tag() == "min" || fieldErr.Tag() == "max" || fieldErr.Tag() == "len" {
+		if fieldErr.Kind() == reflect.String {
+			param += " characters"
+		}
+	}
+
+	if strings.Count(format, "%s") > 1 {
+		return fmt.Sprintf(format, field, param)
+	}
+	return fmt.Sprintf(format, field)
+}
+
+// parseTableColumn splits a rule parameter like "users.email" into table and column
+func parseTableColumn(param string) (string, string, bool) {
+	table, column, ok := strings.Cut(param, ".")
+	return table, column, ok && table != "" && column != ""
+}
+
+// ruleErrorKey holds the first database error of the rules of a Validate call,
+// which Validate returns instead of validation errors
+type ruleErrorKey struct{}
+
+// countRows counts the rows of table where column equals value, skipping the
+// ignored id. Database errors are recorded for Validate.
+func countRows(ctx context.Context, param string, value interface{}) (int64, bool) {
+	table, column, ok := parseTableColumn(param)
+	if !ok {
+		return 0, false
+	}
+
+	db, err := database.Get()
+	var count int64
+	if err == nil {
+		db = db.WithContext(ctx).Table(table)
+		db = db.Where(fmt.Sprintf("%s = ?", db.Statement.Quote(column)), value)
+		if id := ctx.Value(ignoreIDKey{}); id != nil {
+			db = db.Where("id <> ?", id)
+		}
+		err = db.Count(&count).Error
+	}
+	if err != nil {
+		if ruleErr, ok := ctx.Value(ruleErrorKey{}).(*error); ok && *ruleErr == nil {
+			*ruleErr = fmt.Errorf("failed to check %s: %w", param, err)
+		}
+		return 0, false
+	}
+	return count, true
+}
+
+// validateUnique implements unique=table.column, which fails if the value is already stored
+func validateUnique(ctx context.Context, fl validator.FieldLevel) bool {
+	if fl.Field().IsZero() {
+		return true
+	}
+
+	count, ok := countRows(ctx, fl.Param(), fl.Field().Interface())
+	return ok && count == 0
+}
+
+// validateExists implements exists=table.column, which fails unless the value is stored
+func validateExists(ctx context.Context, fl validator.FieldLevel) bool {
+	if fl.Field().IsZero() {
+		return true
+	}
+
+	count, ok := countRows(ctx, fl.Param(), fl.Field().Interface())
+	return ok && count > 0
+}
@@ -0,0 +1,202 @@
+package versioning
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+	"went-framework/internal/handlers"
+
+	"github.com/gorilla/mux"
+)
+
+// Version is a version of the API, mounted under {base}/{name}
+type Version struct {
+	// Name is the path segment of the version, e.g. "v1"
+	Name string
+	// Deprecated is when the version was deprecated, zero while it is supported
+	Deprecated time.Time
+	// Sunset is when the version will be removed, zero when it is not planned
+	Sunset time.Time
+	// Link documents the deprecation, e.g. a migration guide
+	Link string
+	// Routes registers the routes of the version on its subrouter
+	Routes func(api *mux.Router)
+}
+
+// IsDeprecated reports whether the version is deprecated
+func (v Version) IsDeprecated() bool {
+	return !v.Deprecated.IsZero()
+}
+
+// Headers is a middleware announcing the version of each response with
+// API-Version, and the deprecation of a deprecated version with the Deprecation
+// (RFC 9745), Sunset (RFC 8594) and Link headers
+func (v Version) Headers(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("API-Version", v.Name)
+		if v.IsDeprecated() {
+			w.Header().Set("Deprecation", fmt.Sprintf("@%d", v.Deprecated.Unix()))
+			if v.Link != "" {
+				w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="deprecation"`, v.Link))
+			}
+		}
+		if !v.Sunset.IsZero() {
+			w.Header().Set("Sunset", v.Sunset.UTC().Format(http.TimeFormat))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Set is the list of versions of an API
+type Set struct {
+	// Base is the path prefix of the API, e.g. "/api"
+	Base string
+	// Default names the version serving unversioned requests
+	Default  string
+	Versions []Version
+}
+
+// Mount registers the routes of every version on a subrouter under {base}/{name}.
+// The groups are called with each subrouter before its routes are registered,
+// e.g. to apply middleware to all of them.
+func (s *Set) Mount(router *mux.Router, groups ...func(api *mux.Router)) {
+	for _, version := range s.Versions {
+		api := router.PathPrefix(s.Prefix(version)).Subrouter()
+		api.Use(version.Headers)
+		for _, group := range groups {
+			group(api)
+		}
+		version.Routes(api)
+	}
+}
+
+// Prefix returns the path prefix of a version, e.g. /api/v1
+func (s *Set) Prefix(version Version) string {
+	return s.Base + "/" + version.Name
+}
+
+// Lookup returns the version with the given name, which may omit the "v": "v2" or "2"
+func (s *Set) Lookup(name string) (Version, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, version := range s.Versions {
+		if version.Name == name || strings.TrimPrefix(version.Name, "v") == name {
+			return version, true
+		}
+	}
+	return Version{}, false
+}
+
+// Match returns the version whose routes the path belongs to
+func (s *Set) Match(path string) (Version, bool) {
+	for _, version := range s.Versions {
+		prefix := s.Prefix(version)
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return version, true
+		}
+	}
+	return Version{}, false
+}
+
+// Names returns the names of the versions
+func (s *Set) Names() []string {
+	names := make([]string, len(s.Versions))
+	for i, version := range s.Versions {
+		names[i] = version.Name
+	}
+	return names
+}
+
+// requested returns the version asked for by the Accept-Version header or by the
+// version parameter of the Accept header, e.g. application/json; version=2
+func requested(r *http.Request) string {
+	if version := r.Header.Get("Accept-Version"); version != "" {
+		return version
+	}
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		if _, params, err := mime.ParseMediaType(strings.TrimSpace(part)); err == nil && params["version"] != "" {
+			return params["version"]
+		}
+	}
+	return ""
+}
+
+// negotiate returns the version serving an unversioned request, asked for
+// through Accept-Version or the Accept header, or the default version
+func (s *Set) negotiate(r *http.Request) (Version, error) {
+	name := requested(r)
+	if name == "" {
+		name = s.Default
+	}
+	version, ok := s.Lookup(name)
+	if !ok {
+		return Version{}, handlers.NewError(http.StatusNotAcceptable, handlers.CodeNotAcceptable,
+			fmt.Sprintf("Unsupported API version '%s', supported versions are: %s", name, strings.Join(s.Names(), ", ")))
+	}
+	return version, nil
+}
+
+// unversioned reports whether a path is under the base path without a version
+func (s *Set) unversioned(path string) bool {
+	_, versioned := s.Match(path)
+	return !versioned && strings.HasPrefix(path, s.Base+"/")
+}
+
+// Resolve returns the path a request is served under: unversioned requests
+// under the base path, e.g. /api/users, get the prefix of their negotiated
+// version, /api/v2/users. Other paths, and requests for unsupported versions,
+// are returned as is.
+func (s *Set) Resolve(r *http.Request) string {
+	if !s.unversioned(r.URL.Path) {
+		return r.URL.Path
+	}
+	version, err := s.negotiate(r)
+	if err != nil {
+		return r.URL.Path
+	}
+	return s.Prefix(version) + strings.TrimPrefix(r.URL.Path, s.Base)
+}
+
+// Negotiate returns the handler of unversioned requests under the base path,
+// e.g. /api/users. It serves them with the version negotiated through
+// Accept-Version or the Accept header, or with the default version, by
+// dispatching them again to router under the prefix of that version. It is
+// meant to be the NotFoundHandler of router, so versioned routes take precedence.
+// mux serves the NotFoundHandler without the router middleware, so the
+// responses of the negotiator itself, 404 Not Found and 406 Not Acceptable, go
+// through middleware; negotiated requests get the middleware of their route.
+func (s *Set) Negotiate(router http.Handler, middleware ...func(http.Handler) http.Handler) http.Handler {
+	var reject http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.unversioned(r.URL.Path) {
+			http.NotFound(w, r)
+			return
+		}
+		_, err := s.negotiate(r)
+		handlers.RespondError(w, r, err)
+	})
+	for i := len(middleware) - 1; i >= 0; i-- {
+		reject = middleware[i](reject)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.unversioned(r.URL.Path) {
+			reject.ServeHTTP(w, r)
+			return
+		}
+
+		version, err := s.negotiate(r)
+		if err != nil {
+			reject.ServeHTTP(w, r)
+			return
+		}
+
+		// Vary: Accept is added by render, which negotiates the format
+		w.Header().Add("Vary", "Accept-Version")
+
+		versioned := r.Clone(r.Context())
+		versioned.URL.Path = s.Prefix(version) + strings.TrimPrefix(r.URL.Path, s.Base)
+		versioned.URL.RawPath = ""
+		router.ServeHTTP(w, versioned)
+	})
+}
@@ -20,7 +20,7 @@ func main() {
 	wentlog.Init()
 
 	if len(os.Args) < 2 {
-		fmt.Println("Usage: go run main.go [make:model <ModelName>|migrate|migrate:fresh|migrate:rollback|serve|db:test|swagger:generate]")
+		fmt.Println("Usage: go run main.go [make:model <ModelName>|migrate|migrate:fresh|migrate:rollback|serve|db:test|swagger:generate|route:list [prefix]]")
 		return
 	}
 
@@ -53,6 +53,13 @@ func main() {
 	case "swagger:generate":
 		commands.GenerateSwaggerDocs()
 
+	case "route:list":
+		prefix := ""
+		if len(os.Args) > 2 {
+			prefix = os.Args[2]
+		}
+		commands.ListRoutes(prefix)
+
 	default:
 		fmt.Println("Unknown command:", command)
 	}